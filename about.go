@@ -0,0 +1,105 @@
+package honeybee
+
+import (
+	"errors"
+	"fmt"
+	"github.com/russross/blackfriday"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+const AboutSourceType = "about"
+
+// AboutSource provides the bio of the site owner as a block of the
+// "about" kind. The text is read from a markdown file or the profile
+// README of a GitHub user.
+type AboutSource struct {
+	file       string
+	githubUser string
+	title      string
+}
+
+func NewAboutSource(params SourceParams) (as *AboutSource, err error) {
+	as = &AboutSource{}
+	for k, v := range params {
+		switch k {
+		case "file":
+			as.file = ExpandHome(v)
+		case "github-user":
+			as.githubUser = v
+		case "title":
+			as.title = v
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", AboutSourceType, k)
+			return
+		}
+	}
+	if (as.file == "") == (as.githubUser == "") {
+		err = errors.New("exactly one of the 'file' and 'github-user' parameters is required")
+		return
+	}
+	return as, nil
+}
+
+func (as *AboutSource) Type() string {
+	return AboutSourceType
+}
+
+func (as *AboutSource) Id() string {
+	return IdEncodeStrings(as.Type(), as.file, as.githubUser)
+}
+
+func (as *AboutSource) Upstreams() []string {
+	if as.githubUser == "" {
+		return nil
+	}
+	return []string{"https://raw.githubusercontent.com/"}
+}
+
+func (as *AboutSource) readMarkdown() (markdown []byte, modTime time.Time, err error) {
+	if as.file != "" {
+		var finfo os.FileInfo
+		finfo, err = os.Stat(as.file)
+		if err != nil {
+			return
+		}
+		markdown, err = ioutil.ReadFile(as.file)
+		return markdown, finfo.ModTime().UTC(), err
+	}
+
+	// the profile README is located in a repository named like the user
+	readmeUrl := fmt.Sprintf("https://raw.githubusercontent.com/%v/%v/HEAD/README.md",
+		as.githubUser, as.githubUser)
+	resp, err := http.Get(readmeUrl)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("Could not fetch profile README of %v: %v", as.githubUser, resp.Status)
+		return
+	}
+	markdown, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+func (as *AboutSource) GetBlocks() (blocks []*Block, err error) {
+	markdown, modTime, err := as.readMarkdown()
+	if err != nil {
+		return
+	}
+	block := NewBlock(as)
+	block.Kind = AboutBlockKind
+	block.Title = as.title
+	block.Content = string(markdown)
+	block.HtmlContent = string(blackfriday.MarkdownCommon(markdown))
+	if !modTime.IsZero() {
+		block.TimeStamp = modTime
+	}
+	if as.githubUser != "" {
+		block.Link = "https://github.com/" + as.githubUser
+	}
+	return []*Block{block}, nil
+}
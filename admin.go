@@ -0,0 +1,238 @@
+package honeybee
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+)
+
+type AdminConfiguration struct {
+	// credentials for the admin pages. The admin pages are
+	// disabled when no password is set
+	User     string
+	Password string
+}
+
+// wrap a handler to require the admin credentials using basic auth
+func (s *Server) requireAdmin(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		config, _ := s.current()
+		user, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(config.Admin.User)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(config.Admin.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="honeybee admin"`)
+			httpError(w, r, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handle(w, r, ps)
+	}
+}
+
+var adminUploadTemplate = template.Must(template.New("upload").Parse(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <title>Upload a photo</title>
+  </head>
+  <body>
+    <h1>Upload a photo</h1>
+    {{ if .Error }}<p style="color: red">{{ html .Error }}</p>{{ end }}
+    <form method="post" enctype="multipart/form-data">
+      <p><label>Image<br><input type="file" name="image" accept="image/*" required></label></p>
+      <p><label>Title<br><input type="text" name="title"></label></p>
+      <p><label>Description<br><textarea name="description" rows="5" cols="50"></textarea></label></p>
+      <p><input type="submit" value="Upload"></p>
+    </form>
+  </body>
+</html>
+`))
+
+func (s *Server) renderAdminUpload(w http.ResponseWriter, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	adminUploadTemplate.Execute(w, struct{ Error string }{errMsg})
+}
+
+func (s *Server) handleAdminUploadForm(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s.renderAdminUpload(w, http.StatusOK, "")
+}
+
+// store an uploaded image as a new block of the manual source
+func (s *Server) handleAdminUpload(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	config, sources := s.current()
+	ms, found := sources.ManualSource()
+	if !found {
+		s.renderAdminUpload(w, http.StatusInternalServerError, "No manual source configured.")
+		return
+	}
+	if config.ReadOnly {
+		// nothing is updated in read-only mode, the block would not be shown
+		s.renderAdminUpload(w, http.StatusServiceUnavailable, ErrReadOnly.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMicropubRequestSize)
+	f, _, err := r.FormFile("image")
+	if err != nil {
+		s.renderAdminUpload(w, http.StatusBadRequest, "No image uploaded.")
+		return
+	}
+	defer f.Close()
+	name, err := SaveUpload(config.UploadDirectory(), f)
+	if err != nil {
+		s.renderAdminUpload(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	block := NewBlock(ms)
+	block.Title = r.FormValue("title")
+	block.Content = r.FormValue("description")
+	block.ImageLink = config.UploadUrl(name)
+	block.Link = block.ImageLink
+	block.TimeStamp = time.Now().UTC()
+	err = ms.AddBlock(block)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not store uploaded image: %v", err)
+		s.renderAdminUpload(w, http.StatusInternalServerError, "Could not store the block.")
+		return
+	}
+	err = s.refreshSource(ms)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not update the blocks of the manual source: %v", err)
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// pull a single source and render its blocks using the index template.
+// The served blocks are not changed, so the configuration of a source
+// can be checked before the next update.
+func (s *Server) handleAdminPreview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// the source is pulled without holding reloadMtx
+	s.reloadMtx.RLock()
+	config, configSources, templ := s.config, s.sources, s.templ
+	s.reloadMtx.RUnlock()
+
+	id := r.URL.Query().Get("source")
+	var source Source
+	for _, candidate := range configSources {
+		if candidate.Id() == id {
+			source = candidate
+		}
+	}
+	if source == nil {
+		httpError(w, r, fmt.Sprintf("Unknown source: %v", id), http.StatusNotFound)
+		return
+	}
+
+	if config.ReadOnly {
+		httpError(w, r, ErrReadOnly.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	pipeline := NewPipeline(config, configSources, s.imgProxy)
+	sources := Sources{source}
+	sources = sources.Unfiltered()
+	err := sources.SendBlocksTo(pipeline, nil)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("Could not pull %v: %v", source.Type(), err), http.StatusBadGateway)
+		return
+	}
+	blocks, _ := pipeline.GetBlocks()
+	// the images of the blocks are served by the preview, not by the
+	// image route
+	previewId := newRequestId()
+	for _, block := range blocks {
+		block.imageRoute = "admin/preview/" + previewId + "/image/"
+	}
+	blockStore := NewBlockStore()
+	blockStore.Replace(blocks)
+	s.addPreview(previewId, blockStore)
+
+	// without pages all blocks are public, so the blocks of private
+	// pages are previewed as well
+	preview := &Server{
+		config:      config,
+		sources:     configSources,
+		blockStore:  blockStore,
+		templ:       templ,
+		renderedMtx: new(sync.Mutex),
+		warmedUp:    true,
+	}
+	buf := new(bytes.Buffer)
+	err = preview.renderPreview(buf)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not render the preview of %v: %v", source.Type(), err)
+		httpError(w, r, "Could not render the preview", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+const (
+	// previews are kept for looking at their images
+	adminPreviewLifetime = 30 * time.Minute
+	// number of previews kept at most
+	maxAdminPreviews = 8
+)
+
+// the blocks of a preview of a source
+type adminPreview struct {
+	blockStore BlockStore
+	created    time.Time
+}
+
+// keep the blocks of a preview for serving their images. Expired
+// previews and the oldest ones beyond maxAdminPreviews are removed.
+func (s *Server) addPreview(id string, blockStore BlockStore) {
+	preview := &adminPreview{
+		blockStore: blockStore,
+		created:    time.Now(),
+	}
+
+	s.previewsMtx.Lock()
+	defer s.previewsMtx.Unlock()
+	for previewId, p := range s.previews {
+		if time.Since(p.created) > adminPreviewLifetime {
+			delete(s.previews, previewId)
+		}
+	}
+	for len(s.previews) >= maxAdminPreviews {
+		oldestId := ""
+		for previewId, p := range s.previews {
+			if oldestId == "" || p.created.Before(s.previews[oldestId].created) {
+				oldestId = previewId
+			}
+		}
+		delete(s.previews, oldestId)
+	}
+	s.previews[id] = preview
+}
+
+// handle the request to the image of a block of a preview
+func (s *Server) handleAdminPreviewImage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s.previewsMtx.Lock()
+	preview, found := s.previews[ps.ByName("preview")]
+	if found && time.Since(preview.created) > adminPreviewLifetime {
+		found = false
+	}
+	s.previewsMtx.Unlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	block, found := preview.blockStore.Get(ps.ByName("id"))
+	if !found || !block.HasImage() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.serveBlockImage(w, r, block, "")
+}
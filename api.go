@@ -0,0 +1,126 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// number of blocks returned by /api/blocks without and with a limit
+const (
+	defaultApiBlocksLimit = 50
+	maxApiBlocksLimit     = 200
+)
+
+// block as returned by the api. Images are served by the image proxy
+type apiBlock struct {
+	Id          string    `json:"id"`
+	SourceType  string    `json:"source_type"`
+	Title       string    `json:"title"`
+	Link        string    `json:"link,omitempty"`
+	Content     string    `json:"content,omitempty"`
+	Summary     string    `json:"summary,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	ImageWidth  int       `json:"image_width,omitempty"`
+	ImageHeight int       `json:"image_height,omitempty"`
+	TimeStamp   time.Time `json:"timestamp"`
+	Tags        []string  `json:"tags,omitempty"`
+
+	Links []BlockLink       `json:"links,omitempty"`
+	Meta  map[string]string `json:"meta,omitempty"`
+}
+
+func newApiBlock(block *Block) apiBlock {
+	ab := apiBlock{
+		Id:          block.Id(),
+		Title:       block.Title,
+		Link:        block.Link,
+		Content:     block.Content,
+		Summary:     block.Summary,
+		ImageWidth:  block.ImageWidth,
+		ImageHeight: block.ImageHeight,
+		TimeStamp:   block.TimeStamp,
+		Tags:        block.Tags,
+		Links:       block.Links,
+		Meta:        block.Meta,
+	}
+	if block.Origin != nil {
+		ab.SourceType = block.Origin.Type()
+	}
+	if block.HasImage() {
+		// relative to the root of the site
+		ab.Image = imageUrl(block)
+	}
+	return ab
+}
+
+// return a page of the public blocks of the index page, newest first.
+// The id of the last block of a page is the cursor for the next one,
+// passed as the "after" parameter. Clients compare the revision to notice
+// updates of the blocks. Cursors of blocks which have been removed by
+// an update are answered with 410, the client has to start over.
+func (s *Server) handleApiBlocks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	limit := defaultApiBlocksLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			httpError(w, r, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		if limit > maxApiBlocksLimit {
+			limit = maxApiBlocksLimit
+		}
+	}
+
+	s.renderedMtx.Lock()
+	revision := s.revision
+	s.renderedMtx.Unlock()
+
+	var blocks []*Block
+	for _, block := range s.blockStore.List() {
+		if !block.IsAbout() && s.isPublic(block) {
+			blocks = append(blocks, block)
+		}
+	}
+	start := 0
+	if after := r.URL.Query().Get("after"); after != "" {
+		start = -1
+		for i, block := range blocks {
+			if block.Id() == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			httpError(w, r, "Unknown cursor, the blocks have been updated", http.StatusGone)
+			return
+		}
+	}
+	end := start + limit
+	if end > len(blocks) {
+		end = len(blocks)
+	}
+
+	page := struct {
+		Revision string     `json:"revision"`
+		Blocks   []apiBlock `json:"blocks"`
+		// cursor of the next page. Empty on the last page
+		Next string `json:"next,omitempty"`
+	}{
+		Revision: revision,
+		Blocks:   make([]apiBlock, 0, end-start),
+	}
+	for _, block := range blocks[start:end] {
+		page.Blocks = append(page.Blocks, newApiBlock(block))
+	}
+	if end < len(blocks) {
+		page.Next = page.Blocks[len(page.Blocks)-1].Id
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(page)
+}
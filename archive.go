@@ -0,0 +1,143 @@
+package honeybee
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// a month of the archive with blocks
+type ArchiveMonth struct {
+	// first day of the month in the configured timezone
+	Date time.Time
+	// number of blocks of the month
+	Blocks int
+}
+
+// path of the archive page of the month relative to the root of the site
+func (am ArchiveMonth) Path() string {
+	return fmt.Sprintf("archive/%d/%02d", am.Date.Year(), am.Date.Month())
+}
+
+// the months containing blocks in the timezone loc, newest first.
+// Only blocks passing include are counted.
+func (bs *BlockStore) Months(loc *time.Location, include func(*Block) bool) (months []ArchiveMonth) {
+	// the blocks are sorted newest first
+	for _, block := range bs.blocks {
+		if !include(block) {
+			continue
+		}
+		t := block.TimeStamp.In(loc)
+		last := len(months) - 1
+		if last >= 0 && months[last].Date.Year() == t.Year() && months[last].Date.Month() == t.Month() {
+			months[last].Blocks++
+			continue
+		}
+		months = append(months, ArchiveMonth{
+			Date:   time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc),
+			Blocks: 1,
+		})
+	}
+	return
+}
+
+// the blocks with a timestamp within a month in the timezone loc,
+// newest first
+func (bs *BlockStore) InMonth(year int, month time.Month, loc *time.Location) []*Block {
+	blocks := bs.blocks
+	start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 1, 0)
+	from := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].TimeStamp.Before(end)
+	})
+	to := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].TimeStamp.Before(start)
+	})
+	return blocks[from:to]
+}
+
+// handle the request to the archive page of a month. The pages are
+// rendered on request, as only few of them are visited.
+func (s *Server) handleArchivePage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	year, err := strconv.Atoi(ps.ByName("year"))
+	if err != nil || year < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	month, err := strconv.Atoi(ps.ByName("month"))
+	if err != nil || month < 1 || month > 12 {
+		http.NotFound(w, r)
+		return
+	}
+	loc, err := time.LoadLocation(s.config.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	listed := func(block *Block) bool {
+		return !block.IsAbout() && s.isPublic(block)
+	}
+	var blocks []*Block
+	for _, block := range s.blockStore.InMonth(year, time.Month(month), loc) {
+		if listed(block) {
+			blocks = append(blocks, block)
+		}
+	}
+	if len(blocks) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	archivePage := struct {
+		Blocks []*Block
+		// the month of the page
+		Month ArchiveMonth
+		// all months with blocks, newest first
+		Months []ArchiveMonth
+		// the adjacent months with blocks. nil at the ends of the archive
+		Newer *ArchiveMonth
+		Older *ArchiveMonth
+		// relative path to the root of the site
+		Root     string
+		Vars     map[string]string
+		MetaTags map[string]string
+		Image    ImageConfiguration
+	}{
+		Blocks:   blocks,
+		Months:   s.blockStore.Months(loc, listed),
+		Root:     "../../",
+		Vars:     s.config.Vars,
+		MetaTags: s.config.MetaTags,
+		Image:    s.config.Image,
+	}
+	for i, m := range archivePage.Months {
+		if m.Date.Year() != year || m.Date.Month() != time.Month(month) {
+			continue
+		}
+		archivePage.Month = m
+		if i > 0 {
+			archivePage.Newer = &archivePage.Months[i-1]
+		}
+		if i < len(archivePage.Months)-1 {
+			archivePage.Older = &archivePage.Months[i+1]
+		}
+		break
+	}
+
+	started := time.Now()
+	buf := new(bytes.Buffer)
+	err = s.templ.Render(buf, s.config.ArchiveTemplateName(), archivePage)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not render the archive of %d/%02d: %v", year, month, err)
+		httpError(w, r, "Could not render the page", http.StatusInternalServerError)
+		return
+	}
+	// archive pages are recorded together
+	recordRender("archive", time.Since(started), buf.Len())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
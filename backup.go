@@ -0,0 +1,182 @@
+package honeybee
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// names of the entries in a backup archive
+const (
+	backupConfigName = "config.yml"
+	backupStoreName  = "store/blocks"
+	backupCachePath  = "cache/"
+)
+
+func writeBackupEntry(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// write a gzip compressed tar archive containing the configuration file,
+// the persisted blocks and optionally the contents of the cache
+func Backup(w io.Writer, config *Configuration, withCache bool) (err error) {
+	gzw := gzip.NewWriter(w)
+	defer gzw.Close()
+	tw := tar.NewWriter(gzw)
+	defer tw.Close()
+
+	// the configuration has to be the first entry, as it is needed
+	// to restore the other entries. It is read like ReadConfiguration
+	// does, so configurations from the environment are backed up as well
+	configData, err := readConfigurationFile(config.Directory)
+	if err != nil {
+		return
+	}
+	err = writeBackupEntry(tw, backupConfigName, configData)
+	if err != nil {
+		return
+	}
+
+	if config.Store.File != "" {
+		var storeData []byte
+		storeData, err = ioutil.ReadFile(config.Store.File)
+		if err == nil {
+			err = writeBackupEntry(tw, backupStoreName+filepath.Ext(config.Store.File), storeData)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+
+	if withCache {
+		var cache MigratableCache
+		cache, err = CreateCache(config.Cache.Backend, &config.Cache)
+		if err != nil {
+			return
+		}
+		for storageKey := range cache.StorageKeys() {
+			entry, readErr := cache.ReadEntry(storageKey)
+			if readErr != nil {
+				log.Printf("Skipping unreadable cache entry %s: %v", storageKey, readErr)
+				continue
+			}
+			err = writeBackupEntry(tw, backupCachePath+storageKey, entry)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return nil
+}
+
+// restore a backup written by Backup. The configuration file in the archive
+// is only restored into configDir when restoreConfig is set. readConfig
+// is used to read the configuration after that.
+func Restore(r io.Reader, configDir string, restoreConfig bool, readConfig func() (Configuration, error)) (err error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return
+	}
+	defer gzr.Close()
+	tr := tar.NewReader(gzr)
+
+	var config *Configuration
+	var cache MigratableCache
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+		var data []byte
+		data, err = ioutil.ReadAll(tr)
+		if err != nil {
+			return
+		}
+
+		if hdr.Name == backupConfigName {
+			if restoreConfig {
+				err = ioutil.WriteFile(filepath.Join(ExpandHome(configDir), "config.yml"), data, 0644)
+				if err != nil {
+					return
+				}
+			}
+			continue
+		}
+
+		if config == nil {
+			var c Configuration
+			c, err = readConfig()
+			if err != nil {
+				return
+			}
+			config = &c
+		}
+
+		switch {
+		case strings.HasPrefix(hdr.Name, backupStoreName):
+			if config.Store.File == "" {
+				log.Printf("No store file configured, skipping the persisted blocks.")
+				continue
+			}
+			if path.Ext(hdr.Name) != filepath.Ext(config.Store.File) {
+				// the format of the store file changed
+				var records []BlockRecord
+				records, err = ImportBlockRecords(bytes.NewReader(data), ExportFormatFromFilename(hdr.Name))
+				if err == nil {
+					err = SaveBlockRecords(config.Store.File, records)
+				}
+			} else {
+				err = ioutil.WriteFile(config.Store.File, data, 0644)
+			}
+			if err != nil {
+				return
+			}
+		case strings.HasPrefix(hdr.Name, backupCachePath):
+			if cache == nil {
+				cache, err = CreateCache(config.Cache.Backend, &config.Cache)
+				if err != nil {
+					return
+				}
+			}
+			storageKey := hdr.Name[len(backupCachePath):]
+			if !isBackupStorageKey(storageKey) {
+				return fmt.Errorf("Unexpected cache entry in backup: %v", hdr.Name)
+			}
+			err = cache.WriteEntry(storageKey, data)
+			if err != nil {
+				return
+			}
+		default:
+			return fmt.Errorf("Unexpected entry in backup: %v", hdr.Name)
+		}
+	}
+}
+
+// check the storage key of a cache entry of a backup. The keys are
+// hashes, so entries leaving the directory of the cache are refused.
+func isBackupStorageKey(storageKey string) bool {
+	return storageKey != "" && !strings.Contains(storageKey, "..") && !strings.ContainsAny(storageKey, "/\\")
+}
@@ -0,0 +1,256 @@
+package honeybee
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// size of the image transformed by the benchmark, about the size of
+// the photos of a phone
+const (
+	benchImageWidth  = 4000
+	benchImageHeight = 3000
+)
+
+type BenchOptions struct {
+	// time each benchmark runs for
+	Duration time.Duration
+	// number of goroutines running a benchmark at the same time
+	Concurrency int
+}
+
+type BenchResult struct {
+	Name string
+	// reason the benchmark did not run
+	Skipped  string
+	Elapsed  time.Duration
+	Failures int
+	// sorted latencies of the successful operations
+	Latencies []time.Duration
+}
+
+// operations per second
+func (r *BenchResult) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(len(r.Latencies)) / r.Elapsed.Seconds()
+}
+
+// latency below which p percent of the operations finished
+func (r *BenchResult) Percentile(p int) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	return r.Latencies[(len(r.Latencies)-1)*p/100]
+}
+
+// the results of all benchmarks
+type BenchReport []BenchResult
+
+func (r BenchReport) Write(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "benchmark\tops\tops/s\tp50\tp95\tp99\tfailed\n")
+	for _, result := range r {
+		if result.Skipped != "" {
+			fmt.Fprintf(tw, "%v\tskipped: %v\n", result.Name, result.Skipped)
+			continue
+		}
+		fmt.Fprintf(tw, "%v\t%d\t%.1f\t%v\t%v\t%v\t%d\n",
+			result.Name,
+			len(result.Latencies),
+			result.Throughput(),
+			roundLatency(result.Percentile(50)),
+			roundLatency(result.Percentile(95)),
+			roundLatency(result.Percentile(99)),
+			result.Failures)
+	}
+	tw.Flush()
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// measure the rendering of the index page, the latency of images served
+// from the cache and the throughput of the image transformation. The
+// blocks of the store file are used, nothing is pulled and no images are
+// downloaded, so this can run next to a live instance sharing its cache.
+func Bench(config *Configuration, options BenchOptions) (report BenchReport, err error) {
+	if options.Duration <= 0 || options.Concurrency < 1 {
+		return nil, errors.New("The benchmarks need a duration and a concurrency")
+	}
+	benchConfig := *config
+	benchConfig.ReadOnly = true
+	srv, err := NewServer(&benchConfig)
+	if err != nil {
+		return
+	}
+
+	logInfof("Running each benchmark for %v with %d goroutines ...", options.Duration, options.Concurrency)
+	report = append(report, benchmark("render index page", options, func(int) error {
+		return srv.renderPage(ioutil.Discard, nil)
+	}))
+	report = append(report, benchmark("serve index page", options, func(int) error {
+		w := newBenchResponseWriter()
+		srv.handleIndexPage(w, benchRequest("/"), nil)
+		return w.err()
+	}))
+	report = append(report, srv.benchImageHits(options))
+	report = append(report, srv.benchTransform(options))
+	return report, nil
+}
+
+// serve the images of the blocks which are in the cache
+func (s *Server) benchImageHits(options BenchOptions) BenchResult {
+	name := "serve cached image"
+	var blocks []*Block
+	for _, block := range s.blockStore.List() {
+		if !block.HasImage() {
+			continue
+		}
+		ctx := contextForBlockImage(context.Background(), block)
+		if _, found := s.cache.Get(s.imgProxy.cacheKey(ctx, block.ImageLink)); found {
+			blocks = append(blocks, block)
+		}
+	}
+	if len(blocks) == 0 {
+		return BenchResult{Name: name, Skipped: "no cached images of blocks"}
+	}
+	return benchmark(name, options, func(i int) error {
+		w := newBenchResponseWriter()
+		block := blocks[i%len(blocks)]
+		req := benchRequest("/image")
+		err := s.imgProxy.ProxyImage(w, req.WithContext(contextForBlockImage(req.Context(), block)), block.ImageLink)
+		if err != nil {
+			return err
+		}
+		return w.err()
+	})
+}
+
+// transform a generated photo, like images which are not cached yet
+func (s *Server) benchTransform(options BenchOptions) BenchResult {
+	name := fmt.Sprintf("transform %dx%d jpeg", benchImageWidth, benchImageHeight)
+	data, err := benchImage(benchImageWidth, benchImageHeight)
+	if err != nil {
+		return BenchResult{Name: name, Skipped: err.Error()}
+	}
+	return benchmark(name, options, func(int) error {
+		_, err := s.imgProxy.transform.Transform(data, "image/jpeg")
+		return err
+	})
+}
+
+// run fn on concurrent goroutines until the duration is over. fn gets
+// the number of the operation, f.e. to rotate through inputs.
+func benchmark(name string, options BenchOptions, fn func(int) error) BenchResult {
+	result := BenchResult{Name: name}
+	var counter int64
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	started := time.Now()
+	deadline := started.Add(options.Duration)
+	for i := 0; i < options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var latencies []time.Duration
+			failures := 0
+			for time.Now().Before(deadline) {
+				opStarted := time.Now()
+				if err := fn(int(atomic.AddInt64(&counter, 1) - 1)); err != nil {
+					logDebugf("Benchmark %v failed: %v", name, err)
+					failures++
+					continue
+				}
+				latencies = append(latencies, time.Since(opStarted))
+			}
+			mtx.Lock()
+			result.Latencies = append(result.Latencies, latencies...)
+			result.Failures += failures
+			mtx.Unlock()
+		}()
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(started)
+	sort.Slice(result.Latencies, func(i, j int) bool {
+		return result.Latencies[i] < result.Latencies[j]
+	})
+	return result
+}
+
+// a jpeg with noise on top of a gradient, to be about as hard
+// to compress as a photo
+func benchImage(width int, height int) ([]byte, error) {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			shade := 200 * (x + y) / (width + height)
+			img.Set(x, y, color.RGBA{
+				uint8(shade + rnd.Intn(56)),
+				uint8(shade/2 + rnd.Intn(56)),
+				uint8(200 - shade + rnd.Intn(56)),
+				0xff,
+			})
+		}
+	}
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 90})
+	return buf.Bytes(), err
+}
+
+func benchRequest(path string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	return req
+}
+
+// discards the body, only the status is of interest
+type benchResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func newBenchResponseWriter() *benchResponseWriter {
+	return &benchResponseWriter{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (w *benchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *benchResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *benchResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *benchResponseWriter) err() error {
+	if w.status >= 400 {
+		return fmt.Errorf("Status %d", w.status)
+	}
+	return nil
+}
@@ -6,8 +6,15 @@ import (
 	"time"
 )
 
+const (
+	// blocks with the bio of the site owner
+	AboutBlockKind = "about"
+)
+
 type Block struct {
 	Origin Source
+	// kind of the block. Empty for regular blocks
+	Kind string
 	// some unique id to identify this block
 	Title       string
 	ImageLink   string
@@ -15,8 +22,33 @@ type Block struct {
 	ImageHeight int
 	Link        string
 	Content     string
+	// file name of the transformed image, derived from its content. Empty
+	// until the image has been analyzed
+	ImageFile string
+	// shortened version of the content
+	Summary string
+	// trusted html version of the content, f.e. rendered from markdown
+	HtmlContent string
 	TimeStamp   time.Time
-	ModifyMtx   *sync.Mutex
+	Tags        []string
+	// programming language of software projects
+	Language string
+	// number of stars of software projects
+	Stars int
+	// urls mentioned in the content. Filled in the filter stage
+	Links []BlockLink
+	// fields specific to the provider, f.e. the license of a
+	// repository. Keys are lowercase
+	Meta map[string]string
+	// the image is linked at its upstream url instead of being
+	// served through the image proxy
+	DirectImage bool
+	// the block should not be indexed by search engines
+	NoIndex   bool
+	ModifyMtx *sync.Mutex
+	// path of the route serving the image, relative to the root of the
+	// site. Empty for the image route, set for the blocks of previews
+	imageRoute string
 }
 
 func NewBlock(origin Source) *Block {
@@ -41,10 +73,131 @@ func (b *Block) Id() string {
 	return IdEncodeStrings(o_id, b.Title, b.Link, b.Content)
 }
 
+// set a field of the metadata. Empty values are left out
+func (b *Block) SetMeta(key string, value string) {
+	if value == "" {
+		return
+	}
+	if b.Meta == nil {
+		b.Meta = make(map[string]string)
+	}
+	b.Meta[key] = value
+}
+
 func (b *Block) HasImage() bool {
 	return b.ImageLink != ""
 }
 
+// about blocks are pinned to the header of the page instead of
+// being listed with the other blocks
+func (b *Block) IsAbout() bool {
+	return b.Kind == AboutBlockKind
+}
+
+func (b *Block) HasTag(tag string) bool {
+	for _, t := range b.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// serializable representation of a block
+type BlockRecord struct {
+	SourceId    string    `json:"source_id" yaml:"source_id"`
+	SourceType  string    `json:"source_type" yaml:"source_type"`
+	Kind        string    `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Title       string    `json:"title" yaml:"title"`
+	ImageLink   string    `json:"image_link,omitempty" yaml:"image_link,omitempty"`
+	ImageWidth  int       `json:"image_width,omitempty" yaml:"image_width,omitempty"`
+	ImageHeight int       `json:"image_height,omitempty" yaml:"image_height,omitempty"`
+	ImageFile   string    `json:"image_file,omitempty" yaml:"image_file,omitempty"`
+	Link        string    `json:"link,omitempty" yaml:"link,omitempty"`
+	Content     string    `json:"content,omitempty" yaml:"content,omitempty"`
+	Summary     string    `json:"summary,omitempty" yaml:"summary,omitempty"`
+	HtmlContent string    `json:"html_content,omitempty" yaml:"html_content,omitempty"`
+	TimeStamp   time.Time `json:"timestamp" yaml:"timestamp"`
+	Tags        []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Language    string    `json:"language,omitempty" yaml:"language,omitempty"`
+	Stars       int       `json:"stars,omitempty" yaml:"stars,omitempty"`
+	NoIndex     bool      `json:"noindex,omitempty" yaml:"noindex,omitempty"`
+	DirectImage bool      `json:"direct_image,omitempty" yaml:"direct_image,omitempty"`
+
+	Links []BlockLink       `json:"links,omitempty" yaml:"links,omitempty"`
+	Meta  map[string]string `json:"meta,omitempty" yaml:"meta,omitempty"`
+}
+
+func (b *Block) Record() BlockRecord {
+	r := BlockRecord{
+		Kind:        b.Kind,
+		Title:       b.Title,
+		ImageLink:   b.ImageLink,
+		ImageWidth:  b.ImageWidth,
+		ImageHeight: b.ImageHeight,
+		ImageFile:   b.ImageFile,
+		Link:        b.Link,
+		Content:     b.Content,
+		Summary:     b.Summary,
+		HtmlContent: b.HtmlContent,
+		TimeStamp:   b.TimeStamp,
+		Tags:        b.Tags,
+		Language:    b.Language,
+		Stars:       b.Stars,
+		NoIndex:     b.NoIndex,
+		DirectImage: b.DirectImage,
+		Links:       b.Links,
+		Meta:        b.Meta,
+	}
+	if b.Origin != nil {
+		r.SourceId = b.Origin.Id()
+		r.SourceType = b.Origin.Type()
+	}
+	return r
+}
+
+// id of the block of the record, see Block.Id
+func (r *BlockRecord) id() string {
+	return IdEncodeStrings(r.SourceId, r.Title, r.Link, r.Content)
+}
+
+// create a block from the record
+func (r *BlockRecord) Block(origin Source) *Block {
+	b := NewBlock(origin)
+	b.Title = r.Title
+	b.ImageLink = r.ImageLink
+	b.ImageWidth = r.ImageWidth
+	b.ImageHeight = r.ImageHeight
+	b.ImageFile = r.ImageFile
+	b.Link = r.Link
+	b.Kind = r.Kind
+	b.Content = r.Content
+	b.Summary = r.Summary
+	b.HtmlContent = r.HtmlContent
+	b.TimeStamp = r.TimeStamp
+	b.Tags = r.Tags
+	b.Language = r.Language
+	b.Stars = r.Stars
+	b.NoIndex = r.NoIndex
+	b.DirectImage = r.DirectImage
+	b.Links = r.Links
+	b.Meta = r.Meta
+	return b
+}
+
+// convert records to blocks, using the sources to resolve the origin of
+// each block. Records of unknown sources are skipped.
+func BlocksFromRecords(records []BlockRecord, sources Sources) (blocks []*Block) {
+	for i := range records {
+		origin, found := sources.Get(records[i].SourceId)
+		if !found {
+			continue
+		}
+		blocks = append(blocks, records[i].Block(origin))
+	}
+	return
+}
+
 type ByTimeStamp []*Block
 
 func (bt ByTimeStamp) Len() int {
@@ -55,7 +208,12 @@ func (bt ByTimeStamp) Swap(i, j int) {
 	bt[i], bt[j] = bt[j], bt[i]
 }
 
+// newest first. Blocks with the same timestamp are ordered by
+// their ids, so the order is the same after each update
 func (bt ByTimeStamp) Less(i, j int) bool {
+	if bt[i].TimeStamp.Equal(bt[j].TimeStamp) {
+		return bt[i].Id() < bt[j].Id()
+	}
 	return bt[i].TimeStamp.After(bt[j].TimeStamp)
 }
 
@@ -94,6 +252,22 @@ func (bs *BlockStore) Get(blockId string) (b *Block, found bool) {
 	return
 }
 
+// replace the complete contents of the store
+func (bs *BlockStore) Replace(newBlocks []*Block) {
+	blocks := make([]*Block, len(newBlocks))
+	index := make(map[string]*Block)
+	for i := range newBlocks {
+		blocks[i] = newBlocks[i]
+		index[newBlocks[i].Id()] = newBlocks[i]
+	}
+	sort.Sort(ByTimeStamp(blocks))
+
+	bs.modifyMtx.Lock()
+	defer bs.modifyMtx.Unlock()
+	bs.blocks = blocks
+	bs.index = index
+}
+
 func (bs *BlockStore) ReceiveBlocks(newBlocks []*Block) {
 	// collect the source ids of the blocks
 	sourceIdSet := make(map[string]bool)
@@ -125,3 +299,31 @@ func (bs *BlockStore) ReceiveBlocks(newBlocks []*Block) {
 	}
 	sort.Sort(ByTimeStamp(bs.blocks))
 }
+
+// remove the oldest blocks exceeding the maximum number of blocks of
+// the store or of their source. A maximum of 0 means no limit.
+// Returns the removed blocks.
+func (bs *BlockStore) Trim(maxBlocks int, maxBlocksPerSource map[string]int) (removed []*Block) {
+	bs.modifyMtx.Lock()
+	defer bs.modifyMtx.Unlock()
+
+	// the blocks are sorted newest first
+	var kept []*Block
+	perSource := make(map[string]int)
+	for _, block := range bs.blocks {
+		sourceId := ""
+		if block.Origin != nil {
+			sourceId = block.Origin.Id()
+		}
+		sourceMax := maxBlocksPerSource[sourceId]
+		if (maxBlocks > 0 && len(kept) >= maxBlocks) || (sourceMax > 0 && perSource[sourceId] >= sourceMax) {
+			removed = append(removed, block)
+			delete(bs.index, block.Id())
+			continue
+		}
+		perSource[sourceId]++
+		kept = append(kept, block)
+	}
+	bs.blocks = kept
+	return
+}
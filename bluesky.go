@@ -0,0 +1,198 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BlueskyFeedSourceType = "bluesky-feed"
+
+	blueskyAuthorFeedUrl = "https://public.api.bsky.app/xrpc/app.bsky.feed.getAuthorFeed"
+	blueskyRepostReason  = "app.bsky.feed.defs#reasonRepost"
+	// maximum number of characters of titles taken from the text of posts
+	blueskyTitleLength = 80
+)
+
+// BlueskyFeedSource provides the posts of a Bluesky account using
+// the public XRPC api of the AT protocol
+type BlueskyFeedSource struct {
+	handle         string
+	limit          int
+	includeReposts bool
+}
+
+func NewBlueskyFeedSource(params SourceParams) (bs *BlueskyFeedSource, err error) {
+	bs = &BlueskyFeedSource{
+		limit: 30,
+	}
+	for k, v := range params {
+		switch k {
+		case "handle":
+			bs.handle = strings.TrimPrefix(v, "@")
+		case "limit":
+			bs.limit, err = strconv.Atoi(v)
+			if err != nil || bs.limit < 1 || bs.limit > 100 {
+				err = fmt.Errorf("limit must be a number between 1 and 100, not %v", v)
+				return
+			}
+		case "reposts":
+			bs.includeReposts, err = strconv.ParseBool(v)
+			if err != nil {
+				err = fmt.Errorf("Could not parse reposts value: %v", v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", BlueskyFeedSourceType, k)
+			return
+		}
+	}
+	if bs.handle == "" {
+		err = errors.New("'handle' parameter is not set")
+		return
+	}
+	return bs, nil
+}
+
+func (bs *BlueskyFeedSource) Type() string {
+	return BlueskyFeedSourceType
+}
+
+func (bs *BlueskyFeedSource) Id() string {
+	return IdEncodeStrings(bs.Type(), bs.handle)
+}
+
+func (bs *BlueskyFeedSource) Upstreams() []string {
+	return []string{blueskyAuthorFeedUrl}
+}
+
+// blueskyError is returned for failed xrpc requests
+type blueskyError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *blueskyError) Error() string {
+	return fmt.Sprintf("Bluesky API: %v", e.Message)
+}
+
+func (e *blueskyError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+type blueskyImage struct {
+	Thumb    string `json:"thumb"`
+	Fullsize string `json:"fullsize"`
+	Alt      string `json:"alt"`
+}
+
+type blueskyEmbed struct {
+	Images []blueskyImage `json:"images"`
+	// images of posts quoting other posts
+	Media *struct {
+		Images []blueskyImage `json:"images"`
+	} `json:"media"`
+}
+
+type blueskyAuthorFeedResponse struct {
+	Feed []struct {
+		Post struct {
+			Uri    string `json:"uri"`
+			Author struct {
+				Handle string `json:"handle"`
+			} `json:"author"`
+			Record struct {
+				Text      string    `json:"text"`
+				CreatedAt time.Time `json:"createdAt"`
+			} `json:"record"`
+			Embed *blueskyEmbed `json:"embed"`
+		} `json:"post"`
+		Reason *struct {
+			Type string `json:"$type"`
+		} `json:"reason"`
+	} `json:"feed"`
+	// set for failed requests
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// the first image of an embed
+func (e *blueskyEmbed) image() *blueskyImage {
+	if e == nil {
+		return nil
+	}
+	images := e.Images
+	if len(images) == 0 && e.Media != nil {
+		images = e.Media.Images
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	return &images[0]
+}
+
+// web url of a post. The uri of a post has the
+// form at://<did>/app.bsky.feed.post/<rkey>
+func blueskyPostUrl(handle string, uri string) string {
+	rkey := uri[strings.LastIndex(uri, "/")+1:]
+	return fmt.Sprintf("https://bsky.app/profile/%v/post/%v", handle, rkey)
+}
+
+func (bs *BlueskyFeedSource) GetBlocks() (blocks []*Block, err error) {
+	query := url.Values{}
+	query.Set("actor", bs.handle)
+	query.Set("limit", strconv.Itoa(bs.limit))
+	query.Set("filter", "posts_no_replies")
+
+	resp, err := http.Get(blueskyAuthorFeedUrl + "?" + query.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var feedResp blueskyAuthorFeedResponse
+	err = json.NewDecoder(resp.Body).Decode(&feedResp)
+	if resp.StatusCode != http.StatusOK {
+		message := resp.Status
+		if err == nil && feedResp.Message != "" {
+			message = feedResp.Message
+		}
+		return nil, &blueskyError{StatusCode: resp.StatusCode, Message: message}
+	}
+	if err != nil {
+		return
+	}
+
+	for _, item := range feedResp.Feed {
+		if item.Reason != nil && item.Reason.Type == blueskyRepostReason && !bs.includeReposts {
+			continue
+		}
+		post := item.Post
+
+		block := NewBlock(bs)
+		block.Content = post.Record.Text
+		block.Link = blueskyPostUrl(post.Author.Handle, post.Uri)
+		block.TimeStamp = post.Record.CreatedAt.UTC()
+		block.Title = Summarize(strings.SplitN(post.Record.Text, "\n", 2)[0], blueskyTitleLength)
+		if image := post.Embed.image(); image != nil {
+			block.ImageLink = image.Fullsize
+			if image.Alt != "" {
+				block.Title = Summarize(image.Alt, blueskyTitleLength)
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
@@ -3,12 +3,45 @@ package honeybee
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/sha1"
 	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
 	"github.com/peterbourgon/diskv"
 	"hash/crc32"
 	"io"
+	"log"
+	"sync"
+	"time"
 )
 
+const (
+	MemoryCacheBackend = "memory"
+	DiskCacheBackend   = "disk"
+	RedisCacheBackend  = "redis"
+)
+
+var errCacheMiss = errors.New("Cache miss")
+
+// number of entries evicted from the caches, keyed by backend. Entries
+// removed by the garbage collection are counted as "unused"
+var cacheEvictionsVar = expvar.NewMap("honeybee_cache_evictions")
+
+// number of disk caches keeping their entries in memory because
+// the disk is not writable
+var cacheDegradedVar = expvar.NewInt("honeybee_cache_degraded")
+
+// interval in which a degraded disk cache tries to write to the disk again
+const diskCacheRetryInterval = time.Minute
+
+// size of the memory cache taking the entries of a degraded disk cache
+const defaultFallbackCacheSize = 64 * 1024 * 1024
+
+// every entry written to the disk cache starts with a header line containing
+// this marker and the sha1 checksum of the payload
+const cacheEntryMarker = "HBC1 "
+
 type Cache interface {
 	Get(string) ([]byte, bool)
 	Set(string, []byte)
@@ -17,6 +50,23 @@ type Cache interface {
 	DeleteAll()
 }
 
+// MigratableCache is implemented by caches which are able to enumerate their
+// raw entries. Storage keys and the format of the entries are the same for all
+// backends, so entries can be copied between backends without decoding them.
+type MigratableCache interface {
+	Cache
+	StorageKeys() <-chan string
+	ReadEntry(storageKey string) ([]byte, error)
+	WriteEntry(storageKey string, entry []byte) error
+	DeleteEntry(storageKey string)
+}
+
+// DegradableCache is implemented by caches which fall back to a less
+// durable storage when theirs fails
+type DegradableCache interface {
+	Degraded() bool
+}
+
 // ForgettingCache is an implementation of httpcache.Cache that supplements the in-memory map with persistent storage
 type ForgettingCache struct {
 	d *diskv.Diskv
@@ -28,28 +78,130 @@ type ForgettingCache struct {
 	// counter to step through the subsets of the cache contents
 	// to delete
 	forgetCounter int
+
+	// entries are kept in the fallback while writing to the disk
+	// fails, f.e. when the disk is full or the permissions are wrong
+	fallbackSize     int
+	fallbackMtx      *sync.Mutex
+	fallback         *MemoryCache
+	lastWriteFailure time.Time
 }
 
 // Get returns the response corresponding to key if present
 func (c *ForgettingCache) Get(key string) (resp []byte, ok bool) {
 	key = keyToFilename(key)
-	resp, err := c.d.Read(key)
+	if fallback, _ := c.currentFallback(false); fallback != nil {
+		// the fallback holds the more recent entries
+		if resp, err := fallback.ReadEntry(key); err == nil {
+			return resp, true
+		}
+	}
+	entry, err := c.d.Read(key)
 	if err != nil {
 		return []byte{}, false
 	}
+	resp, err = decodeCacheEntry(entry)
+	if err != nil {
+		// corrupt or partially written entry, f.e. after a crash
+		log.Printf("Evicting cache entry %s: %v", key, err)
+		c.d.Erase(key)
+		return []byte{}, false
+	}
 	return resp, true
 }
 
 // Set saves a response to the cache as key
 func (c *ForgettingCache) Set(key string, resp []byte) {
 	key = keyToFilename(key)
-	c.d.WriteStream(key, bytes.NewReader(resp), true)
+	entry := encodeCacheEntry(resp)
+	fallback, tryDisk := c.currentFallback(true)
+	if tryDisk {
+		err := c.d.WriteStream(key, bytes.NewReader(entry), true)
+		if err == nil {
+			if fallback != nil {
+				c.leaveFallback()
+			}
+			return
+		}
+		fallback = c.enterFallback(err)
+	}
+	// the memory cache stores the entries without checksum
+	fallback.WriteEntry(key, resp)
+}
+
+// the fallback cache when the disk is not writable, nil otherwise.
+// While degraded, the disk should only be tried once per retry interval.
+func (c *ForgettingCache) currentFallback(writing bool) (fallback *MemoryCache, tryDisk bool) {
+	c.fallbackMtx.Lock()
+	defer c.fallbackMtx.Unlock()
+	if c.fallback == nil {
+		return nil, true
+	}
+	if writing && time.Since(c.lastWriteFailure) >= diskCacheRetryInterval {
+		// keep other writers away from the disk until this one has succeeded
+		c.lastWriteFailure = time.Now()
+		return c.fallback, true
+	}
+	return c.fallback, false
+}
+
+// keep the entries in memory after writing to the disk failed
+func (c *ForgettingCache) enterFallback(err error) *MemoryCache {
+	c.fallbackMtx.Lock()
+	defer c.fallbackMtx.Unlock()
+	c.lastWriteFailure = time.Now()
+	if c.fallback == nil {
+		log.Printf("Could not write to the disk cache, keeping entries in memory until it is writable again: %v", err)
+		c.fallback = NewMemoryCache(c.fallbackSize)
+		cacheDegradedVar.Add(1)
+	}
+	return c.fallback
+}
+
+// move the entries kept in memory to the disk after it
+// became writable again
+func (c *ForgettingCache) leaveFallback() {
+	c.fallbackMtx.Lock()
+	fallback := c.fallback
+	c.fallback = nil
+	c.fallbackMtx.Unlock()
+	if fallback == nil {
+		// another writer has been faster
+		return
+	}
+	log.Printf("The disk cache is writable again")
+	cacheDegradedVar.Add(-1)
+
+	for storageKey := range fallback.StorageKeys() {
+		// entries written since then are more recent
+		if c.d.Has(storageKey) {
+			continue
+		}
+		resp, err := fallback.ReadEntry(storageKey)
+		if err != nil {
+			continue
+		}
+		err = c.d.WriteStream(storageKey, bytes.NewReader(encodeCacheEntry(resp)), true)
+		if err != nil {
+			c.enterFallback(err).WriteEntry(storageKey, resp)
+			return
+		}
+	}
+}
+
+// the entries are kept in memory because the disk is not writable
+func (c *ForgettingCache) Degraded() bool {
+	fallback, _ := c.currentFallback(false)
+	return fallback != nil
 }
 
 // Delete removes the response with key from the cache
 func (c *ForgettingCache) Delete(key string) {
 	key = keyToFilename(key)
 	c.d.Erase(key)
+	if fallback, _ := c.currentFallback(false); fallback != nil {
+		fallback.DeleteEntry(key)
+	}
 }
 
 // Drop a few entries from the cache, calling this function
@@ -62,9 +214,9 @@ func (c *ForgettingCache) DeleteSome() {
 	}
 
 	for key := range c.d.Keys(nil) {
-		hashCRC32 := int(crc32.ChecksumIEEE([]byte(key)))
-		if (hashCRC32 % modValue) == c.forgetCounter {
+		if shouldForget(key, modValue, c.forgetCounter) {
 			c.d.Erase(key)
+			cacheEvictionsVar.Add(DiskCacheBackend, 1)
 		}
 	}
 
@@ -77,6 +229,54 @@ func (c *ForgettingCache) DeleteSome() {
 // delete the complete contents of the cache
 func (c *ForgettingCache) DeleteAll() {
 	c.d.EraseAll()
+	if fallback, _ := c.currentFallback(false); fallback != nil {
+		fallback.DeleteAll()
+	}
+}
+
+func (c *ForgettingCache) StorageKeys() <-chan string {
+	return c.d.Keys(nil)
+}
+
+func (c *ForgettingCache) ReadEntry(storageKey string) ([]byte, error) {
+	return c.d.Read(storageKey)
+}
+
+func (c *ForgettingCache) WriteEntry(storageKey string, entry []byte) error {
+	return c.d.WriteStream(storageKey, bytes.NewReader(entry), true)
+}
+
+func (c *ForgettingCache) DeleteEntry(storageKey string) {
+	c.d.Erase(storageKey)
+}
+
+// prefix the data with a header line containing its checksum
+func encodeCacheEntry(data []byte) []byte {
+	sum := sha1.Sum(data)
+	buf := new(bytes.Buffer)
+	buf.Grow(len(cacheEntryMarker) + hex.EncodedLen(len(sum)) + 1 + len(data))
+	buf.WriteString(cacheEntryMarker)
+	buf.WriteString(hex.EncodeToString(sum[:]))
+	buf.WriteByte('\n')
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// split the header line from an entry and verify the checksum of the payload.
+// Fails with an error wrapping ErrCacheCorrupt.
+func decodeCacheEntry(entry []byte) (data []byte, err error) {
+	headerLen := len(cacheEntryMarker) + hex.EncodedLen(sha1.Size) + 1
+	if len(entry) < headerLen || !bytes.HasPrefix(entry, []byte(cacheEntryMarker)) {
+		return nil, fmt.Errorf("%w: missing header", ErrCacheCorrupt)
+	}
+	if entry[headerLen-1] != '\n' {
+		return nil, fmt.Errorf("%w: malformed header", ErrCacheCorrupt)
+	}
+	sum := sha1.Sum(entry[headerLen:])
+	if string(entry[len(cacheEntryMarker):headerLen-1]) != hex.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCacheCorrupt)
+	}
+	return entry[headerLen:], nil
 }
 
 func keyToFilename(key string) string {
@@ -85,6 +285,13 @@ func keyToFilename(key string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// shouldForget decides if a storage key belongs to the subset of keys
+// selected by the counter of the forgetting caches
+func shouldForget(storageKey string, modValue int, forgetCounter int) bool {
+	hashCRC32 := int(crc32.ChecksumIEEE([]byte(storageKey)))
+	return (hashCRC32 % modValue) == forgetCounter
+}
+
 // NewWithDiskv returns a new Cache using the provided Diskv as underlying
 // storage.
 // forgetPercent: how many percent of the keys should be "forgotten" during on
@@ -94,5 +301,108 @@ func NewForgettingCache(d *diskv.Diskv, forgetPercent int) *ForgettingCache {
 		d:             d,
 		forgetPercent: forgetPercent,
 		forgetCounter: 0,
+		fallbackSize:  defaultFallbackCacheSize,
+		fallbackMtx:   new(sync.Mutex),
+	}
+}
+
+// create a nested path for a cache key to avoid many
+// inodes in one directory
+func cacheTransformKeyToPath(s string) (parts []string) {
+	partLen := 2
+	depth := 3
+	sLen := len(s)
+	for i := 0; i < depth; i++ {
+		if (partLen * (i + 1)) > sLen {
+			parts = append(parts, "_")
+			break
+		}
+		parts = append(parts, s[partLen*i:partLen*(i+1)])
+	}
+	return
+}
+
+// create a disk based cache in the given directory
+func NewDiskCache(directory string) (cache *ForgettingCache, err error) {
+	err = EnsureDirectoryExists(directory)
+	if err != nil {
+		return
+	}
+	cache = NewForgettingCache(
+		diskv.New(diskv.Options{
+			BasePath:     directory,
+			CacheSizeMax: 0,
+			Transform:    cacheTransformKeyToPath,
+		}), 10)
+	return
+}
+
+// create the cache for a backend name using the cache configuration
+func CreateCache(backend string, config *CacheConfiguration) (MigratableCache, error) {
+	switch backend {
+	case MemoryCacheBackend:
+		return NewMemoryCache(config.Memory.Size * 1024 * 1024), nil
+	case DiskCacheBackend:
+		cache, err := NewDiskCache(config.Directory)
+		if err != nil {
+			return nil, err
+		}
+		// the size of the memory cache also limits the fallback
+		cache.fallbackSize = config.Memory.Size * 1024 * 1024
+		return cache, nil
+	case RedisCacheBackend:
+		return NewRedisCache(&config.Redis)
+	}
+	return nil, fmt.Errorf("Unknown cache backend: %v", backend)
+}
+
+// create the cache described by the configuration. When tiers
+// are configured, the backends will be layered in the given order.
+func CreateConfiguredCache(config *CacheConfiguration) (Cache, error) {
+	if len(config.Tiers) == 0 {
+		return CreateCache(config.Backend, config)
+	}
+	var tiers []Cache
+	for _, backend := range config.Tiers {
+		tier, err := CreateCache(backend, config)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+	return NewTieredCache(tiers...), nil
+}
+
+// copy all entries from one cache to another one. Entries written
+// by older versions without a checksum get upgraded to the current format,
+// entries which can not be read are skipped.
+// Migrating a cache into itself upgrades the entries in place.
+func MigrateCache(from MigratableCache, to MigratableCache) (migrated int, upgraded int, skipped int, err error) {
+	for storageKey := range from.StorageKeys() {
+		entry, readErr := from.ReadEntry(storageKey)
+		if readErr != nil {
+			log.Printf("Could not read cache entry %s: %v", storageKey, readErr)
+			skipped++
+			continue
+		}
+		if _, decodeErr := decodeCacheEntry(entry); decodeErr != nil {
+			if !bytes.HasPrefix(entry, []byte("HTTP/")) {
+				log.Printf("Skipping unreadable cache entry %s", storageKey)
+				skipped++
+				continue
+			}
+			// cached http response without checksum header
+			entry = encodeCacheEntry(entry)
+			upgraded++
+		} else if from == to {
+			// nothing to do for in-place upgrades
+			continue
+		}
+		err = to.WriteEntry(storageKey, entry)
+		if err != nil {
+			return
+		}
+		migrated++
 	}
+	return
 }
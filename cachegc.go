@@ -0,0 +1,72 @@
+package honeybee
+
+import (
+	"time"
+)
+
+// CacheCollector removes cache entries which are not used by any block
+// anymore. Entries are kept for a grace period after they have been
+// found unused, so blocks disappearing only briefly keep their images.
+type CacheCollector struct {
+	gracePeriod time.Duration
+	// storage keys of unused entries and the time they were first found unused
+	unusedSince map[string]time.Time
+}
+
+func NewCacheCollector(gracePeriod time.Duration) *CacheCollector {
+	return &CacheCollector{
+		gracePeriod: gracePeriod,
+		unusedSince: make(map[string]time.Time),
+	}
+}
+
+// delete the entries of the cache whose keys are not in liveKeys
+// and which have been unused for longer than the grace period. Only
+// caches able to enumerate their entries are collected.
+func (cc *CacheCollector) Collect(cache Cache, liveKeys []string) (deleted int) {
+	live := make(map[string]bool)
+	for _, key := range liveKeys {
+		live[keyToFilename(key)] = true
+	}
+
+	var caches []MigratableCache
+	switch c := cache.(type) {
+	case *TieredCache:
+		for _, tier := range c.tiers {
+			if mc, ok := tier.(MigratableCache); ok {
+				caches = append(caches, mc)
+			}
+		}
+	case MigratableCache:
+		caches = append(caches, c)
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, mc := range caches {
+		for storageKey := range mc.StorageKeys() {
+			if live[storageKey] {
+				continue
+			}
+			seen[storageKey] = true
+			since, found := cc.unusedSince[storageKey]
+			if !found {
+				cc.unusedSince[storageKey] = now
+				continue
+			}
+			if now.Sub(since) > cc.gracePeriod {
+				mc.DeleteEntry(storageKey)
+				deleted++
+			}
+		}
+	}
+	cacheEvictionsVar.Add("unused", int64(deleted))
+
+	// forget entries which are used again or are gone
+	for storageKey := range cc.unusedSince {
+		if !seen[storageKey] {
+			delete(cc.unusedSince, storageKey)
+		}
+	}
+	return
+}
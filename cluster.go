@@ -0,0 +1,93 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"os"
+	"time"
+)
+
+const (
+	clusterUpdateLockKey = "honeybee:update-lock"
+	clusterBlocksKey     = "honeybee:blocks"
+)
+
+// Cluster coordinates multiple instances sharing a redis server. Only
+// the instance holding the update lock pulls the sources and publishes
+// the blocks, all other instances load the published blocks.
+type Cluster struct {
+	pool       *redis.Pool
+	instanceId string
+}
+
+func NewCluster(config *RedisConfiguration) (c *Cluster, err error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return
+	}
+	c = &Cluster{
+		pool:       newRedisPool(config),
+		instanceId: fmt.Sprintf("%v:%d", hostname, os.Getpid()),
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("PING")
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// try to get the lock for pulling the sources. The lock is not released,
+// it expires after ttl to allow one update per interval.
+func (c *Cluster) AcquireUpdateLock(ttl time.Duration) (bool, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+	_, err := redis.String(conn.Do("SET", clusterUpdateLockKey, c.instanceId,
+		"NX", "PX", int64(ttl/time.Millisecond)))
+	if err == redis.ErrNil {
+		// lock is held by another instance
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// make the blocks available to the other instances
+func (c *Cluster) PublishBlocks(blocks []*Block) error {
+	records := make([]BlockRecord, len(blocks))
+	for i, block := range blocks {
+		records[i] = block.Record()
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("SET", clusterBlocksKey, data)
+	return err
+}
+
+// load the blocks published by the instance holding the update lock
+func (c *Cluster) FetchBlocks(sources Sources) (blocks []*Block, err error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("GET", clusterBlocksKey))
+	if err == redis.ErrNil {
+		// nothing published yet
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	var records []BlockRecord
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return
+	}
+	return BlocksFromRecords(records, sources), nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	_ "expvar"
 	"flag"
 	"fmt"
@@ -8,6 +9,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var expvarPort int = 0
@@ -15,10 +21,31 @@ var dropCache bool = false
 var noServe bool = false
 var httpPort int = 0
 var cacheDirectory string = ""
+var verbose bool = false
+var quiet bool = false
+var watchConfig bool = false
+var readOnly bool = false
+var recordUpstreams string = ""
+var replayUpstreams string = ""
 
 func init() {
 	flag.Usage = func() {
 		fmt.Printf("Usage: honeybee [OPTIONS] [CONFIGURATION DIRECTORY]\n")
+		if defaultDir := honeybee.DefaultConfigDirectory(); defaultDir != "" {
+			fmt.Printf("       (the configuration directory defaults to %v)\n", defaultDir)
+		}
+		fmt.Printf("       (the configuration may be passed in the %v environment variable instead)\n", honeybee.ConfigurationEnvVar)
+		fmt.Printf("       honeybee [OPTIONS] demo\n")
+		fmt.Printf("       honeybee [OPTIONS] cache migrate [MIGRATE OPTIONS] [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] export-blocks [EXPORT OPTIONS] [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] import-blocks [EXPORT FILE] [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] backup [BACKUP OPTIONS] [TAR.GZ FILE] [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] restore [RESTORE OPTIONS] [TAR.GZ FILE] [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] flickr-auth [API KEY] [API SECRET]\n")
+		fmt.Printf("       honeybee [OPTIONS] render [RENDER OPTIONS] [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] selftest [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] bench [BENCH OPTIONS] [CONFIGURATION DIRECTORY]\n")
+		fmt.Printf("       honeybee [OPTIONS] thumbnails [THUMBNAIL OPTIONS] [CONFIGURATION DIRECTORY]\n")
 		fmt.Printf("\nOptions:\n")
 		flag.PrintDefaults()
 	}
@@ -28,25 +55,20 @@ func init() {
 	flag.BoolVar(&noServe, "no-serve", false, "Do not run the server")
 	flag.IntVar(&httpPort, "http_port", 0, "Port to listen on. This will override the port specified in the configuration file.")
 	flag.StringVar(&cacheDirectory, "cache_directory", "", "Drectory to use as cache. This will override the port specified in the configuration file.")
+	flag.BoolVar(&verbose, "v", false, "Verbose logging. Logs the cache decisions of the image proxy. Overrides the log level from the configuration file.")
+	flag.BoolVar(&watchConfig, "watch", false, "Reload the configuration and the templates when files in the configuration directory change. Sending SIGHUP reloads them as well.")
+	flag.BoolVar(&readOnly, "read-only", false, "Serve the persisted blocks and cached images without contacting any upstream server. Sources are not pulled.")
+	flag.StringVar(&recordUpstreams, "record-upstreams", "", "Record the responses of all upstream servers into this directory.")
+	flag.StringVar(&replayUpstreams, "replay-upstreams", "", "Replay the responses recorded with -record-upstreams from this directory instead of contacting the upstream servers.")
+	flag.BoolVar(&quiet, "q", false, "Quiet logging. Suppresses messages about single image requests. Overrides the log level from the configuration file.")
 	flag.Parse()
 
 	// standard go logging
 	log.SetOutput(os.Stderr)
 }
 
-func run(configDir string) (err error) {
-	if expvarPort != 0 {
-		go func() {
-			log.Printf("Serving expvar statistics on port %d\n", expvarPort)
-			experr := http.ListenAndServe(fmt.Sprintf(":%d", expvarPort), nil)
-			if experr != nil {
-				log.Printf("Could not serve expvar stats on port %d: %v\n", expvarPort, experr)
-				os.Exit(1)
-			}
-		}()
-	}
-
-	var config honeybee.Configuration
+// read the configuration and apply the overrides from the command line
+func readConfiguration(configDir string) (config honeybee.Configuration, err error) {
 	config, err = honeybee.ReadConfiguration(configDir)
 	if err != nil {
 		log.Printf("Could not read config file: %v\n", err)
@@ -59,9 +81,433 @@ func run(configDir string) (err error) {
 	if cacheDirectory != "" {
 		config.Cache.Directory = cacheDirectory
 	}
+	config.ReadOnly = readOnly
+	applyLogLevelFlags(&config)
+	return
+}
+
+// directory used when none is given on the command line. A configuration
+// from the environment is complete without a directory.
+func defaultConfigDirectory() string {
+	if os.Getenv(honeybee.ConfigurationEnvVar) != "" {
+		return ""
+	}
+	return honeybee.DefaultConfigDirectory()
+}
+
+func applyLogLevelFlags(config *honeybee.Configuration) {
+	if verbose {
+		config.Logging.Level = "debug"
+	} else if quiet {
+		config.Logging.Level = "quiet"
+	}
+}
+
+// copy the contents of one cache backend to another one
+func runCacheMigrate(args []string) (err error) {
+	fs := flag.NewFlagSet("cache migrate", flag.ExitOnError)
+	from := fs.String("from", honeybee.DiskCacheBackend, "Backend to read the cache entries from.")
+	to := fs.String("to", honeybee.DiskCacheBackend, "Backend to write the cache entries to. Using the same backend as for -from upgrades the entries to the current format.")
+	fromDirectory := fs.String("from-directory", "", "Directory of the disk cache to read from. Defaults to the configured directory.")
+	toDirectory := fs.String("to-directory", "", "Directory of the disk cache to write to. Defaults to the configured directory.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("Need exactly one argument specifying the configuration directory to use.")
+	}
+
+	config, err := readConfiguration(fs.Arg(0))
+	if err != nil {
+		return
+	}
+
+	fromConfig := config.Cache
+	if *fromDirectory != "" {
+		fromConfig.Directory = *fromDirectory
+	}
+	toConfig := config.Cache
+	if *toDirectory != "" {
+		toConfig.Directory = *toDirectory
+	}
+
+	fromCache, err := honeybee.CreateCache(*from, &fromConfig)
+	if err != nil {
+		return
+	}
+	toCache := fromCache
+	if *from != *to || fromConfig.Directory != toConfig.Directory {
+		toCache, err = honeybee.CreateCache(*to, &toConfig)
+		if err != nil {
+			return
+		}
+	}
+
+	log.Printf("Migrating cache from %v to %v ...", *from, *to)
+	migrated, upgraded, skipped, err := honeybee.MigrateCache(fromCache, toCache)
+	if err != nil {
+		return
+	}
+	log.Printf("Migrated %d entries (%d upgraded), skipped %d entries.", migrated, upgraded, skipped)
+	return nil
+}
+
+// dispatch the subcommands of "honeybee cache"
+func runCacheCommand(args []string) error {
+	if len(args) > 0 && args[0] == "migrate" {
+		return runCacheMigrate(args[1:])
+	}
+	return errors.New("Unknown cache command. Available commands: migrate")
+}
+
+// write the current blocks to a file or stdout
+func runExportBlocks(args []string) (err error) {
+	fs := flag.NewFlagSet("export-blocks", flag.ExitOnError)
+	format := fs.String("format", honeybee.JsonExportFormat, "Format to export the blocks in: json, csv or yaml.")
+	pull := fs.Bool("pull", false, "Always pull the sources instead of using the blocks shared by a running cluster.")
+	out := fs.String("out", "", "File to write to. Defaults to stdout.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("Need exactly one argument specifying the configuration directory to use.")
+	}
+
+	config, err := readConfiguration(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	srv, err := honeybee.NewServer(&config)
+	if err != nil {
+		return
+	}
+	if !*pull {
+		err = srv.LoadSharedBlocks()
+		if err != nil {
+			return
+		}
+	}
+	if *pull || len(srv.Blocks()) == 0 {
+		log.Printf("Pulling sources ...")
+		err = srv.PullSources()
+		if err != nil {
+			return
+		}
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			return
+		}
+		defer w.Close()
+	}
+	return honeybee.ExportBlocks(w, srv.Blocks(), *format)
+}
+
+// merge an export file into the persisted blocks
+func runImportBlocks(args []string) (err error) {
+	fs := flag.NewFlagSet("import-blocks", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("Need exactly two arguments specifying the file to import and the configuration directory to use.")
+	}
+
+	config, err := readConfiguration(fs.Arg(1))
+	if err != nil {
+		return
+	}
+	if config.Store.File == "" {
+		return errors.New("No store file configured to import the blocks into.")
+	}
+	records, err := honeybee.LoadBlockRecords(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	err = honeybee.ImportIntoStore(config.Store.File, records)
+	if err != nil {
+		return
+	}
+	log.Printf("Imported %d blocks into %v.", len(records), config.Store.File)
+	return nil
+}
+
+// write a backup archive of an instance
+func runBackup(args []string) (err error) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	withCache := fs.Bool("with-cache", false, "Include the contents of the cache.")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("Need exactly two arguments specifying the archive to write and the configuration directory to use.")
+	}
+
+	config, err := readConfiguration(fs.Arg(1))
+	if err != nil {
+		return
+	}
+	f, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	err = honeybee.Backup(f, &config, *withCache)
+	if err != nil {
+		return
+	}
+	log.Printf("Wrote backup to %v.", fs.Arg(0))
+	return nil
+}
+
+// restore a backup archive
+func runRestore(args []string) (err error) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreConfig := fs.Bool("config", false, "Also restore the configuration file. This overwrites the existing config.yml.")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("Need exactly two arguments specifying the archive to restore and the configuration directory to use.")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	err = honeybee.Restore(f, fs.Arg(1), *restoreConfig, func() (honeybee.Configuration, error) {
+		return readConfiguration(fs.Arg(1))
+	})
+	if err != nil {
+		return
+	}
+	log.Printf("Restored backup from %v.", fs.Arg(0))
+	return nil
+}
+
+// render the index page to a file, f.e. to compare the output
+// of themes against a known good version
+func runRender(args []string) (err error) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fixtures := fs.Bool("fixtures", false, "Render generated fixture blocks instead of the blocks of the store file.")
+	out := fs.String("out", "", "File to write the page to. Defaults to stdout.")
+	fs.Parse(args)
+
+	configDir := defaultConfigDirectory()
+	if fs.NArg() > 0 {
+		configDir = fs.Arg(0)
+	}
+	config, err := readConfiguration(configDir)
+	if err != nil {
+		return
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			return
+		}
+		defer w.Close()
+	}
+	return honeybee.Render(w, &config, *fixtures, honeybee.FixtureTime)
+}
+
+// check if the site is ready to be served and print a report
+func runSelfTest(args []string) (err error) {
+	configDir := defaultConfigDirectory()
+	if len(args) > 0 {
+		configDir = args[0]
+	}
+	config, err := readConfiguration(configDir)
+	if err != nil {
+		return
+	}
+	report := honeybee.SelfTest(&config)
+	report.Write(os.Stdout)
+	if !report.Ready() {
+		return errors.New("Self test failed")
+	}
+	return nil
+}
+
+// measure the performance of the site and print a report
+func runBench(args []string) (err error) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	duration := fs.Duration("duration", 5*time.Second, "Time each benchmark runs for.")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Number of concurrent operations of each benchmark.")
+	fs.Parse(args)
+
+	configDir := defaultConfigDirectory()
+	if fs.NArg() > 0 {
+		configDir = fs.Arg(0)
+	}
+	config, err := readConfiguration(configDir)
+	if err != nil {
+		return
+	}
+	report, err := honeybee.Bench(&config, honeybee.BenchOptions{
+		Duration:    *duration,
+		Concurrency: *concurrency,
+	})
+	if err != nil {
+		return
+	}
+	report.Write(os.Stdout)
+	return nil
+}
+
+// transform the images of the stored blocks into multiple sizes
+func runThumbnails(args []string) (err error) {
+	fs := flag.NewFlagSet("thumbnails", flag.ExitOnError)
+	sizes := fs.String("sizes", "", "Comma separated widths of the thumbnails, f.e. 320,640,1280. Defaults to the configured maxwidth.")
+	out := fs.String("out", "", "Also write the thumbnails to <width>/<block id>.<format> files in this directory.")
+	fs.Parse(args)
+
+	configDir := defaultConfigDirectory()
+	if fs.NArg() > 0 {
+		configDir = fs.Arg(0)
+	}
+	config, err := readConfiguration(configDir)
+	if err != nil {
+		return
+	}
+	options := honeybee.ThumbnailOptions{Directory: *out}
+	if *sizes != "" {
+		options.Sizes, err = honeybee.ParseThumbnailSizes(*sizes)
+		if err != nil {
+			return
+		}
+	}
+	failed, err := honeybee.GenerateThumbnails(&config, options)
+	if err != nil {
+		return
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d thumbnails could not be generated", failed)
+	}
+	return nil
+}
+
+// get an oauth token to access non-public flickr photos
+func runFlickrAuth(args []string) (err error) {
+	if len(args) != 2 {
+		return errors.New("Need exactly two arguments specifying the key and the secret of the flickr api.")
+	}
+	flickrOAuth := &honeybee.FlickrOAuth{
+		Key:    args[0],
+		Secret: args[1],
+	}
+	authorizeUrl, err := flickrOAuth.AuthorizeUrl()
+	if err != nil {
+		return
+	}
+	fmt.Printf("Open the following url to authorize honeybee:\n\n    %v\n\n", authorizeUrl)
+	fmt.Printf("Enter the code displayed by flickr: ")
+	var verifier string
+	_, err = fmt.Scanln(&verifier)
+	if err != nil {
+		return
+	}
+	token, tokenSecret, err := flickrOAuth.AccessToken(verifier)
+	if err != nil {
+		return
+	}
+	fmt.Printf("\nAdd these parameters to the flickr sources:\n\n")
+	fmt.Printf("    key: %v\n    secret: %v\n    token: %v\n    token-secret: %v\n",
+		args[0], args[1], token, tokenSecret)
+	return nil
+}
+
+// run a demo site using the configuration embedded in the executable
+func runDemo(args []string) (err error) {
+	if len(args) != 0 {
+		return errors.New("The demo command does not take any arguments.")
+	}
+	config, err := honeybee.ReadDemoConfiguration()
+	if err != nil {
+		return
+	}
+	if httpPort > 0 {
+		config.Http.Port = httpPort
+	}
+	if cacheDirectory != "" {
+		config.Cache.Directory = cacheDirectory
+	}
+	applyLogLevelFlags(&config)
+	// the demo images are served by the site itself
+	for i := range config.Sources {
+		if config.Sources[i].Type == honeybee.DemoSourceType {
+			config.Sources[i].Params = honeybee.SourceParams{
+				"images": fmt.Sprintf("http://localhost:%d/static/demo/", config.Http.Port),
+			}
+		}
+	}
+	log.Printf("Starting demo site on http://localhost:%d/", config.Http.Port)
+	return serve(&config, nil)
+}
+
+func run(configDir string) (err error) {
+	var config honeybee.Configuration
+	config, err = readConfiguration(configDir)
+	if err != nil {
+		return
+	}
+	return serve(&config, func() (*honeybee.Configuration, error) {
+		config, err := readConfiguration(configDir)
+		return &config, err
+	})
+}
+
+// reload the configuration of the server on SIGHUP and, when enabled,
+// on changes of the files of the configuration directory
+func handleReloads(srv *honeybee.Server, config *honeybee.Configuration, reread func() (*honeybee.Configuration, error)) error {
+	// signals and file changes may trigger reloads at the same time
+	reloadMtx := new(sync.Mutex)
+	reload := func() {
+		reloadMtx.Lock()
+		defer reloadMtx.Unlock()
+		log.Printf("Reloading the configuration ...")
+		newConfig, err := reread()
+		if err == nil {
+			err = srv.Reload(newConfig)
+		}
+		if err != nil {
+			log.Printf("Could not reload the configuration: %v", err)
+			return
+		}
+		log.Printf("Configuration reloaded.")
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload()
+		}
+	}()
+
+	if watchConfig {
+		return honeybee.WatchConfiguration(config, reload)
+	}
+	return nil
+}
+
+// create the server and start serving. reread reads the configuration
+// again for reloads, reloading is not supported when it is nil.
+func serve(config *honeybee.Configuration, reread func() (*honeybee.Configuration, error)) (err error) {
+	err = honeybee.ConfigureLogging(&config.Logging)
+	if err != nil {
+		return
+	}
+
+	if expvarPort != 0 {
+		go func() {
+			log.Printf("Serving expvar statistics on port %d\n", expvarPort)
+			experr := http.ListenAndServe(fmt.Sprintf(":%d", expvarPort), nil)
+			if experr != nil {
+				log.Printf("Could not serve expvar stats on port %d: %v\n", expvarPort, experr)
+				os.Exit(1)
+			}
+		}()
+	}
 
 	var srv *honeybee.Server
-	srv, err = honeybee.NewServer(&config)
+	srv, err = honeybee.NewServer(config)
 	if err != nil {
 		return
 	}
@@ -72,6 +518,17 @@ func run(configDir string) (err error) {
 		log.Println("Cache dropped.")
 	}
 
+	if config.ReadOnly {
+		log.Printf("Running in read-only mode, upstream servers are not contacted.")
+	}
+
+	if reread != nil {
+		err = handleReloads(srv, config, reread)
+		if err != nil {
+			return
+		}
+	}
+
 	if noServe == false {
 		srv.StartUpdating()
 		err = srv.Serve()
@@ -83,7 +540,62 @@ func run(configDir string) (err error) {
 }
 
 func main() {
+	if recordUpstreams != "" && replayUpstreams != "" {
+		log.Printf("Upstreams can either be recorded or replayed, not both.\n")
+		os.Exit(1)
+	}
+	if recordUpstreams != "" || replayUpstreams != "" {
+		err := honeybee.InstallUpstreamRecorder(recordUpstreams+replayUpstreams, replayUpstreams != "")
+		if err != nil {
+			log.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	args := flag.Args()
+	if len(args) > 0 {
+		var command func([]string) error
+		switch args[0] {
+		case "demo":
+			command = runDemo
+		case "cache":
+			command = runCacheCommand
+		case "export-blocks":
+			command = runExportBlocks
+		case "import-blocks":
+			command = runImportBlocks
+		case "backup":
+			command = runBackup
+		case "restore":
+			command = runRestore
+		case "flickr-auth":
+			command = runFlickrAuth
+		case "render":
+			command = runRender
+		case "selftest":
+			command = runSelfTest
+		case "bench":
+			command = runBench
+		case "thumbnails":
+			command = runThumbnails
+		}
+		if command != nil {
+			err := command(args[1:])
+			if err != nil {
+				log.Printf("%v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if len(args) == 0 {
+		if os.Getenv(honeybee.ConfigurationEnvVar) != "" {
+			args = append(args, "")
+		} else if defaultDir := defaultConfigDirectory(); defaultDir != "" {
+			args = append(args, defaultDir)
+		}
+	}
 	if len(args) != 1 {
 		fmt.Printf("Need exactly one argument specifying the configuration directory to use.\n")
 		os.Exit(1)
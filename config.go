@@ -1,35 +1,174 @@
 package honeybee
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"gopkg.in/yaml.v2"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 )
 
 type SourceConfiguration struct {
+	// name to refer to the source, f.e. from pages
+	Name    string
 	Type    string
 	Params  SourceParams
 	Filters map[string]string
+	// modifiers change the blocks of the source before they are filtered
+	Modifiers map[string]string
+	// rewrite the hosts of image links before the images are fetched,
+	// mapping hosts like "farm1.staticflickr.com" or "*.staticflickr.com"
+	// to another host or to the url of a mirror
+	ImageHosts map[string]string `yaml:"image-hosts"`
+	// format of the content of the blocks: "text", "markdown" or "html".
+	// Markdown and html are sanitized and made available as HtmlContent.
+	// Empty keeps the content as the source provides it
+	Content string
+	// elements kept when sanitizing. Defaults to DefaultSanitizedElements
+	ContentElements []string `yaml:"content-elements"`
+	// link the images at their upstream urls instead of serving them
+	// through honeybee. Defaults to the global proxy-images option
+	ProxyImages *bool `yaml:"proxy-images"`
+	// maximum number of blocks of the source kept. 0 means no limit
+	MaxBlocks int `yaml:"max-blocks"`
+	// disable the source after this number of consecutive
+	// authentication failures. 0 never disables the source
+	MaxAuthFailures int `yaml:"max-auth-failures"`
 }
 
 type HttpConfiguration struct {
 	Port int
+	// url the site is reachable at. Defaults to http://localhost:<port>
+	PublicUrl string `yaml:"public-url"`
+	// answer requests to the pages with 503 and this Retry-After value in
+	// seconds until the first update finished, so crawlers come back
+	// later instead of indexing the empty pages. 0 disables it
+	WarmupRetryAfter int `yaml:"warmup-retry-after"`
+	// number of block images of the index page announced in Link
+	// preload headers. 0 disables them
+	PreloadImages int `yaml:"preload-images"`
+	// also send the preload headers as "103 Early Hints" response
+	// before the page. Some clients and proxies do not support these
+	EarlyHints bool `yaml:"early-hints"`
+	// maximum number of requests handled at the same time. Further
+	// requests are answered with 503, so a small instance does not run
+	// out of memory transforming images. 0 means no limit
+	MaxRequests int `yaml:"max-requests"`
+}
+
+type RedisConfiguration struct {
+	Address  string
+	Password string
+	Database int
+}
+
+type MemoryCacheConfiguration struct {
+	// maximum size in megabytes
+	Size int
 }
 
 type CacheConfiguration struct {
+	// storage backend of the cache: "memory", "disk" or "redis"
+	Backend string
+	// ordered list of backends to layer. Overrides Backend when set
+	Tiers     []string
 	Directory string
+	Redis     RedisConfiguration
+	Memory    MemoryCacheConfiguration
+	// number of seconds after which a cached image is considered stale
+	// and gets refreshed in the background. 0 disables refreshing.
+	MaxAge int `yaml:"max-age"`
+	// number of seconds after which entries of images which are not
+	// used by any block anymore are removed. 0 keeps them.
+	GcGracePeriod int `yaml:"gc-grace-period"`
 }
 
 type ImageConfiguration struct {
 	Maxwidth  int
 	Maxheight int
 	Quality   int
+	// crop images to exactly maxwidth x maxheight instead of
+	// scaling them to fit into these bounds
+	Crop bool
+	// content types of images which are served. Other content
+	// fetched from upstream is refused
+	AllowedTypes []string `yaml:"allowed-types"`
+	// maximum number of redirects followed when fetching images
+	MaxRedirects int `yaml:"max-redirects"`
+	// directories file:// image links of manual sources may point
+	// into. Other local files are refused
+	LocalDirectories []string `yaml:"local-directories"`
+	// format specific settings. The qualities default to Quality
+	Jpeg ImageFormatConfiguration
+	Webp ImageFormatConfiguration
+	Png  PngConfiguration
+	// filters applied to the resized images
+	Sharpen bool
+	Smooth  bool
+	// let an external service resize the images
+	Offload ImageOffloadConfiguration
+	// fetch and transform the images during the updates, so requests
+	// are only served from the cache. Requires the analyze stage
+	TransformOnUpdate bool `yaml:"transform-on-update"`
+}
+
+type ImageOffloadConfiguration struct {
+	// "imageproxy" or "imgproxy". Empty resizes the images in honeybee
+	Service string
+	// url the instance is reachable at
+	Url string
+	// key of the signed urls. Hex encoded for imgproxy, which also
+	// requires the salt. Empty sends unsigned urls
+	Key  string
+	Salt string
+}
+
+type ImageFormatConfiguration struct {
+	Quality int
+}
+
+type PngConfiguration struct {
+	// "default", "none", "speed" or "best"
+	Compression string
+}
+
+// policies for blocks exceeding the maximum number of blocks
+const (
+	DropOldestOverflow = "drop-oldest"
+	ArchiveOverflow    = "archive"
+)
+
+type StoreConfiguration struct {
+	// file to persist the blocks in. The blocks are not persisted
+	// when this is not set
+	File string
+	// maximum number of blocks kept. 0 means no limit
+	MaxBlocks int `yaml:"max-blocks"`
+	// what happens to the oldest blocks exceeding the maximum
+	Overflow string
+	// file the blocks are moved to by the archive policy
+	ArchiveFile string `yaml:"archive-file"`
+}
+
+type ClusterConfiguration struct {
+	// coordinate the updates with other instances using the
+	// redis server from the cache configuration
+	Enabled bool
 }
 
+// environment variable containing the complete configuration as plain
+// or base64 encoded yaml. It takes precedence over the config.yml file.
+const ConfigurationEnvVar = "HONEYBEE_CONFIG"
+
+// name of the theme embedded in the executable
+const BuiltinTheme = "builtin"
+
 type Configuration struct {
 	Sources        []SourceConfiguration
 	Http           HttpConfiguration
@@ -37,56 +176,251 @@ type Configuration struct {
 	Vars           map[string]string
 	MetaTags       map[string]string `yaml:"meta-tags"`
 	Cache          CacheConfiguration
+	Cluster        ClusterConfiguration
+	Store          StoreConfiguration
+	Logging        LoggingConfiguration
+	Micropub       MicropubConfiguration
+	Admin          AdminConfiguration
 	Image          ImageConfiguration
 	UpdateInterval int `yaml:"update-interval"`
+	// timezone to display times in, f.e. "Europe/Berlin"
+	Timezone string
+	// language of the names of months and weekdays
+	Locale string
+	// default go time layout used by the "date" template function
+	DateFormat string `yaml:"date-format"`
+	Summary    SummaryConfiguration
+	// additional pages showing a subset of the blocks
+	Pages []PageConfiguration
+	// stages the blocks of the sources pass before they are stored
+	Pipeline []string
+	// use the templates and static files embedded in the executable
+	// instead of the ones in Directory when set to "builtin"
+	Theme string
+	// syntax of the templates: "go" (default) for text/template or
+	// "pongo2" for Django style templates
+	TemplateEngine string `yaml:"template-engine"`
+	// serve the images of the blocks through honeybee. When false,
+	// templates link the images at their upstream urls. Defaults to true
+	ProxyImages *bool `yaml:"proxy-images"`
+
+	// files of the site (templates and static files). Defaults
+	// to the contents of Directory
+	Files fs.FS `yaml:"-"`
+	// serve the persisted blocks and the cached images without
+	// contacting any upstream server. Set by the -read-only flag
+	ReadOnly bool `yaml:"-"`
+}
+
+// check if the images of the blocks of a source are served through
+// honeybee, or hotlinked
+func (c Configuration) ProxiesImagesOf(sourceconfig SourceConfiguration) bool {
+	if sourceconfig.ProxyImages != nil {
+		return *sourceconfig.ProxyImages
+	}
+	return c.ProxyImages == nil || *c.ProxyImages
 }
 
 func (c Configuration) IndexTemplateName() string {
 	return "index.html"
 }
 
+// template of the pages of single blocks. These pages are optional
+func (c Configuration) PermalinkTemplateName() string {
+	return "permalink.html"
+}
+
+// template of the archive pages of the months. These pages are optional
+func (c Configuration) ArchiveTemplateName() string {
+	return "archive.html"
+}
+
+// public url of the page of a block
+func (c Configuration) PermalinkUrl(blockId string) string {
+	return strings.TrimRight(c.Http.PublicUrl, "/") + "/block/" + blockId
+}
+
+// public url of the share image of a block
+func (c Configuration) ShareImageUrl(blockId string) string {
+	return strings.TrimRight(c.Http.PublicUrl, "/") + "/share/" + blockId
+}
+
+// check if the blocks pass a stage of the pipeline
+func (c Configuration) HasPipelineStage(stage string) bool {
+	for _, s := range c.Pipeline {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
 func (c Configuration) Validate() error {
 	if len(c.Sources) < 1 {
 		return errors.New("At least one source is required")
 	}
 
-	finfo, err := os.Stat(path.Join(c.TemplateDirectory(), c.IndexTemplateName()))
+	if err := validatePipeline(c.Pipeline); err != nil {
+		return err
+	}
+
+	if c.Theme != "" && c.Theme != BuiltinTheme {
+		return fmt.Errorf("Unknown theme: %v", c.Theme)
+	}
+	switch c.TemplateEngine {
+	case "", GoTemplateEngine:
+	case Pongo2TemplateEngine:
+		if c.Theme == BuiltinTheme {
+			return errors.New("The builtin theme requires the go template engine")
+		}
+	default:
+		return fmt.Errorf("Unknown template engine: %v", c.TemplateEngine)
+	}
+
+	for _, quality := range []int{c.Image.Jpeg.Quality, c.Image.Webp.Quality} {
+		if quality < 0 || quality > 100 {
+			return fmt.Errorf("Illegal image quality: %d", quality)
+		}
+	}
+	if _, found := pngCompressionLevels[c.Image.Png.Compression]; !found {
+		return fmt.Errorf("Unknown png compression: %v", c.Image.Png.Compression)
+	}
+	if _, err := newImageOffload(&c.Image); err != nil {
+		return err
+	}
+	if c.Image.TransformOnUpdate && !c.HasPipelineStage(AnalyzeStage) {
+		return errors.New("transform-on-update requires the analyze stage of the pipeline")
+	}
+
+	switch c.Store.Overflow {
+	case DropOldestOverflow:
+	case ArchiveOverflow:
+		if c.Store.ArchiveFile == "" {
+			return errors.New("The archive overflow policy requires an archive-file")
+		}
+	default:
+		return fmt.Errorf("Unknown overflow policy: %v", c.Store.Overflow)
+	}
+
+	finfo, err := fs.Stat(c.SiteFiles(), path.Join("templates", c.IndexTemplateName()))
 	if err == nil {
 		if finfo.IsDir() {
-			return errors.New(fmt.Sprintf("%v should be a file", c.IndexTemplateName()))
+			return fmt.Errorf("%v should be a file", c.IndexTemplateName())
 		}
 	} else {
-		return errors.New(fmt.Sprintf("%v template does not exist", c.IndexTemplateName()))
+		return fmt.Errorf("%v template does not exist", c.IndexTemplateName())
 	}
 	return nil
 }
 
+// the file system containing the templates and static files of the site
+func (c Configuration) SiteFiles() fs.FS {
+	if c.Files != nil {
+		return c.Files
+	}
+	return os.DirFS(c.Directory)
+}
+
 func (c Configuration) StaticFilesDirectory() string {
-	return path.Join(c.Directory, "static")
+	return filepath.Join(c.Directory, "static")
+}
+
+// directory uploaded files are stored in
+func (c Configuration) UploadDirectory() string {
+	return filepath.Join(c.StaticFilesDirectory(), "uploads")
 }
 
 func (c Configuration) TemplateDirectory() string {
-	return path.Join(c.Directory, "templates")
+	return filepath.Join(c.Directory, "templates")
 }
 
+// read the configuration from the environment or the config.yml file in
+// directory. Configurations from the environment use the builtin theme
+// when no directory is given, so no files are needed at all.
 func ReadConfiguration(directory string) (config Configuration, err error) {
-	file, err := ioutil.ReadFile(path.Join(directory, "config.yml"))
+	file, err := readConfigurationFile(directory)
 	if err != nil {
 		return
 	}
+	config, err = ParseConfiguration(file, directory)
+	if err == nil && os.Getenv(ConfigurationEnvVar) != "" && directory == "" && config.Directory == "" && config.Theme == "" {
+		config.Theme = BuiltinTheme
+		config.Files, err = builtinThemeFiles()
+	}
+	return
+}
+
+// the contents of the configuration, taken from the environment
+// or from the config.yml file in directory
+func readConfigurationFile(directory string) ([]byte, error) {
+	if env := os.Getenv(ConfigurationEnvVar); env != "" {
+		return decodeConfigurationEnv(env), nil
+	}
+	return ioutil.ReadFile(filepath.Join(ExpandHome(directory), "config.yml"))
+}
+
+// the configuration from the environment may be base64 encoded to
+// avoid quoting issues. Yaml is never valid base64 as it contains colons.
+func decodeConfigurationEnv(env string) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(env))
+	if err != nil {
+		return []byte(env)
+	}
+	return decoded
+}
+
+// parse the contents of a configuration file. directory is the directory
+// the site files are located in.
+func ParseConfiguration(file []byte, directory string) (config Configuration, err error) {
 	err = yaml.Unmarshal(file, &config)
 	if err != nil {
 		return
 	}
-	config.Directory = ExpandHome(directory)
+	if directory != "" {
+		config.Directory = ExpandHome(directory)
+	}
 
 	// set defaults when options are missing
 	if config.Http.Port < 1 {
 		config.Http.Port = 8007
 	}
+	if config.Admin.User == "" {
+		config.Admin.User = "admin"
+	}
+	if config.Http.PublicUrl == "" {
+		config.Http.PublicUrl = fmt.Sprintf("http://localhost:%d", config.Http.Port)
+	}
+	if config.Cache.Backend == "" {
+		config.Cache.Backend = DiskCacheBackend
+	}
+	if config.Cache.Memory.Size < 1 {
+		config.Cache.Memory.Size = 64
+	}
+	if config.Cache.Redis.Address == "" {
+		config.Cache.Redis.Address = "localhost:6379"
+	}
+	config.Store.File = ExpandHome(config.Store.File)
+	config.Store.ArchiveFile = ExpandHome(config.Store.ArchiveFile)
+	if config.Store.Overflow == "" {
+		config.Store.Overflow = DropOldestOverflow
+	}
+	config.Logging.File = ExpandHome(config.Logging.File)
+	if config.Logging.MaxSize < 1 {
+		config.Logging.MaxSize = 10
+	}
 	config.Cache.Directory = ExpandHome(config.Cache.Directory)
 	if config.Cache.Directory == "" {
-		config.Cache.Directory = path.Join(config.Directory, "cache")
+		config.Cache.Directory = DefaultCacheDirectory()
+	}
+	if config.Cache.Directory == "" {
+		config.Cache.Directory = filepath.Join(config.Directory, "cache")
+	}
+
+	if config.Cache.MaxAge < 0 {
+		config.Cache.MaxAge = 0
+	}
+	if config.Cache.GcGracePeriod < 0 {
+		config.Cache.GcGracePeriod = 0
 	}
 
 	if config.Image.Maxwidth < 1 && config.Image.Maxheight < 1 {
@@ -101,6 +435,43 @@ func ReadConfiguration(directory string) (config Configuration, err error) {
 		config.Image.Quality = defaultImgQuality
 	}
 
+	if config.Image.MaxRedirects < 1 {
+		config.Image.MaxRedirects = 5
+	}
+
+	for i, dir := range config.Image.LocalDirectories {
+		config.Image.LocalDirectories[i] = ExpandHome(dir)
+	}
+	if config.Image.Png.Compression == "" {
+		config.Image.Png.Compression = DefaultPngCompression
+	}
+
+	if len(config.Image.AllowedTypes) == 0 {
+		config.Image.AllowedTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+	}
+
+	if config.Pipeline == nil {
+		config.Pipeline = DefaultPipeline
+	}
+
+	if config.Summary.MaxLength < 1 {
+		config.Summary.MaxLength = 300
+	}
+
+	if config.Timezone == "" {
+		config.Timezone = "UTC"
+	}
+	if config.DateFormat == "" {
+		config.DateFormat = "2 January 2006"
+	}
+
+	if config.Theme == BuiltinTheme {
+		config.Files, err = builtinThemeFiles()
+		if err != nil {
+			return
+		}
+	}
+
 	if config.UpdateInterval < 1 {
 		// disabled per default
 		config.UpdateInterval = 0
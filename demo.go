@@ -0,0 +1,107 @@
+package honeybee
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const DemoSourceType = "demo"
+
+//go:embed demo/config.yml
+//go:embed example-site/templates example-site/static
+var demoFiles embed.FS
+
+// read the configuration of the demo site embedded in the executable
+func ReadDemoConfiguration() (config Configuration, err error) {
+	file, err := demoFiles.ReadFile("demo/config.yml")
+	if err != nil {
+		return
+	}
+	config, err = ParseConfiguration(file, "")
+	if err != nil {
+		return
+	}
+	config.Files, err = builtinThemeFiles()
+	if err != nil {
+		return
+	}
+	config.Cache.Directory = filepath.Join(os.TempDir(), "honeybee-demo-cache")
+	return
+}
+
+// the templates and static files of the example site
+func builtinThemeFiles() (fs.FS, error) {
+	return fs.Sub(demoFiles, "example-site")
+}
+
+// DemoSource provides a fixed set of blocks using the images of the
+// example site, so a site can be shown without any external services
+type DemoSource struct {
+	// url the images of the static/demo directory are served from
+	imageBaseUrl string
+}
+
+func NewDemoSource(params SourceParams) (ds *DemoSource, err error) {
+	imageBaseUrl := "http://localhost:8007/static/demo/"
+	for k, v := range params {
+		switch k {
+		case "images":
+			imageBaseUrl = v
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", DemoSourceType, k)
+			return
+		}
+	}
+	if !strings.HasSuffix(imageBaseUrl, "/") {
+		imageBaseUrl += "/"
+	}
+	ds = &DemoSource{
+		imageBaseUrl: imageBaseUrl,
+	}
+	return ds, nil
+}
+
+func (ds *DemoSource) Type() string {
+	return DemoSourceType
+}
+
+func (ds *DemoSource) Id() string {
+	return IdEncodeStrings(ds.Type(), ds.imageBaseUrl)
+}
+
+var demoBlocks = []struct {
+	title   string
+	image   string
+	content string
+}{
+	{"Sunrise", "1.png", ""},
+	{"honeybee", "", "Aggregates the content of multiple sources and presents it on one page."},
+	{"Deep water", "2.png", ""},
+	{"Blocks", "", "Every item on this page is a block. Blocks are pulled from sources like GitHub or Flickr."},
+	{"Dusk", "3.png", ""},
+	{"Image proxy", "", "Images are resized and cached by honeybee, so the upstream servers are contacted only once."},
+	{"Meadow", "4.png", ""},
+	{"Ember", "5.png", ""},
+	{"Fog", "6.png", ""},
+}
+
+func (ds *DemoSource) GetBlocks() (blocks []*Block, err error) {
+	now := time.Now().UTC().Truncate(time.Hour)
+	for i, db := range demoBlocks {
+		block := NewBlock(ds)
+		block.Title = db.title
+		block.Content = db.content
+		if db.image != "" {
+			block.ImageLink = ds.imageBaseUrl + db.image
+			block.Link = block.ImageLink
+		}
+		block.TimeStamp = now.Add(-time.Duration(i) * 24 * time.Hour)
+		blocks = append(blocks, block)
+	}
+	return
+}
@@ -0,0 +1,25 @@
+package honeybee
+
+import (
+	"errors"
+)
+
+// errors to branch on using errors.Is. Errors returned by the package
+// wrap these, so their messages contain further details.
+var (
+	// the configuration refers to a source type which does not exist
+	ErrUnknownSourceType = errors.New("Unknown source type")
+	// a source was refused by its upstream because of invalid or
+	// missing credentials
+	ErrSourceAuth = errors.New("Authentication failed")
+	// a source was refused by its upstream because of too many requests
+	ErrSourceRateLimit = errors.New("Rate limit exceeded")
+	// an entry of the cache is incomplete or does not match its checksum
+	ErrCacheCorrupt = errors.New("Corrupt cache entry")
+	// the server runs in read-only mode and does not contact upstream servers
+	ErrReadOnly = errors.New("Upstream servers are not contacted in read-only mode")
+	// an image is requested before it has been fetched during an update
+	ErrImageNotCached = errors.New("Image has not been cached yet")
+	// the robots.txt of a site does not allow fetching a page
+	ErrDisallowedByRobots = errors.New("Disallowed by robots.txt")
+)
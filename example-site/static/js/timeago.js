@@ -0,0 +1,46 @@
+// refresh the "3 days ago" texts of the pages, which are rendered after
+// the updates of the blocks. Elements are marked with data-timeago and
+// carry the time in their datetime attribute, like
+// <time datetime="{{ iso8601 .TimeStamp }}" data-timeago>{{ timeago .TimeStamp }}</time>
+(function () {
+    var minute = 60 * 1000, hour = 60 * minute, day = 24 * hour;
+
+    function plural(n, unit) {
+        return n === 1 ? "1 " + unit + " ago" : n + " " + unit + "s ago";
+    }
+
+    // same wording as the timeago template function
+    function timeAgo(t, now) {
+        var d = now - t;
+        if (d < minute) {
+            return "just now";
+        }
+        if (d < hour) {
+            return plural(Math.floor(d / minute), "minute");
+        }
+        if (d < day) {
+            return plural(Math.floor(d / hour), "hour");
+        }
+        if (d < 30 * day) {
+            return plural(Math.floor(d / day), "day");
+        }
+        if (d < 365 * day) {
+            return plural(Math.floor(d / (30 * day)), "month");
+        }
+        return plural(Math.floor(d / (365 * day)), "year");
+    }
+
+    function refresh() {
+        var now = Date.now();
+        var elements = document.querySelectorAll("time[data-timeago]");
+        for (var i = 0; i < elements.length; i++) {
+            var t = Date.parse(elements[i].getAttribute("datetime"));
+            if (!isNaN(t)) {
+                elements[i].textContent = timeAgo(t, now);
+            }
+        }
+    }
+
+    document.addEventListener("DOMContentLoaded", refresh);
+    setInterval(refresh, minute);
+})();
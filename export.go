@@ -0,0 +1,207 @@
+package honeybee
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	JsonExportFormat = "json"
+	CsvExportFormat  = "csv"
+	YamlExportFormat = "yaml"
+)
+
+var csvExportHeader = []string{"source_id", "source_type", "title", "link",
+	"image_link", "image_width", "image_height", "timestamp", "content"}
+
+// guess the export format from the extension of a filename
+func ExportFormatFromFilename(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		return YamlExportFormat
+	case ".csv":
+		return CsvExportFormat
+	}
+	return JsonExportFormat
+}
+
+// write the blocks in the given format ("json", "csv" or "yaml")
+func ExportBlocks(w io.Writer, blocks []*Block, format string) (err error) {
+	records := make([]BlockRecord, len(blocks))
+	for i, block := range blocks {
+		records[i] = block.Record()
+	}
+	return ExportBlockRecords(w, records, format)
+}
+
+// write block records in the given format
+func ExportBlockRecords(w io.Writer, records []BlockRecord, format string) (err error) {
+	switch format {
+	case JsonExportFormat:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case YamlExportFormat:
+		var data []byte
+		data, err = yaml.Marshal(records)
+		if err != nil {
+			return
+		}
+		_, err = w.Write(data)
+		return
+	case CsvExportFormat:
+		cw := csv.NewWriter(w)
+		err = cw.Write(csvExportHeader)
+		if err != nil {
+			return
+		}
+		for _, r := range records {
+			err = cw.Write([]string{
+				r.SourceId,
+				r.SourceType,
+				r.Title,
+				r.Link,
+				r.ImageLink,
+				strconv.Itoa(r.ImageWidth),
+				strconv.Itoa(r.ImageHeight),
+				r.TimeStamp.Format(time.RFC3339),
+				r.Content,
+			})
+			if err != nil {
+				return
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("Unknown export format: %v", format)
+}
+
+// read block records written by ExportBlocks
+func ImportBlockRecords(r io.Reader, format string) (records []BlockRecord, err error) {
+	switch format {
+	case JsonExportFormat:
+		err = json.NewDecoder(r).Decode(&records)
+		return
+	case YamlExportFormat:
+		var data []byte
+		data, err = ioutil.ReadAll(r)
+		if err != nil {
+			return
+		}
+		err = yaml.Unmarshal(data, &records)
+		return
+	case CsvExportFormat:
+		cr := csv.NewReader(r)
+		var rows [][]string
+		rows, err = cr.ReadAll()
+		if err != nil {
+			return
+		}
+		for i, row := range rows {
+			if i == 0 {
+				// header
+				continue
+			}
+			if len(row) != len(csvExportHeader) {
+				return nil, fmt.Errorf("Unexpected number of columns in row %d", i+1)
+			}
+			record := BlockRecord{
+				SourceId:   row[0],
+				SourceType: row[1],
+				Title:      row[2],
+				Link:       row[3],
+				ImageLink:  row[4],
+				Content:    row[8],
+			}
+			record.ImageWidth, _ = strconv.Atoi(row[5])
+			record.ImageHeight, _ = strconv.Atoi(row[6])
+			record.TimeStamp, err = time.Parse(time.RFC3339, row[7])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid timestamp in row %d: %w", i+1, err)
+			}
+			records = append(records, record)
+		}
+		return
+	}
+	return nil, fmt.Errorf("Unknown export format: %v", format)
+}
+
+// read block records from a file. The format is derived from the filename
+func LoadBlockRecords(filename string) (records []BlockRecord, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return ImportBlockRecords(f, ExportFormatFromFilename(filename))
+}
+
+// write block records to a file. The file is replaced atomically, so
+// readers never see a partially written file.
+func SaveBlockRecords(filename string, records []BlockRecord) (err error) {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), ".honeybee-store")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+
+	err = ExportBlockRecords(tmpFile, records, ExportFormatFromFilename(filename))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// merge imported records into the records of a store file. Imported records
+// replace all existing records of the same sources.
+func ImportIntoStore(filename string, imported []BlockRecord) (err error) {
+	existing, err := LoadBlockRecords(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	importedSources := make(map[string]bool)
+	for _, record := range imported {
+		importedSources[record.SourceId] = true
+	}
+	records := imported
+	for _, record := range existing {
+		if !importedSources[record.SourceId] {
+			records = append(records, record)
+		}
+	}
+	return SaveBlockRecords(filename, records)
+}
+
+// add records to an archive file. Records which are already
+// archived are skipped.
+func ArchiveBlockRecords(filename string, records []BlockRecord) (err error) {
+	archived, err := LoadBlockRecords(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	known := make(map[string]bool)
+	for _, record := range archived {
+		known[record.id()] = true
+	}
+	for _, record := range records {
+		if !known[record.id()] {
+			archived = append(archived, record)
+			known[record.id()] = true
+		}
+	}
+	return SaveBlockRecords(filename, archived)
+}
@@ -0,0 +1,88 @@
+package honeybee
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mmcdole/gofeed"
+	"strings"
+	"time"
+)
+
+const RssFeedSourceType = "rss-feed"
+
+// RssFeedSource provides the items of a RSS or Atom feed
+type RssFeedSource struct {
+	url string
+}
+
+func NewRssFeedSource(params SourceParams) (fs *RssFeedSource, err error) {
+	fs = &RssFeedSource{}
+	for k, v := range params {
+		switch k {
+		case "url":
+			fs.url = v
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", RssFeedSourceType, k)
+			return
+		}
+	}
+	if fs.url == "" {
+		err = errors.New("the 'url' parameter is required")
+		return
+	}
+	return fs, nil
+}
+
+func (fs *RssFeedSource) Type() string {
+	return RssFeedSourceType
+}
+
+func (fs *RssFeedSource) Id() string {
+	return IdEncodeStrings(fs.Type(), fs.url)
+}
+
+func (fs *RssFeedSource) Upstreams() []string {
+	return []string{fs.url}
+}
+
+// the image of a feed item. Falls back to the first image enclosure
+func feedItemImage(item *gofeed.Item) string {
+	if item.Image != nil && item.Image.URL != "" {
+		return item.Image.URL
+	}
+	for _, enclosure := range item.Enclosures {
+		if strings.HasPrefix(enclosure.Type, "image/") {
+			return enclosure.URL
+		}
+	}
+	return ""
+}
+
+func (fs *RssFeedSource) GetBlocks() (blocks []*Block, err error) {
+	feed, err := gofeed.NewParser().ParseURL(fs.url)
+	if err != nil {
+		return
+	}
+
+	for _, item := range feed.Items {
+		block := NewBlock(fs)
+		block.Title = item.Title
+		block.Link = ResolveUrl(fs.url, item.Link)
+		block.Content = item.Description
+		if block.Content == "" {
+			block.Content = item.Content
+		}
+		// relative urls are relative to the location of the feed
+		block.ImageLink = ResolveUrl(fs.url, feedItemImage(item))
+		block.Tags = item.Categories
+		if item.PublishedParsed != nil {
+			block.TimeStamp = item.PublishedParsed.UTC()
+		} else if item.UpdatedParsed != nil {
+			block.TimeStamp = item.UpdatedParsed.UTC()
+		} else {
+			block.TimeStamp = time.Now().UTC()
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
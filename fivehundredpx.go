@@ -0,0 +1,169 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	FiveHundredPxUserPhotosSourceType = "500px-user-photos"
+
+	fiveHundredPxPhotosUrl = "https://api.500px.com/v1/photos"
+	// size id of images with 1080px on the long edge
+	fiveHundredPxImageSize = "1080"
+	fiveHundredPxPerPage   = "100"
+)
+
+// FiveHundredPxUserPhotosSource provides the photos of a 500px user.
+// The v1 api requires a consumer key, 500px does not register new
+// applications anymore.
+type FiveHundredPxUserPhotosSource struct {
+	userName string
+	key      string
+}
+
+func NewFiveHundredPxUserPhotosSource(params SourceParams) (fs *FiveHundredPxUserPhotosSource, err error) {
+	fs = &FiveHundredPxUserPhotosSource{}
+	for k, v := range params {
+		switch k {
+		case "user":
+			fs.userName = v
+		case "key":
+			fs.key = v
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", FiveHundredPxUserPhotosSourceType, k)
+			return
+		}
+	}
+	if fs.userName == "" {
+		err = errors.New("500px source needs a user to fetch photos from")
+		return
+	}
+	if fs.key == "" {
+		err = errors.New("500px source needs a key")
+		return
+	}
+	return fs, nil
+}
+
+func (fs *FiveHundredPxUserPhotosSource) Type() string {
+	return FiveHundredPxUserPhotosSourceType
+}
+
+func (fs *FiveHundredPxUserPhotosSource) Id() string {
+	return IdEncodeStrings(fs.Type(), fs.userName)
+}
+
+func (fs *FiveHundredPxUserPhotosSource) Upstreams() []string {
+	return []string{fiveHundredPxPhotosUrl}
+}
+
+// the first page of the photos is requested, which is refused for invalid keys
+func (fs *FiveHundredPxUserPhotosSource) CheckCredentials() error {
+	_, err := fs.fetchPage(1)
+	return err
+}
+
+// fiveHundredPxError is returned for failed api requests
+type fiveHundredPxError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *fiveHundredPxError) Error() string {
+	return fmt.Sprintf("500px API: %v", e.Message)
+}
+
+func (e *fiveHundredPxError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+type fiveHundredPxPhotosResponse struct {
+	CurrentPage int `json:"current_page"`
+	TotalPages  int `json:"total_pages"`
+	Photos      []struct {
+		Id          int       `json:"id"`
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		CreatedAt   time.Time `json:"created_at"`
+		// path of the page of the photo
+		Url    string `json:"url"`
+		Images []struct {
+			Url string `json:"url"`
+		} `json:"images"`
+		Tags []string `json:"tags"`
+		// photos can be removed from the public profile
+		Privacy bool `json:"privacy"`
+	} `json:"photos"`
+	// set for failed requests
+	Error string `json:"error"`
+}
+
+func (fs *FiveHundredPxUserPhotosSource) fetchPage(page int) (photosResp *fiveHundredPxPhotosResponse, err error) {
+	query := url.Values{}
+	query.Set("feature", "user")
+	query.Set("username", fs.userName)
+	query.Set("consumer_key", fs.key)
+	query.Set("image_size", fiveHundredPxImageSize)
+	query.Set("rpp", fiveHundredPxPerPage)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("tags", "1")
+
+	resp, err := http.Get(fiveHundredPxPhotosUrl + "?" + query.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	photosResp = new(fiveHundredPxPhotosResponse)
+	err = json.NewDecoder(resp.Body).Decode(photosResp)
+	if resp.StatusCode != http.StatusOK {
+		message := resp.Status
+		if err == nil && photosResp.Error != "" {
+			message = photosResp.Error
+		}
+		return nil, &fiveHundredPxError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return
+}
+
+func (fs *FiveHundredPxUserPhotosSource) GetBlocks() (blocks []*Block, err error) {
+	page := 1
+	for {
+		photosResp, err := fs.fetchPage(page)
+		if err != nil {
+			return nil, err
+		}
+		for _, photo := range photosResp.Photos {
+			if photo.Privacy || len(photo.Images) == 0 {
+				continue
+			}
+			block := NewBlock(fs)
+			block.Title = photo.Name
+			block.Content = photo.Description
+			block.ImageLink = photo.Images[0].Url
+			block.Link = "https://500px.com" + photo.Url
+			block.Tags = photo.Tags
+			block.TimeStamp = photo.CreatedAt.UTC()
+			blocks = append(blocks, block)
+		}
+
+		// check if the last page has been reached
+		if page >= photosResp.TotalPages {
+			break
+		}
+		page++
+	}
+	return blocks, nil
+}
@@ -0,0 +1,164 @@
+package honeybee
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// time of the newest fixture block
+var FixtureTime = time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+const (
+	FixtureSourceType = "fixture"
+
+	// maximum size of generated placeholder images
+	placeholderMaxSize = 2000
+)
+
+// FixtureSource generates synthetic blocks with varied titles, contents,
+// image sizes and timestamps, so themes can be developed without access
+// to real sources. The blocks only depend on the parameters.
+type FixtureSource struct {
+	count int
+	seed  int64
+	// url the placeholder images are served from. No images when empty
+	imageBaseUrl string
+}
+
+func NewFixtureSource(params SourceParams) (fs *FixtureSource, err error) {
+	fs = &FixtureSource{
+		count: 20,
+		seed:  1,
+	}
+	for k, v := range params {
+		switch k {
+		case "count":
+			fs.count, err = strconv.Atoi(v)
+			if err != nil || fs.count < 1 {
+				err = fmt.Errorf("count must be a positive number, not %v", v)
+				return
+			}
+		case "seed":
+			fs.seed, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				err = fmt.Errorf("Could not parse seed value: %v", v)
+				return
+			}
+		case "images":
+			fs.imageBaseUrl = v
+			if !strings.HasSuffix(fs.imageBaseUrl, "/") {
+				fs.imageBaseUrl += "/"
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", FixtureSourceType, k)
+			return
+		}
+	}
+	return fs, nil
+}
+
+func (fs *FixtureSource) Type() string {
+	return FixtureSourceType
+}
+
+func (fs *FixtureSource) Id() string {
+	return IdEncodeStrings(fs.Type(), strconv.FormatInt(fs.seed, 10), fs.imageBaseUrl)
+}
+
+var fixtureWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing
+	elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad
+	minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo
+	consequat duis aute irure in reprehenderit voluptate velit esse cillum fugiat
+	nulla pariatur excepteur sint occaecat cupidatat non proident sunt culpa qui
+	officia deserunt mollit anim id est laborum`)
+
+var fixtureTags = []string{"photo", "travel", "software", "release", "pinned", "notes"}
+
+// random text of n words
+func fixtureText(rnd *rand.Rand, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fixtureWords[rnd.Intn(len(fixtureWords))]
+	}
+	text := strings.Join(words, " ")
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+func (fs *FixtureSource) GetBlocks() (blocks []*Block, err error) {
+	rnd := rand.New(rand.NewSource(fs.seed))
+	// a fixed point in time keeps the blocks the same across runs
+	timeStamp := FixtureTime
+
+	for i := 0; i < fs.count; i++ {
+		block := NewBlock(fs)
+		// titles of all lengths, including very long ones
+		block.Title = fixtureText(rnd, 1+rnd.Intn(12))
+		block.Link = fmt.Sprintf("https://example.com/fixture/%d", i)
+		switch rnd.Intn(3) {
+		case 0:
+			// no content
+		case 1:
+			block.Content = fixtureText(rnd, 5+rnd.Intn(20)) + "."
+		case 2:
+			block.Content = fixtureText(rnd, 50+rnd.Intn(150)) + "."
+		}
+		if rnd.Intn(2) == 0 {
+			block.Tags = []string{fixtureTags[rnd.Intn(len(fixtureTags))]}
+		}
+		if fs.imageBaseUrl != "" && rnd.Intn(3) != 0 {
+			width := 100 * (2 + rnd.Intn(11))
+			height := 100 * (2 + rnd.Intn(11))
+			block.ImageLink = fmt.Sprintf("%v%dx%d-%d.png", fs.imageBaseUrl, width, height, i)
+			// replaced by the size of the transformed image when served
+			block.ImageWidth = width
+			block.ImageHeight = height
+		}
+		timeStamp = timeStamp.Add(-time.Duration(1+rnd.Intn(72)) * time.Hour)
+		block.TimeStamp = timeStamp
+		blocks = append(blocks, block)
+	}
+	return
+}
+
+// create a png image of the given size with a gradient in a color
+// depending on n
+func PlaceholderImage(width int, height int, n int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	hue := uint8(n * 47)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			shade := uint8(255 * (x + y) / (width + height))
+			img.Set(x, y, color.RGBA{hue, shade, 255 - hue/2, 0xff})
+		}
+	}
+	buf := new(bytes.Buffer)
+	err := png.Encode(buf, img)
+	return buf.Bytes(), err
+}
+
+// serve the placeholder images of the fixture sources. The name of the
+// image has the form <width>x<height>-<n>.png
+func (s *Server) handlePlaceholderImage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var width, height, n int
+	_, err := fmt.Sscanf(ps.ByName("name"), "%dx%d-%d.png", &width, &height, &n)
+	if err != nil || width < 1 || height < 1 || width > placeholderMaxSize || height > placeholderMaxSize {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := PlaceholderImage(width, height, n)
+	if err != nil {
+		httpError(w, r, "Could not create the image", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
+}
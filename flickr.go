@@ -12,11 +12,13 @@ https://www.flickr.com/services/api/misc.urls.html
 */
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/azer/go-flickr"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,30 +26,24 @@ const (
 	FlickrUserPhotosSourceType   = "flickr-user-photos"
 	FlickrUserPhotosetSourceType = "flickr-user-photoset"
 	photosPerPage                = "200"
-	photoExtras                  = "description,date_upload,o_dims,url_l,media,path_alias,original_format,owner_name"
+	defaultFlickrSize            = "l"
+	photoExtras                  = "description,date_upload,o_dims,media,path_alias,original_format,owner_name,license,geo,tags," +
+		"url_sq,url_t,url_q,url_s,url_n,url_w,url_m,url_z,url_c,url_l,url_h,url_k,url_o"
 )
 
-type photoMessageContainer interface {
-	PhotoList() []flickrPhoto
-	Pages() int
-	Owner() string
-}
+// suffixes of the image sizes, smallest first. The url of each size is
+// requested as an extra named "url_" + suffix.
+var flickrSizes = []string{"sq", "t", "q", "s", "n", "w", "m", "z", "c", "l", "h", "k", "o"}
 
-func checkSuccess(container photoMessageContainer, response *[]byte) (err error) {
-	if len(container.PhotoList()) == 0 {
-		// check if flickr api returned an error and try to unmarshal that
-		var flickrErrorMsg flickrErrorMessage
-		errerr := json.Unmarshal(*response, &flickrErrorMsg)
-		if errerr == nil && flickrErrorMsg.Message != "" {
-			err = errors.New(fmt.Sprintf("Flickr API: %v", flickrErrorMsg.Message))
-		}
-	}
-	return
-}
-
-type flickrErrorMessage struct {
-	Message string `json:"message"`
-}
+// values of the media parameter of the flickr sources, named like
+// the media parameter of the flickr api
+const (
+	FlickrPhotoMedia = "photos"
+	FlickrVideoMedia = "videos"
+	FlickrAllMedia   = "all"
+	// tag of the blocks of videos
+	VideoTag = "video"
+)
 
 type flickrPhoto struct {
 	Id              string `json:"id"`
@@ -56,33 +52,91 @@ type flickrPhoto struct {
 	Description     struct {
 		Content string `json:"_content,omitempty"`
 	} `json:"description,omitempty"`
-	Media    string `json:"media"`
-	Owner    string `json:"owner"`
-	ImageURL string `json:"url_l"`
-	Height   string `json:"height_l"`
-	Width    string `json:"width_l"`
+	Media     string `json:"media"`
+	Owner     string `json:"owner"`
+	OwnerName string `json:"ownername"`
+	// id of the license, see flickrLicenses
+	License string `json:"license"`
+	// space separated, in the normalized form used in urls
+	Tags string `json:"tags"`
+	// position of geotagged photos, numbers or strings depending
+	// on the method
+	Latitude  string `json:"-"`
+	Longitude string `json:"-"`
+	// image urls by size suffix. Sizes which are not available
+	// for the photo are missing
+	Urls map[string]string `json:"-"`
 }
 
-type flickrPhotos struct {
-	Pages int           `json:"pages"`
-	Owner string        `json:"owner"`
-	Photo []flickrPhoto `json:"photo"`
+func (fp *flickrPhoto) UnmarshalJSON(data []byte) error {
+	// decode the regular fields without recursing into this method
+	type plainPhoto flickrPhoto
+	err := json.Unmarshal(data, (*plainPhoto)(fp))
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	fp.Urls = make(map[string]string)
+	for _, size := range flickrSizes {
+		if url, ok := fields["url_"+size].(string); ok && url != "" {
+			fp.Urls[size] = url
+		}
+	}
+	fp.Latitude = flickrCoordinate(fields["latitude"])
+	fp.Longitude = flickrCoordinate(fields["longitude"])
+	return nil
 }
 
-type flickrPeopleGetPublicPhotosMessage struct {
-	Photos flickrPhotos `json:"photos"`
+// coordinate of the geo extra. Photos without a position have 0 as
+// latitude and longitude, which is returned as "".
+func flickrCoordinate(value interface{}) string {
+	var coordinate float64
+	switch v := value.(type) {
+	case float64:
+		coordinate = v
+	case string:
+		coordinate, _ = strconv.ParseFloat(v, 64)
+	}
+	if coordinate == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(coordinate, 'f', -1, 64)
 }
 
-func (gppm flickrPeopleGetPublicPhotosMessage) PhotoList() []flickrPhoto {
-	return gppm.Photos.Photo
+// url of the image in the given size. When the size is not available,
+// the next larger one is used, or the largest smaller one.
+func (fp *flickrPhoto) imageUrl(size string) string {
+	index := 0
+	for i, s := range flickrSizes {
+		if s == size {
+			index = i
+		}
+	}
+	for i := index; i < len(flickrSizes); i++ {
+		if url, found := fp.Urls[flickrSizes[i]]; found {
+			return url
+		}
+	}
+	for i := index - 1; i >= 0; i-- {
+		if url, found := fp.Urls[flickrSizes[i]]; found {
+			return url
+		}
+	}
+	return ""
 }
 
-func (gppm flickrPeopleGetPublicPhotosMessage) Pages() int {
-	return gppm.Photos.Pages
+type flickrPhotos struct {
+	Pages int           `json:"pages"`
+	Owner string        `json:"owner"`
+	Photo []flickrPhoto `json:"photo"`
 }
 
-func (gppm flickrPeopleGetPublicPhotosMessage) Owner() string {
-	return ""
+type flickrPeopleGetPublicPhotosMessage struct {
+	Photos flickrPhotos `json:"photos"`
 }
 
 // response used for fetching photosets
@@ -90,38 +144,53 @@ type flickrPhotosetGetPhotosMessage struct {
 	Photoset flickrPhotos `json:"photoset"`
 }
 
-func (gppm flickrPhotosetGetPhotosMessage) PhotoList() []flickrPhoto {
-	return gppm.Photoset.Photo
-}
-
-func (gppm flickrPhotosetGetPhotosMessage) Pages() int {
-	return gppm.Photoset.Pages
-}
-
-func (gppm flickrPhotosetGetPhotosMessage) Owner() string {
-	return gppm.Photoset.Owner
-}
-
 type commonSourceParams struct {
-	userName string
-	key      string
-	photoset string
+	userName    string
+	credentials flickrCredentials
+	photoset    string
+	media       string
+	size        string
 }
 
 func readCommonSourceParams(sourceType string, params *SourceParams) (*commonSourceParams, error) {
 	userName := ""
-	key := ""
+	credentials := flickrCredentials{}
 	photoset := ""
+	media := FlickrPhotoMedia
+	size := defaultFlickrSize
 	for k, v := range *params {
 		switch k {
 		case "key":
-			key = v
+			credentials.key = v
+		case "secret":
+			credentials.secret = v
+		case "token":
+			credentials.token = v
+		case "token-secret":
+			credentials.tokenSecret = v
 		case "user":
 			userName = v
 		case "photoset":
 			photoset = v
+		case "media":
+			switch v {
+			case FlickrPhotoMedia, FlickrVideoMedia, FlickrAllMedia:
+				media = v
+			default:
+				return nil, fmt.Errorf("Unknown media for %v: %v", sourceType, v)
+			}
+		case "size":
+			size = ""
+			for _, s := range flickrSizes {
+				if s == v {
+					size = v
+				}
+			}
+			if size == "" {
+				return nil, fmt.Errorf("Unknown image size for %v: %v", sourceType, v)
+			}
 		default:
-			err := errors.New(fmt.Sprintf("Unknown parameter for %v: %v", sourceType, k))
+			err := fmt.Errorf("Unknown parameter for %v: %v", sourceType, k)
 			return nil, err
 		}
 	}
@@ -129,48 +198,72 @@ func readCommonSourceParams(sourceType string, params *SourceParams) (*commonSou
 		err := errors.New("flickr source needs a user to fetch photos from")
 		return nil, err
 	}
-	if key == "" {
+	if credentials.key == "" {
 		err := errors.New("flickr source needs a key")
 		return nil, err
 	}
+	if credentials.authenticated() && (credentials.secret == "" || credentials.tokenSecret == "") {
+		err := errors.New("flickr source needs the secret and the token-secret when a token is set")
+		return nil, err
+	}
 	if (photoset == "") && (sourceType == FlickrUserPhotosetSourceType) {
 		err := errors.New("flickr source needs a photoset to fetch photos from")
 		return nil, err
 	}
 	csp := &commonSourceParams{
-		userName: userName,
-		key:      key,
-		photoset: photoset,
+		userName:    userName,
+		credentials: credentials,
+		photoset:    photoset,
+		media:       media,
+		size:        size,
 	}
 	return csp, nil
 }
 
-func pullBlocks(s Source, fetchPage func(int) (photoMessageContainer, error)) (blocks []*Block, err error) {
+// collect the photos and videos of all pages. Videos are linked to their
+// page on flickr and use their poster as image.
+func pullBlocks(s Source, media string, size string, fetchPage func(int) (*flickrPhotos, error)) (blocks []*Block, err error) {
 	page := 1
 	for {
 		flickrPhotos, err := fetchPage(page)
 		if err != nil {
 			return nil, err
 		}
-		for _, photo := range flickrPhotos.PhotoList() {
-
-			// only photos are currently supported
-			if photo.Media != "photo" {
+		for _, photo := range flickrPhotos.Photo {
+
+			switch photo.Media {
+			case "photo":
+				if media == FlickrVideoMedia {
+					continue
+				}
+			case "video":
+				if media == FlickrPhotoMedia {
+					continue
+				}
+			default:
 				continue
 			}
 
 			// owner of photo is not always provided. f.e. not with photoset photos
 			owner := photo.Owner
 			if owner == "" {
-				owner = flickrPhotos.Owner()
+				owner = flickrPhotos.Owner
 			}
 
 			block := NewBlock(s)
 			block.Title = photo.Title
-			block.ImageLink = photo.ImageURL
+			block.ImageLink = photo.imageUrl(size)
 			block.Link = fmt.Sprintf("https://www.flickr.com/photos/%v/%v",
 				owner, photo.Id)
 			block.Content = photo.Description.Content
+			if photo.Media == "video" {
+				block.Tags = append(block.Tags, VideoTag)
+			}
+			block.Tags = append(block.Tags, strings.Fields(photo.Tags)...)
+			block.SetMeta("owner", photo.OwnerName)
+			block.SetMeta("license", flickrLicenses[photo.License])
+			block.SetMeta("latitude", photo.Latitude)
+			block.SetMeta("longitude", photo.Longitude)
 
 			timestamp, err := strconv.ParseInt(photo.TimestampUpload, 0, 64)
 			if err == nil {
@@ -180,7 +273,7 @@ func pullBlocks(s Source, fetchPage func(int) (photoMessageContainer, error)) (b
 		}
 
 		// check if the last page has been reached
-		if page >= flickrPhotos.Pages() {
+		if page >= flickrPhotos.Pages {
 			break
 		}
 		page++
@@ -189,8 +282,10 @@ func pullBlocks(s Source, fetchPage func(int) (photoMessageContainer, error)) (b
 }
 
 type FlickrUserPhotosSource struct {
-	userName string
-	key      string
+	userName    string
+	credentials flickrCredentials
+	media       string
+	size        string
 }
 
 func (fs *FlickrUserPhotosSource) Type() string {
@@ -198,7 +293,15 @@ func (fs *FlickrUserPhotosSource) Type() string {
 }
 
 func (fs *FlickrUserPhotosSource) Id() string {
-	return IdEncodeStrings(fs.Type(), fs.userName, fs.key)
+	return IdEncodeStrings(fs.Type(), fs.userName, fs.credentials.key)
+}
+
+func (fs *FlickrUserPhotosSource) Upstreams() []string {
+	return []string{flickrRestUrl}
+}
+
+func (fs *FlickrUserPhotosSource) CheckCredentials() error {
+	return fs.credentials.check()
 }
 
 func NewFlickrUserPhotosSource(params SourceParams) (fs *FlickrUserPhotosSource, err error) {
@@ -207,48 +310,44 @@ func NewFlickrUserPhotosSource(params SourceParams) (fs *FlickrUserPhotosSource,
 		return
 	}
 	fs = &FlickrUserPhotosSource{
-		userName: csp.userName,
-		key:      csp.key,
+		userName:    csp.userName,
+		credentials: csp.credentials,
+		media:       csp.media,
+		size:        csp.size,
 	}
 	return fs, nil
 }
 
 func (fs *FlickrUserPhotosSource) GetBlocks() (blocks []*Block, err error) {
-	client := flickr.Client{
-		Key: fs.key,
+	// authenticated requests also return the non-public photos
+	method := "people.getPublicPhotos"
+	if fs.credentials.authenticated() {
+		method = "people.getPhotos"
 	}
-	fetchPage := func(page int) (container photoMessageContainer, err error) {
-		response, err := client.Request("people.getPublicPhotos",
-			flickr.Params{
-				"user_id":  fs.userName,
-				"per_page": photosPerPage,
-				"page":     fmt.Sprintf("%v", page),
-				"extras":   photoExtras,
-			})
-		if err != nil {
-			return
-		}
-		//fmt.Printf("F: %v\n", string(response))
-		var flickrPhotos flickrPeopleGetPublicPhotosMessage
-		err = json.Unmarshal(response, &flickrPhotos)
-		if err != nil {
-			return
+	fetchPage := func(page int) (*flickrPhotos, error) {
+		params := url.Values{
+			"user_id":  {fs.userName},
+			"per_page": {photosPerPage},
+			"page":     {strconv.Itoa(page)},
+			"extras":   {photoExtras},
 		}
-		err = checkSuccess(flickrPhotos, &response)
+		var message flickrPeopleGetPublicPhotosMessage
+		err := fs.credentials.call(context.Background(), method, params, &message)
 		if err != nil {
-			return
+			return nil, err
 		}
-		container = flickrPhotos
-		return container, nil
+		return &message.Photos, nil
 	}
-	blocks, err = pullBlocks(fs, fetchPage)
+	blocks, err = pullBlocks(fs, fs.media, fs.size, fetchPage)
 	return
 }
 
 type FlickrUserPhotosetSource struct {
-	userName string
-	key      string
-	photoset string
+	userName    string
+	credentials flickrCredentials
+	photoset    string
+	media       string
+	size        string
 }
 
 func (fs *FlickrUserPhotosetSource) Type() string {
@@ -256,7 +355,15 @@ func (fs *FlickrUserPhotosetSource) Type() string {
 }
 
 func (fs *FlickrUserPhotosetSource) Id() string {
-	return IdEncodeStrings(fs.Type(), fs.userName, fs.key, fs.photoset)
+	return IdEncodeStrings(fs.Type(), fs.userName, fs.credentials.key, fs.photoset)
+}
+
+func (fs *FlickrUserPhotosetSource) Upstreams() []string {
+	return []string{flickrRestUrl}
+}
+
+func (fs *FlickrUserPhotosetSource) CheckCredentials() error {
+	return fs.credentials.check()
 }
 
 func NewFlickrUserPhotosetSource(params SourceParams) (fs *FlickrUserPhotosetSource, err error) {
@@ -265,43 +372,35 @@ func NewFlickrUserPhotosetSource(params SourceParams) (fs *FlickrUserPhotosetSou
 		return
 	}
 	fs = &FlickrUserPhotosetSource{
-		userName: csp.userName,
-		key:      csp.key,
-		photoset: csp.photoset,
+		userName:    csp.userName,
+		credentials: csp.credentials,
+		photoset:    csp.photoset,
+		media:       csp.media,
+		size:        csp.size,
 	}
 	return fs, nil
 }
 
 func (fs *FlickrUserPhotosetSource) GetBlocks() (blocks []*Block, err error) {
-	client := flickr.Client{
-		Key: fs.key,
-	}
-	fetchPage := func(page int) (container photoMessageContainer, err error) {
-		response, err := client.Request("photosets.getPhotos",
-			flickr.Params{
-				"user_id":        fs.userName,
-				"photoset_id":    fs.photoset,
-				"privacy_filter": "1", // only public photos
-				"media":          "photo",
-				"per_page":       photosPerPage,
-				"page":           fmt.Sprintf("%v", page),
-				"extras":         photoExtras,
-			})
-		if err != nil {
-			return
+	fetchPage := func(page int) (*flickrPhotos, error) {
+		params := url.Values{
+			"user_id":     {fs.userName},
+			"photoset_id": {fs.photoset},
+			"media":       {fs.media},
+			"per_page":    {photosPerPage},
+			"page":        {strconv.Itoa(page)},
+			"extras":      {photoExtras},
 		}
-		var photoset flickrPhotosetGetPhotosMessage
-		err = json.Unmarshal(response, &photoset)
-		if err != nil {
-			return
+		if !fs.credentials.authenticated() {
+			params.Set("privacy_filter", "1") // only public photos
 		}
-		err = checkSuccess(photoset, &response)
+		var message flickrPhotosetGetPhotosMessage
+		err := fs.credentials.call(context.Background(), "photosets.getPhotos", params, &message)
 		if err != nil {
-			return
+			return nil, err
 		}
-		container = photoset
-		return container, nil
+		return &message.Photoset, nil
 	}
-	blocks, err = pullBlocks(fs, fetchPage)
+	blocks, err = pullBlocks(fs, fs.media, fs.size, fetchPage)
 	return
 }
@@ -0,0 +1,150 @@
+package honeybee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// attempts of an api call before giving up
+	flickrMaxAttempts = 3
+	// wait before the first retry, doubled for each further one
+	flickrRetryDelay = 2 * time.Second
+)
+
+var flickrHttpClient = newUpstreamClient(5, 30*time.Second)
+
+// flickrError is returned for failed api calls
+type flickrError struct {
+	Method string
+	// error code returned by the api, 0 when the http request failed
+	Code       int
+	StatusCode int
+	Message    string
+}
+
+func (e *flickrError) Error() string {
+	return fmt.Sprintf("Flickr API flickr.%v: %v", e.Method, e.Message)
+}
+
+// see https://www.flickr.com/services/api/flickr.people.getPublicPhotos.html
+func (e *flickrError) ErrorKind() ErrorKind {
+	switch e.Code {
+	case 98, 99, 100:
+		// invalid auth token, insufficient permissions, invalid api key
+		return ErrorKindAuth
+	case 105:
+		// service currently unavailable
+		return ErrorKindNetwork
+	}
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case e.StatusCode >= 500:
+		return ErrorKindNetwork
+	}
+	return ErrorKindOther
+}
+
+// flickr is unavailable or overloaded, the call may succeed later on
+func (e *flickrError) temporary() bool {
+	return e.Code == 105 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// call a method of the flickr api and decode the response into v, which
+// may be nil. Calls which failed because flickr was unavailable or
+// the request did not go through are retried.
+func (fc *flickrCredentials) call(ctx context.Context, method string, params url.Values, v interface{}) (err error) {
+	delay := flickrRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = fc.callOnce(ctx, method, params, v)
+		if err == nil || attempt >= flickrMaxAttempts || !retryableFlickrError(err) {
+			return
+		}
+		logDebugf("Calling flickr.%v failed, retrying in %v: %v", method, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func retryableFlickrError(err error) bool {
+	var apiErr *flickrError
+	if errors.As(err, &apiErr) {
+		return apiErr.temporary()
+	}
+	// timeouts and failed connections. Responses which can not be
+	// decoded are not retried.
+	var netErr net.Error
+	return errors.As(err, &netErr) && !errors.Is(err, context.Canceled)
+}
+
+func (fc *flickrCredentials) callOnce(ctx context.Context, method string, params url.Values, v interface{}) error {
+	values := url.Values{}
+	for k, vs := range params {
+		values[k] = vs
+	}
+	values.Set("method", "flickr."+method)
+	values.Set("format", "json")
+	values.Set("nojsoncallback", "1")
+	if fc.authenticated() {
+		values.Set("oauth_token", fc.token)
+		signOAuthRequest("GET", flickrRestUrl, values, fc.key, fc.secret, fc.tokenSecret)
+	} else {
+		values.Set("api_key", fc.key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", flickrRestUrl+"?"+values.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := flickrHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &flickrError{Method: method, StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+
+	// errors are reported in the body of successful responses
+	var status struct {
+		Stat    string `json:"stat"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		return fmt.Errorf("Could not decode the response of flickr.%v: %w", method, err)
+	}
+	if status.Stat != "ok" {
+		return &flickrError{Method: method, Code: status.Code, StatusCode: resp.StatusCode, Message: status.Message}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// verify the key, and the token when set, using the test methods of the api
+func (fc *flickrCredentials) check() error {
+	method := "test.echo"
+	if fc.authenticated() {
+		method = "test.login"
+	}
+	return fc.call(context.Background(), method, url.Values{}, nil)
+}
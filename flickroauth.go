@@ -0,0 +1,144 @@
+package honeybee
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	flickrRestUrl         = "https://api.flickr.com/services/rest/"
+	flickrRequestTokenUrl = "https://www.flickr.com/services/oauth/request_token"
+	flickrAuthorizeUrl    = "https://www.flickr.com/services/oauth/authorize"
+	flickrAccessTokenUrl  = "https://www.flickr.com/services/oauth/access_token"
+)
+
+// credentials to access the flickr api. Requests are signed using
+// oauth when a token is set, which gives access to non-public photos.
+type flickrCredentials struct {
+	key         string
+	secret      string
+	token       string
+	tokenSecret string
+}
+
+func (fc *flickrCredentials) authenticated() bool {
+	return fc.token != ""
+}
+
+// escape a string as required by oauth (RFC 3986)
+func oauthEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.Replace(s, "+", "%20", -1)
+	return strings.Replace(s, "%7E", "~", -1)
+}
+
+// add the oauth parameters and the HMAC-SHA1 signature to the parameters of a request
+func signOAuthRequest(method string, requestUrl string, values url.Values, consumerKey string, consumerSecret string, tokenSecret string) {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	values.Set("oauth_consumer_key", consumerKey)
+	values.Set("oauth_nonce", hex.EncodeToString(nonce))
+	values.Set("oauth_timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	values.Set("oauth_signature_method", "HMAC-SHA1")
+	values.Set("oauth_version", "1.0")
+
+	// the parameters are sorted by their escaped names and values
+	var pairs []string
+	for k, vs := range values {
+		for _, v := range vs {
+			pairs = append(pairs, oauthEscape(k)+"="+oauthEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	baseString := strings.Join([]string{
+		method,
+		oauthEscape(requestUrl),
+		oauthEscape(strings.Join(pairs, "&")),
+	}, "&")
+
+	mac := hmac.New(sha1.New, []byte(oauthEscape(consumerSecret)+"&"+oauthEscape(tokenSecret)))
+	mac.Write([]byte(baseString))
+	values.Set("oauth_signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func oauthGet(requestUrl string, values url.Values) (body []byte, err error) {
+	resp, err := http.Get(requestUrl + "?" + values.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Flickr OAuth request failed: %v %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return
+}
+
+// FlickrOAuth guides through the oauth flow to get an access
+// token for the flickr sources
+type FlickrOAuth struct {
+	Key    string
+	Secret string
+
+	requestToken       string
+	requestTokenSecret string
+}
+
+// get a request token and return the url the user has to visit to
+// authorize honeybee. Flickr displays a verification code afterwards.
+func (fo *FlickrOAuth) AuthorizeUrl() (authorizeUrl string, err error) {
+	values := url.Values{}
+	values.Set("oauth_callback", "oob")
+	signOAuthRequest("GET", flickrRequestTokenUrl, values, fo.Key, fo.Secret, "")
+	body, err := oauthGet(flickrRequestTokenUrl, values)
+	if err != nil {
+		return
+	}
+	response, err := url.ParseQuery(string(body))
+	if err != nil {
+		return
+	}
+	fo.requestToken = response.Get("oauth_token")
+	fo.requestTokenSecret = response.Get("oauth_token_secret")
+	if fo.requestToken == "" {
+		return "", errors.New("Flickr did not return a request token")
+	}
+	return fmt.Sprintf("%v?perms=read&oauth_token=%v", flickrAuthorizeUrl, url.QueryEscape(fo.requestToken)), nil
+}
+
+// exchange the verification code for the access token
+func (fo *FlickrOAuth) AccessToken(verifier string) (token string, tokenSecret string, err error) {
+	values := url.Values{}
+	values.Set("oauth_token", fo.requestToken)
+	values.Set("oauth_verifier", verifier)
+	signOAuthRequest("GET", flickrAccessTokenUrl, values, fo.Key, fo.Secret, fo.requestTokenSecret)
+	body, err := oauthGet(flickrAccessTokenUrl, values)
+	if err != nil {
+		return
+	}
+	response, err := url.ParseQuery(string(body))
+	if err != nil {
+		return
+	}
+	token = response.Get("oauth_token")
+	tokenSecret = response.Get("oauth_token_secret")
+	if token == "" {
+		err = errors.New("Flickr did not return an access token")
+	}
+	return
+}
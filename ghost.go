@@ -0,0 +1,186 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GhostBlogSourceType = "ghost-blog"
+
+	// version of the content api the responses are expected in
+	ghostApiVersion = "v5.0"
+	ghostPostsPath  = "/ghost/api/content/posts/"
+)
+
+// GhostBlogSource provides the posts of a Ghost blog using its
+// content api, with their feature images and excerpts
+type GhostBlogSource struct {
+	siteUrl string
+	// content api key of a custom integration
+	key string
+	// only posts with this tag. Slug of the tag
+	tag   string
+	limit int
+}
+
+func NewGhostBlogSource(params SourceParams) (gs *GhostBlogSource, err error) {
+	gs = &GhostBlogSource{
+		limit: 15,
+	}
+	for k, v := range params {
+		switch k {
+		case "url":
+			gs.siteUrl = strings.TrimRight(v, "/")
+			if !strings.Contains(gs.siteUrl, "://") {
+				gs.siteUrl = "https://" + gs.siteUrl
+			}
+		case "key":
+			gs.key = v
+		case "tag":
+			gs.tag = v
+		case "limit":
+			gs.limit, err = strconv.Atoi(v)
+			if err != nil || gs.limit < 1 {
+				err = fmt.Errorf("limit must be a positive number, not %v", v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", GhostBlogSourceType, k)
+			return
+		}
+	}
+	if gs.siteUrl == "" {
+		err = errors.New("'url' parameter is not set")
+		return
+	}
+	if gs.key == "" {
+		err = errors.New("'key' parameter is not set")
+		return
+	}
+	return gs, nil
+}
+
+func (gs *GhostBlogSource) Type() string {
+	return GhostBlogSourceType
+}
+
+func (gs *GhostBlogSource) Id() string {
+	return IdEncodeStrings(gs.Type(), gs.siteUrl, gs.tag)
+}
+
+func (gs *GhostBlogSource) Upstreams() []string {
+	return []string{gs.siteUrl}
+}
+
+// the posts are refused for invalid keys
+func (gs *GhostBlogSource) CheckCredentials() error {
+	var posts ghostPostsResponse
+	return gs.get(url.Values{"limit": {"1"}, "fields": {"id"}}, &posts)
+}
+
+// ghostError is returned for failed api requests
+type ghostError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ghostError) Error() string {
+	return fmt.Sprintf("Ghost API: %v", e.Message)
+}
+
+func (e *ghostError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+type ghostPostsResponse struct {
+	Posts []struct {
+		Title         string    `json:"title"`
+		Url           string    `json:"url"`
+		Excerpt       string    `json:"excerpt"`
+		CustomExcerpt string    `json:"custom_excerpt"`
+		FeatureImage  string    `json:"feature_image"`
+		PublishedAt   time.Time `json:"published_at"`
+		Tags          []struct {
+			Name       string `json:"name"`
+			Visibility string `json:"visibility"`
+		} `json:"tags"`
+	} `json:"posts"`
+}
+
+// request posts from the content api and decode the json response
+func (gs *GhostBlogSource) get(query url.Values, v interface{}) (err error) {
+	query.Set("key", gs.key)
+	req, err := http.NewRequest("GET", gs.siteUrl+ghostPostsPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Version", ghostApiVersion)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		message := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && len(errResp.Errors) > 0 {
+			message = errResp.Errors[0].Message
+		}
+		return &ghostError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (gs *GhostBlogSource) GetBlocks() (blocks []*Block, err error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(gs.limit))
+	query.Set("include", "tags")
+	query.Set("fields", "title,url,excerpt,custom_excerpt,feature_image,published_at")
+	if gs.tag != "" {
+		query.Set("filter", "tag:"+gs.tag)
+	}
+	var posts ghostPostsResponse
+	err = gs.get(query, &posts)
+	if err != nil {
+		return
+	}
+
+	for _, post := range posts.Posts {
+		block := NewBlock(gs)
+		block.Title = post.Title
+		block.Link = post.Url
+		// the generated excerpt is plain text taken from the post
+		block.Content = post.CustomExcerpt
+		if block.Content == "" {
+			block.Content = post.Excerpt
+		}
+		block.ImageLink = post.FeatureImage
+		block.TimeStamp = post.PublishedAt.UTC()
+		for _, tag := range post.Tags {
+			// internal tags are only used for organizing the blog
+			if tag.Visibility == "public" {
+				block.Tags = append(block.Tags, tag.Name)
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
@@ -0,0 +1,192 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GiteaUserReposSourceType = "gitea-user-repos"
+
+	giteaDefaultInstance = "https://codeberg.org"
+	giteaReposPerPage    = 50
+)
+
+// GiteaUserReposSource provides the repositories of a user of a
+// Gitea based forge like Codeberg, similar to the GitHub source
+type GiteaUserReposSource struct {
+	instance     string
+	userName     string
+	includeForks bool
+	// optional access token, gives access to private repositories
+	token string
+}
+
+func NewGiteaUserReposSource(params SourceParams) (gs *GiteaUserReposSource, err error) {
+	gs = &GiteaUserReposSource{
+		instance: giteaDefaultInstance,
+	}
+	for k, v := range params {
+		switch k {
+		case "instance":
+			gs.instance = strings.TrimRight(v, "/")
+			if !strings.Contains(gs.instance, "://") {
+				gs.instance = "https://" + gs.instance
+			}
+		case "includeForks":
+			gs.includeForks, err = strconv.ParseBool(v)
+			if err != nil {
+				return
+			}
+		case "token":
+			gs.token = v
+		case "user":
+			gs.userName = v
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", GiteaUserReposSourceType, k)
+			return
+		}
+	}
+	if gs.userName == "" {
+		err = errors.New("'user' parameter is not set")
+		return
+	}
+	return gs, nil
+}
+
+func (gs *GiteaUserReposSource) Type() string {
+	return GiteaUserReposSourceType
+}
+
+func (gs *GiteaUserReposSource) Id() string {
+	return IdEncodeStrings(gs.Type(), gs.instance, gs.userName)
+}
+
+func (gs *GiteaUserReposSource) Upstreams() []string {
+	return []string{gs.instance}
+}
+
+// the optional token is verified with the user it belongs to
+func (gs *GiteaUserReposSource) CheckCredentials() error {
+	if gs.token == "" {
+		return nil
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	return gs.get("/api/v1/user", url.Values{}, &user)
+}
+
+// giteaError is returned for failed api requests
+type giteaError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *giteaError) Error() string {
+	return fmt.Sprintf("Gitea API: %v", e.Message)
+}
+
+func (e *giteaError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+type giteaRepository struct {
+	Name        string    `json:"name"`
+	HtmlUrl     string    `json:"html_url"`
+	Description string    `json:"description"`
+	Fork        bool      `json:"fork"`
+	Language    string    `json:"language"`
+	Stars       int       `json:"stars_count"`
+	Forks       int       `json:"forks_count"`
+	Topics      []string  `json:"topics"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// call the api of the instance and decode the json response
+func (gs *GiteaUserReposSource) get(path string, query url.Values, v interface{}) (err error) {
+	req, err := http.NewRequest("GET", gs.instance+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	if gs.token != "" {
+		req.Header.Set("Authorization", "token "+gs.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		message := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Message != "" {
+			message = errResp.Message
+		}
+		return &giteaError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (gs *GiteaUserReposSource) GetBlocks() (blocks []*Block, err error) {
+	path := fmt.Sprintf("/api/v1/users/%v/repos", url.PathEscape(gs.userName))
+	page := 1
+	for {
+		query := url.Values{}
+		query.Set("page", strconv.Itoa(page))
+		query.Set("limit", strconv.Itoa(giteaReposPerPage))
+
+		var repos []giteaRepository
+		err = gs.get(path, query, &repos)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			if !gs.includeForks && repo.Fork {
+				continue
+			}
+			if repo.Name == "" || repo.HtmlUrl == "" {
+				continue
+			}
+			block := NewBlock(gs)
+			block.Title = repo.Name
+			block.Link = repo.HtmlUrl
+			block.Content = repo.Description
+			block.Tags = append(block.Tags, repo.Topics...)
+			block.Language = repo.Language
+			block.Stars = repo.Stars
+			if repo.Forks > 0 {
+				block.SetMeta("forks", strconv.Itoa(repo.Forks))
+			}
+			// gitea has no separate timestamp of the last push, updated_at
+			// changes with pushes as well
+			if !repo.UpdatedAt.IsZero() {
+				block.TimeStamp = repo.UpdatedAt.UTC()
+			} else {
+				block.TimeStamp = repo.CreatedAt.UTC()
+			}
+			blocks = append(blocks, block)
+		}
+		if len(repos) < giteaReposPerPage {
+			break
+		}
+		page++
+	}
+	return blocks, nil
+}
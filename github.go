@@ -1,22 +1,42 @@
 package honeybee
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/google/go-github/github"
+	"github.com/google/go-github/v66/github"
+	"net/http"
 	"strconv"
 )
 
-const GithubUserReposSourceType = "github-user-repos"
+const (
+	GithubUserReposSourceType = "github-user-repos"
+	githubGraphqlUrl          = "https://api.github.com/graphql"
+	// tag added to blocks of pinned repositories
+	PinnedTag = "pinned"
+)
 
 type GithubUserReposSource struct {
 	userName     string
 	includeForks bool
+	// oauth token to raise the rate limit. The graphql api used to
+	// fetch the pinned repositories requires it
+	token  string
+	pinned bool
+	// authenticates and caches the requests
+	transport *githubTransport
+	// maximum number of repositories, 0 fetches all of them
+	maxRepos int
 }
 
 func NewGithubUserReposSource(params SourceParams) (gs *GithubUserReposSource, err error) {
 	userName := ""
 	includeForks := false
+	token := ""
+	pinned := false
+	maxRepos := 0
 
 	for k, v := range params {
 		switch k {
@@ -25,10 +45,23 @@ func NewGithubUserReposSource(params SourceParams) (gs *GithubUserReposSource, e
 			if err != nil {
 				return
 			}
+		case "pinned":
+			pinned, err = strconv.ParseBool(v)
+			if err != nil {
+				return
+			}
+		case "token":
+			token = v
+		case "maxRepos":
+			maxRepos, err = strconv.Atoi(v)
+			if err != nil || maxRepos < 0 {
+				err = fmt.Errorf("maxRepos must be a positive number, not %v", v)
+				return
+			}
 		case "user":
 			userName = v
 		default:
-			err = errors.New(fmt.Sprintf("Unknown parameter for %v: %v", GithubUserReposSourceType, k))
+			err = fmt.Errorf("Unknown parameter for %v: %v", GithubUserReposSourceType, k)
 			return
 		}
 	}
@@ -36,10 +69,18 @@ func NewGithubUserReposSource(params SourceParams) (gs *GithubUserReposSource, e
 		err = errors.New("'user' parameter is not set")
 		return
 	}
+	if pinned && token == "" {
+		err = errors.New("'token' parameter is required to fetch pinned repositories")
+		return
+	}
 
 	gs = &GithubUserReposSource{
 		userName:     userName,
 		includeForks: includeForks,
+		token:        token,
+		pinned:       pinned,
+		maxRepos:     maxRepos,
+		transport:    newGithubTransport(token),
 	}
 	return gs, nil
 }
@@ -52,19 +93,88 @@ func (gs *GithubUserReposSource) Id() string {
 	return IdEncodeStrings(gs.Type(), gs.userName)
 }
 
-func (gs *GithubUserReposSource) GetBlocks() (blocks []*Block, err error) {
+func (gs *GithubUserReposSource) Upstreams() []string {
+	return []string{githubGraphqlUrl}
+}
 
-	client := github.NewClient(nil)
-	opt := &github.RepositoryListOptions{Type: "owner", Sort: "updated", Direction: "desc"}
-	repos, _, err := client.Repositories.List(gs.userName, opt)
+func (gs *GithubUserReposSource) RateLimit() (RateLimit, bool) {
+	return gs.transport.RateLimit()
+}
+
+func (gs *GithubUserReposSource) CheckCredentials() error {
+	if gs.token == "" {
+		return nil
+	}
+	body, err := json.Marshal(map[string]string{"query": "query { viewer { login } }"})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", githubGraphqlUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+gs.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &githubGraphqlError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	return nil
+}
+
+// fetch all pages of the repositories of the user, most recently
+// updated first. Stops once maxRepos repositories have been found.
+func (gs *GithubUserReposSource) listRepos(ctx context.Context) (repos []*github.Repository, err error) {
+	client := gs.transport.client()
+	opt := &github.RepositoryListByUserOptions{
+		Type:        "owner",
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := client.Repositories.ListByUser(ctx, gs.userName, opt)
+		gs.transport.recordRate(resp, err)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range page {
+			if !gs.includeForks && repo.Fork != nil && *repo.Fork {
+				continue
+			}
+			repos = append(repos, repo)
+			if gs.maxRepos > 0 && len(repos) >= gs.maxRepos {
+				return repos, nil
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return repos, nil
+}
+
+func (gs *GithubUserReposSource) GetBlocks() (blocks []*Block, err error) {
+	ctx := context.Background()
+	repos, err := gs.listRepos(ctx)
 	if err != nil {
 		return
 	}
 
-	for _, repo := range repos {
-		if !gs.includeForks && *repo.Fork {
-			continue
+	pinnedRepos := make(map[string]bool)
+	if gs.pinned {
+		pinnedRepos, err = gs.fetchPinnedRepos(ctx)
+		if err != nil {
+			return
 		}
+	}
+
+	for _, repo := range repos {
 		if repo.Name == nil || repo.HTMLURL == nil {
 			continue
 		}
@@ -74,6 +184,21 @@ func (gs *GithubUserReposSource) GetBlocks() (blocks []*Block, err error) {
 		}
 		block.Title = *repo.Name
 		block.Link = *repo.HTMLURL
+		block.Tags = append(block.Tags, repo.Topics...)
+		// repositories of organizations may share the name of a pinned one
+		if repo.FullName != nil && pinnedRepos[*repo.FullName] {
+			block.Tags = append(block.Tags, PinnedTag)
+		}
+		if repo.Language != nil {
+			block.Language = *repo.Language
+		}
+		if repo.StargazersCount != nil {
+			block.Stars = *repo.StargazersCount
+		}
+		// licenses github does not recognize have no SPDX identifier
+		if repo.License != nil && repo.License.SPDXID != nil && *repo.License.SPDXID != "NOASSERTION" {
+			block.SetMeta("license", *repo.License.SPDXID)
+		}
 
 		/*
 		   From http://stackoverflow.com/questions/15918588/github-api-v3-what-is-the-difference-between-pushed-at-and-updated-at
@@ -102,3 +227,87 @@ func (gs *GithubUserReposSource) GetBlocks() (blocks []*Block, err error) {
 	}
 	return
 }
+
+type githubPinnedReposResponse struct {
+	Data struct {
+		User struct {
+			PinnedItems struct {
+				Nodes []struct {
+					NameWithOwner string `json:"nameWithOwner"`
+				} `json:"nodes"`
+			} `json:"pinnedItems"`
+		} `json:"user"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// githubGraphqlError is returned for failed graphql requests
+type githubGraphqlError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *githubGraphqlError) Error() string {
+	return fmt.Sprintf("GitHub GraphQL API: %v", e.Message)
+}
+
+func (e *githubGraphqlError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+// fetch the full names of the pinned repositories of the user, as
+// "owner/name". This is only available using the graphql api.
+func (gs *GithubUserReposSource) fetchPinnedRepos(ctx context.Context) (names map[string]bool, err error) {
+	query := map[string]interface{}{
+		"query": `query($login: String!) {
+			user(login: $login) {
+				pinnedItems(first: 6, types: REPOSITORY) {
+					nodes { ... on Repository { nameWithOwner } }
+				}
+			}
+		}`,
+		"variables": map[string]string{"login": gs.userName},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", githubGraphqlUrl, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "bearer "+gs.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &githubGraphqlError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+
+	var pinnedResp githubPinnedReposResponse
+	err = json.NewDecoder(resp.Body).Decode(&pinnedResp)
+	if err != nil {
+		return
+	}
+	if len(pinnedResp.Errors) > 0 {
+		return nil, &githubGraphqlError{StatusCode: resp.StatusCode, Message: pinnedResp.Errors[0].Message}
+	}
+
+	names = make(map[string]bool)
+	for _, node := range pinnedResp.Data.User.PinnedItems.Nodes {
+		names[node.NameWithOwner] = true
+	}
+	return names, nil
+}
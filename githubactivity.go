@@ -0,0 +1,209 @@
+package honeybee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v66/github"
+	"strings"
+)
+
+const (
+	GithubUserActivitySourceType = "github-user-activity"
+
+	// kinds of notable events, also used as tags of the blocks
+	githubReleaseActivity     = "release"
+	githubRepositoryActivity  = "repository"
+	githubPullRequestActivity = "pull-request"
+)
+
+// GithubUserActivitySource creates blocks for notable events of
+// the public activity of an user
+type GithubUserActivitySource struct {
+	userName   string
+	activities map[string]bool
+	// authenticates and caches the requests, using the optional
+	// oauth token to raise the rate limit
+	transport *githubTransport
+}
+
+func NewGithubUserActivitySource(params SourceParams) (gs *GithubUserActivitySource, err error) {
+	userName := ""
+	token := ""
+	activities := map[string]bool{
+		githubReleaseActivity:     true,
+		githubRepositoryActivity:  true,
+		githubPullRequestActivity: true,
+	}
+
+	for k, v := range params {
+		switch k {
+		case "user":
+			userName = v
+		case "token":
+			token = v
+		case "events":
+			activities = make(map[string]bool)
+			for _, activity := range strings.Split(v, ",") {
+				activity = strings.TrimSpace(activity)
+				switch activity {
+				case githubReleaseActivity, githubRepositoryActivity, githubPullRequestActivity:
+					activities[activity] = true
+				default:
+					err = fmt.Errorf("Unknown event for %v: %v", GithubUserActivitySourceType, activity)
+					return
+				}
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", GithubUserActivitySourceType, k)
+			return
+		}
+	}
+	if userName == "" {
+		err = errors.New("'user' parameter is not set")
+		return
+	}
+
+	gs = &GithubUserActivitySource{
+		userName:   userName,
+		activities: activities,
+		transport:  newGithubTransport(token),
+	}
+	return gs, nil
+}
+
+func (gs *GithubUserActivitySource) Type() string {
+	return GithubUserActivitySourceType
+}
+
+func (gs *GithubUserActivitySource) Id() string {
+	return IdEncodeStrings(gs.Type(), gs.userName)
+}
+
+func (gs *GithubUserActivitySource) RateLimit() (RateLimit, bool) {
+	return gs.transport.RateLimit()
+}
+
+func (gs *GithubUserActivitySource) Upstreams() []string {
+	return []string{"https://api.github.com/"}
+}
+
+type githubReleasePayload struct {
+	Action  string `json:"action"`
+	Release struct {
+		Name    string `json:"name"`
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+		Body    string `json:"body"`
+	} `json:"release"`
+}
+
+type githubCreatePayload struct {
+	RefType     string `json:"ref_type"`
+	Description string `json:"description"`
+}
+
+type githubPullRequestPayload struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Body    string `json:"body"`
+		Merged  bool   `json:"merged"`
+	} `json:"pull_request"`
+}
+
+func (gs *GithubUserActivitySource) GetBlocks() (blocks []*Block, err error) {
+	ctx := context.Background()
+	client := gs.transport.client()
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := client.Activity.ListEventsPerformedByUser(ctx, gs.userName, true, opt)
+		gs.transport.recordRate(resp, err)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			block, err := gs.eventToBlock(event)
+			if err != nil {
+				return nil, err
+			}
+			if block != nil {
+				blocks = append(blocks, block)
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return blocks, nil
+}
+
+// create a block for notable events. Returns nil for all other events
+func (gs *GithubUserActivitySource) eventToBlock(event *github.Event) (block *Block, err error) {
+	if event.Type == nil || event.RawPayload == nil || event.Repo == nil || event.Repo.Name == nil {
+		return nil, nil
+	}
+	repoName := *event.Repo.Name
+	repoUrl := "https://github.com/" + repoName
+
+	block = NewBlock(gs)
+	switch *event.Type {
+	case "ReleaseEvent":
+		if !gs.activities[githubReleaseActivity] {
+			return nil, nil
+		}
+		var payload githubReleasePayload
+		err = json.Unmarshal(*event.RawPayload, &payload)
+		if err != nil || payload.Action != "published" {
+			return nil, err
+		}
+		name := payload.Release.Name
+		if name == "" {
+			name = payload.Release.TagName
+		}
+		block.Title = fmt.Sprintf("%v %v released", repoName, name)
+		block.Link = payload.Release.HTMLURL
+		block.Content = payload.Release.Body
+		block.Tags = []string{githubReleaseActivity}
+	case "CreateEvent":
+		if !gs.activities[githubRepositoryActivity] {
+			return nil, nil
+		}
+		var payload githubCreatePayload
+		err = json.Unmarshal(*event.RawPayload, &payload)
+		if err != nil || payload.RefType != "repository" {
+			return nil, err
+		}
+		block.Title = fmt.Sprintf("Created %v", repoName)
+		block.Link = repoUrl
+		block.Content = payload.Description
+		block.Tags = []string{githubRepositoryActivity}
+	case "PullRequestEvent":
+		if !gs.activities[githubPullRequestActivity] {
+			return nil, nil
+		}
+		// only contributions to the repositories of others are notable
+		if strings.HasPrefix(strings.ToLower(repoName), strings.ToLower(gs.userName)+"/") {
+			return nil, nil
+		}
+		var payload githubPullRequestPayload
+		err = json.Unmarshal(*event.RawPayload, &payload)
+		if err != nil || payload.Action != "closed" || !payload.PullRequest.Merged {
+			return nil, err
+		}
+		block.Title = payload.PullRequest.Title
+		block.Link = payload.PullRequest.HTMLURL
+		block.Content = fmt.Sprintf("Merged into %v", repoName)
+		block.Tags = []string{githubPullRequestActivity}
+	default:
+		return nil, nil
+	}
+
+	if event.CreatedAt != nil {
+		block.TimeStamp = event.CreatedAt.UTC()
+	}
+	return block, nil
+}
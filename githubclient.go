@@ -0,0 +1,126 @@
+package honeybee
+
+import (
+	"bytes"
+	"errors"
+	"github.com/google/go-github/v66/github"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// githubTransport authenticates the requests to the GitHub api with
+// an oauth token, when one is configured, and makes them conditional.
+// GitHub does not count unchanged responses against the rate limit.
+type githubTransport struct {
+	token     string
+	responses map[string]*githubCachedResponse
+	mtx       *sync.Mutex
+
+	// rate limit reported with the last response
+	rate github.Rate
+}
+
+// the last response for an url, replayed when the resource did not change
+type githubCachedResponse struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+func newGithubTransport(token string) *githubTransport {
+	return &githubTransport{
+		token:     token,
+		responses: make(map[string]*githubCachedResponse),
+		mtx:       new(sync.Mutex),
+	}
+}
+
+// create a client for the GitHub api using the transport
+func (gt *githubTransport) client() *github.Client {
+	return github.NewClient(&http.Client{Transport: gt})
+}
+
+func (gt *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	if gt.token != "" {
+		req.Header.Set("Authorization", "token "+gt.token)
+	}
+	key := req.URL.String()
+	gt.mtx.Lock()
+	cached := gt.responses[key]
+	gt.mtx.Unlock()
+	if cached != nil && req.Method == "GET" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		logDebugf("Not modified: %v", key)
+		// replay the cached response with the current rate limit headers
+		header := cached.header.Clone()
+		for name, values := range resp.Header {
+			header[name] = values
+		}
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header = header
+		resp.Body = ioutil.NopCloser(bytes.NewReader(cached.body))
+		resp.ContentLength = int64(len(cached.body))
+	case resp.StatusCode == http.StatusOK && req.Method == "GET" && resp.Header.Get("Etag") != "":
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		gt.mtx.Lock()
+		gt.responses[key] = &githubCachedResponse{
+			etag:   resp.Header.Get("Etag"),
+			header: resp.Header.Clone(),
+			body:   body,
+		}
+		gt.mtx.Unlock()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return resp, nil
+}
+
+// remember the rate limit reported with a response of the api, or with
+// the error returned once it has been exceeded
+func (gt *githubTransport) recordRate(resp *github.Response, err error) {
+	var rate github.Rate
+	var rateLimitErr *github.RateLimitError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		rate = rateLimitErr.Rate
+	case resp != nil && resp.Rate.Limit > 0:
+		rate = resp.Rate
+	default:
+		return
+	}
+	gt.mtx.Lock()
+	gt.rate = rate
+	gt.mtx.Unlock()
+}
+
+// the rate limit of the token, or of the ip address for requests
+// without a token. Not known before the first request.
+func (gt *githubTransport) RateLimit() (limit RateLimit, known bool) {
+	gt.mtx.Lock()
+	defer gt.mtx.Unlock()
+	if gt.rate.Limit == 0 {
+		return
+	}
+	return RateLimit{
+		Limit:     gt.rate.Limit,
+		Remaining: gt.rate.Remaining,
+		Reset:     gt.rate.Reset.Time.UTC(),
+	}, true
+}
@@ -0,0 +1,278 @@
+package honeybee
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HFeedSourceType = "h-feed"
+
+	// maximum number of characters of titles taken from the content of notes
+	hFeedTitleLength = 80
+	// pages are not read beyond this size
+	hFeedMaxPageSize = 5 * 1024 * 1024
+)
+
+// layouts of the dt-published values in the wild
+var hFeedTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// HFeedSource provides the entries of a page marked up with the
+// microformats2 h-feed and h-entry classes, like the pages of
+// micro.blog and most IndieWeb sites
+type HFeedSource struct {
+	url   string
+	limit int
+}
+
+func NewHFeedSource(params SourceParams) (hs *HFeedSource, err error) {
+	hs = &HFeedSource{
+		limit: 20,
+	}
+	for k, v := range params {
+		switch k {
+		case "url":
+			hs.url = v
+		case "limit":
+			hs.limit, err = strconv.Atoi(v)
+			if err != nil || hs.limit < 1 {
+				err = fmt.Errorf("limit must be a positive number, not %v", v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", HFeedSourceType, k)
+			return
+		}
+	}
+	if hs.url == "" {
+		err = errors.New("the 'url' parameter is required")
+		return
+	}
+	return hs, nil
+}
+
+func (hs *HFeedSource) Type() string {
+	return HFeedSourceType
+}
+
+func (hs *HFeedSource) Id() string {
+	return IdEncodeStrings(hs.Type(), hs.url)
+}
+
+func (hs *HFeedSource) Upstreams() []string {
+	return []string{hs.url}
+}
+
+// properties of an h-entry
+type hEntry struct {
+	name      string
+	url       string
+	published string
+	content   string
+	summary   string
+	photo     string
+	// text of the content, to detect names implied from the content
+	contentText string
+	categories  []string
+}
+
+func (hs *HFeedSource) GetBlocks() (blocks []*Block, err error) {
+	resp, err := politeFetcher.Get(hs.url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not fetch %v: %v", hs.url, resp.Status)
+	}
+	doc, err := html.Parse(io.LimitReader(resp.Body, hFeedMaxPageSize))
+	if err != nil {
+		return
+	}
+
+	for _, entry := range findHEntries(doc) {
+		if len(blocks) >= hs.limit {
+			break
+		}
+		block := NewBlock(hs)
+		block.Link = ResolveUrl(hs.url, entry.url)
+		if entry.url == "" {
+			block.Link = hs.url
+		}
+		block.Content = entry.content
+		if block.Content == "" {
+			block.Content = html.EscapeString(entry.summary)
+		}
+		block.Title = entry.name
+		if block.Title == "" || block.Title == entry.contentText {
+			// notes have no name of their own
+			text := entry.contentText
+			if text == "" {
+				text = entry.summary
+			}
+			block.Title = Summarize(strings.SplitN(text, "\n", 2)[0], hFeedTitleLength)
+		}
+		block.ImageLink = ResolveUrl(hs.url, entry.photo)
+		block.Tags = entry.categories
+		block.TimeStamp = time.Now().UTC()
+		for _, layout := range hFeedTimeLayouts {
+			if t, parseErr := time.Parse(layout, entry.published); parseErr == nil {
+				block.TimeStamp = t.UTC()
+				break
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
+
+// the classes of an element
+func htmlClasses(n *html.Node) []string {
+	for _, attr := range n.Attr {
+		if attr.Key == "class" {
+			return strings.Fields(attr.Val)
+		}
+	}
+	return nil
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// elements with a h-* class start a microformat of their own
+func isMicroformatRoot(n *html.Node) bool {
+	for _, class := range htmlClasses(n) {
+		if strings.HasPrefix(class, "h-") {
+			return true
+		}
+	}
+	return false
+}
+
+// the h-entries of a document which are not nested in other entries,
+// like replies or quoted posts
+func findHEntries(doc *html.Node) (entries []*hEntry) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, class := range htmlClasses(n) {
+				if class == "h-entry" {
+					entries = append(entries, parseHEntry(n))
+					return
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return
+}
+
+// collect the properties of an entry. The first value of each
+// property is used, nested microformats are skipped.
+func parseHEntry(root *html.Node) *hEntry {
+	entry := new(hEntry)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		if n != root && isMicroformatRoot(n) {
+			return
+		}
+		for _, class := range htmlClasses(n) {
+			switch class {
+			case "p-name":
+				if entry.name == "" {
+					entry.name = htmlText(n)
+				}
+			case "u-url", "u-uid":
+				if entry.url == "" {
+					entry.url = urlProperty(n)
+				}
+			case "u-photo", "u-featured":
+				if entry.photo == "" {
+					entry.photo = urlProperty(n)
+				}
+			case "dt-published":
+				if entry.published == "" {
+					entry.published = htmlAttr(n, "datetime")
+					if entry.published == "" {
+						entry.published = htmlText(n)
+					}
+				}
+			case "e-content":
+				if entry.content == "" {
+					entry.content = innerHtml(n)
+					entry.contentText = htmlText(n)
+				}
+			case "p-summary":
+				if entry.summary == "" {
+					entry.summary = htmlText(n)
+				}
+			case "p-category":
+				if category := htmlText(n); category != "" {
+					entry.categories = append(entry.categories, strings.TrimPrefix(category, "#"))
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return entry
+}
+
+// value of an u-* property
+func urlProperty(n *html.Node) string {
+	switch n.Data {
+	case "a", "area", "link":
+		return htmlAttr(n, "href")
+	case "img", "audio", "video", "source":
+		return htmlAttr(n, "src")
+	}
+	return htmlText(n)
+}
+
+// text of an element with collapsed whitespace, keeping the
+// paragraphs apart
+func htmlText(n *html.Node) string {
+	buf := new(bytes.Buffer)
+	html.Render(buf, n)
+	text, _, err := ExtractHtml(buf.String())
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+func innerHtml(n *html.Node) string {
+	buf := new(bytes.Buffer)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(buf, c)
+	}
+	return strings.TrimSpace(buf.String())
+}
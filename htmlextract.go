@@ -0,0 +1,172 @@
+package honeybee
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"strings"
+)
+
+// elements which separate blocks of text
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "figure": true, "figcaption": true,
+}
+
+// elements whose contents are not text
+var htmlSkippedElements = map[string]bool{
+	"script": true, "style": true, "head": true, "noscript": true, "iframe": true,
+}
+
+// extract the plain text and the source of the first image from html
+// content, f.e. the content of feed entries.
+func ExtractHtml(content string) (text string, imageLink string, err error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return
+	}
+
+	var paragraphs []string
+	current := new(strings.Builder)
+	endParagraph := func() {
+		if p := strings.Join(strings.Fields(current.String()), " "); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+		current.Reset()
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			current.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if htmlSkippedElements[n.Data] {
+				return
+			}
+			if n.Data == "img" && imageLink == "" {
+				for _, attr := range n.Attr {
+					if attr.Key == "src" && attr.Val != "" {
+						imageLink = attr.Val
+					}
+				}
+			}
+			if htmlBlockElements[n.Data] {
+				endParagraph()
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && htmlBlockElements[n.Data] {
+			endParagraph()
+		}
+	}
+	walk(doc)
+	endParagraph()
+
+	text = strings.Join(paragraphs, "\n\n")
+	return
+}
+
+// elements kept by SanitizeHtml when no other ones are configured
+var DefaultSanitizedElements = []string{
+	"p", "br", "hr", "a", "img", "em", "strong", "b", "i", "u", "s", "del", "ins",
+	"sub", "sup", "code", "pre", "blockquote", "ul", "ol", "li",
+	"h1", "h2", "h3", "h4", "h5", "h6", "figure", "figcaption",
+	"table", "thead", "tbody", "tr", "th", "td",
+}
+
+// attributes kept by SanitizeHtml, by element
+var sanitizedAttributes = map[string]map[string]bool{
+	"a":   {"href": true, "title": true},
+	"img": {"src": true, "alt": true, "title": true, "width": true, "height": true},
+	"td":  {"colspan": true, "rowspan": true},
+	"th":  {"colspan": true, "rowspan": true},
+}
+
+// attributes holding urls and the schemes allowed for them
+var sanitizedUrlAttributes = map[string]map[string]bool{
+	"href": {"http": true, "https": true, "mailto": true},
+	"src":  {"http": true, "https": true},
+}
+
+// elements without content and end tag
+var htmlVoidElements = map[string]bool{
+	"br": true, "hr": true, "img": true,
+}
+
+// reduce html content to the allowed elements and a few of their
+// attributes, so it can be trusted by the templates. Other elements are
+// replaced by their content, scripts and styles are dropped. Relative
+// urls are resolved against base.
+func SanitizeHtml(content string, allowed map[string]bool, base string) (string, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return "", err
+	}
+
+	out := new(strings.Builder)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			out.WriteString(html.EscapeString(n.Data))
+			return
+		case html.ElementNode:
+			if htmlSkippedElements[n.Data] {
+				return
+			}
+		default:
+			// comments and doctypes
+			return
+		}
+
+		keep := allowed[n.Data]
+		if keep {
+			out.WriteString("<" + n.Data)
+			for _, attr := range n.Attr {
+				value, ok := sanitizedAttribute(n.Data, attr, base)
+				if ok {
+					out.WriteString(" " + attr.Key + `="` + html.EscapeString(value) + `"`)
+				}
+			}
+			if n.Data == "a" {
+				out.WriteString(` rel="nofollow noopener"`)
+			}
+			out.WriteString(">")
+			if htmlVoidElements[n.Data] {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if keep {
+			out.WriteString("</" + n.Data + ">")
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return out.String(), nil
+}
+
+// the value of an attribute when it may be kept
+func sanitizedAttribute(element string, attr html.Attribute, base string) (string, bool) {
+	if attr.Namespace != "" || !sanitizedAttributes[element][attr.Key] {
+		return "", false
+	}
+	schemes, isUrl := sanitizedUrlAttributes[attr.Key]
+	if !isUrl {
+		return attr.Val, true
+	}
+	u, err := url.Parse(ResolveUrl(base, strings.TrimSpace(attr.Val)))
+	if err != nil || !schemes[strings.ToLower(u.Scheme)] {
+		return "", false
+	}
+	return u.String(), true
+}
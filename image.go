@@ -3,19 +3,23 @@ package honeybee
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"image"
 	"io"
 	"io/ioutil"
-	"log"
+	"mime"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
-	"willnorris.com/go/imageproxy"
 )
 
 type download struct {
@@ -28,116 +32,410 @@ type downloadOperation struct {
 	// channels of downstream listeners waiting for results
 	downstreamChans []chan *download
 	modifyMtx       *sync.Mutex
+
+	// cancels the upstream transfer once all listeners are gone
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
+// header used to store the time an entry was written to the cache
+const cachedAtHeader = "X-Honeybee-Cached-At"
+
 type ImgProxy struct {
-	cache            Cache
-	transformOptions *imageproxy.Options
+	cache     Cache
+	transform *imageTransform
+	// external service resizing the images, nil when they are
+	// transformed by honeybee
+	offload *imageOffload
+	// client for the requests to upstream servers
+	client *http.Client
+
+	// entries older than maxAge are served, but refreshed in the background
+	maxAge time.Duration
+
+	// content types which may be served
+	allowedTypes map[string]bool
+
+	// only serve cached images
+	readOnly bool
+
+	// only serve cached images to clients. The analyzer fetches and
+	// transforms them during the updates
+	transformOnUpdate bool
+
+	// directories file:// links may point into, with resolved symlinks
+	localDirectories []string
+
+	// sources signing the urls of their images or adding credentials
+	// to the requests, by source id
+	signers     map[string]ImageUrlSigner
+	authorizers map[string]ImageRequestAuthorizer
+	signersMtx  *sync.RWMutex
+
+	// sources whose blocks may link local files, by source id. The
+	// content of other sources is controlled by third parties
+	fileOrigins map[string]bool
 
 	operations    map[string]*downloadOperation
 	operationsMtx *sync.Mutex
+
+	// decoded metadata of cached images, keyed by cache key
+	metadata    map[string]*ImageMetadata
+	metadataMtx *sync.RWMutex
+}
+
+// dimensions and format of a cached image
+type ImageMetadata struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	// hash of the transformed image. Missing in entries of older versions
+	Hash string `json:"hash,omitempty"`
+}
+
+// file name of the image derived from its content, so it changes
+// whenever the image changes. Empty when the hash is not known
+func (meta *ImageMetadata) FileName() string {
+	if meta.Hash == "" {
+		return ""
+	}
+	extension := meta.Format
+	if extension == "jpeg" {
+		extension = "jpg"
+	}
+	return meta.Hash + "." + extension
 }
 
 // create a caching and resizing image proxy
 func NewImgProxy(c *Configuration, cache Cache) (imgProxy *ImgProxy, err error) {
 	imgProxy = &ImgProxy{
-		cache: cache,
-		transformOptions: &imageproxy.Options{
-			Width:          float64(c.Image.Maxwidth),
-			Height:         float64(c.Image.Maxheight),
-			Fit:            false,
-			Rotate:         0,
-			FlipVertical:   false,
-			FlipHorizontal: false,
-			Quality:        c.Image.Quality,
-			Signature:      "",
-		},
+		cache:         cache,
+		transform:     newImageTransform(&c.Image),
+		client:        newUpstreamClient(c.Image.MaxRedirects, 0),
+		maxAge:        time.Second * time.Duration(c.Cache.MaxAge),
+		readOnly:      c.ReadOnly,
+		allowedTypes:  make(map[string]bool),
 		operations:    make(map[string]*downloadOperation),
 		operationsMtx: new(sync.Mutex),
+		metadata:      make(map[string]*ImageMetadata),
+		metadataMtx:   new(sync.RWMutex),
+		signersMtx:    new(sync.RWMutex),
+	}
+	for _, contentType := range c.Image.AllowedTypes {
+		imgProxy.allowedTypes[contentType] = true
+	}
+	imgProxy.transformOnUpdate = c.Image.TransformOnUpdate
+	imgProxy.offload, err = newImageOffload(&c.Image)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range c.Image.LocalDirectories {
+		resolved, resolveErr := filepath.Abs(dir)
+		if resolveErr == nil {
+			resolved, resolveErr = filepath.EvalSymlinks(resolved)
+		}
+		if resolveErr != nil {
+			return nil, fmt.Errorf("Unusable local image directory %v: %w", dir, resolveErr)
+		}
+		imgProxy.localDirectories = append(imgProxy.localDirectories, resolved)
 	}
 	return
 }
 
-// id for a url to use in the cache
-func (ipw *ImgProxy) cacheKey(url string) string {
+// detect the content type of data from its first bytes
+func sniffContentType(data []byte) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return contentType
+}
+
+// check if the content type of a response may be served
+func (ipw *ImgProxy) isAllowedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && ipw.allowedTypes[mediaType]
+}
+
+// id for a url to use in the cache. The images of sources signing
+// their urls or authorizing the requests are cached per source, so
+// blocks of other sources linking to the same url do not get them
+// from the cache.
+func (ipw *ImgProxy) cacheKey(ctx context.Context, url string) string {
 	h := sha1.New()
 	io.WriteString(h, url)
 	io.WriteString(h, "|")
-	io.WriteString(h, ipw.transformOptions.String())
+	io.WriteString(h, ipw.transform.String())
+	if ipw.offload != nil {
+		io.WriteString(h, "|")
+		io.WriteString(h, ipw.offload.String())
+	}
+	if originId := imageOriginId(ctx); originId != "" && ipw.hasCredentials(originId) {
+		io.WriteString(h, "|")
+		io.WriteString(h, originId)
+	}
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// key of the metadata entry of an image in the cache
+func metadataCacheKey(cacheKey string) string {
+	return cacheKey + ".meta"
+}
+
 // schedule an image to be fetched from upstream.
 // this method returns a channel on which the download can be received.
 // multiple request for the same url will be pooled, so an url
 // is downloaded only once.
 // The downloaded image will be transformed and cached.
-func (ipw *ImgProxy) fetchFromUpstream(url string) chan *download {
+//
+// Listeners which are not interested in the download anymore call the
+// returned detach function. The upstream transfer is cancelled when
+// the last listener detached. ctx is the one of the request asking for
+// the image, the download itself is not cancelled with it. The log
+// messages of the download carry the id of the request starting it.
+func (ipw *ImgProxy) fetchFromUpstream(ctx context.Context, url string) (downstreamChan chan *download, detach func()) {
 	ipw.operationsMtx.Lock()
 	defer ipw.operationsMtx.Unlock()
 
-	dlOp, found := ipw.operations[url]
+	// downloads for blocks of different sources are not pooled, as
+	// only the source of the block may sign the url
+	operationKey := imageOriginId(ctx) + " " + url
+	dlOp, found := ipw.operations[operationKey]
+	if found && dlOp.ctx.Err() != nil {
+		// all listeners of the running download detached
+		found = false
+	}
 	if !found {
 		dlOp = new(downloadOperation)
 		dlOp.modifyMtx = new(sync.Mutex)
+		detached := contextWithImageOrigin(contextWithRequestId(context.Background(), RequestId(ctx)), imageOriginId(ctx))
+		dlOp.ctx, dlOp.cancel = context.WithCancel(detached)
+	} else if startedBy := RequestId(dlOp.ctx); startedBy != "" {
+		requestDebugf(ctx, "Waiting for the download of %s started by request %v", loggableUrl(url), startedBy)
 	}
 
 	dlOp.modifyMtx.Lock()
-	downstreamChan := make(chan *download)
+	// buffered, so sending the result does not block on detached listeners
+	downstreamChan = make(chan *download, 1)
 	dlOp.downstreamChans = append(dlOp.downstreamChans, downstreamChan)
 	dlOp.modifyMtx.Unlock()
 
 	if !found {
-		ipw.operations[url] = dlOp
-		go ipw.downloadAndCache(url, dlOp)
+		ipw.operations[operationKey] = dlOp
+		go ipw.downloadAndCache(url, operationKey, dlOp)
+	}
+	detach = func() {
+		dlOp.modifyMtx.Lock()
+		defer dlOp.modifyMtx.Unlock()
+		for i, c := range dlOp.downstreamChans {
+			if c == downstreamChan {
+				dlOp.downstreamChans = append(dlOp.downstreamChans[:i], dlOp.downstreamChans[i+1:]...)
+				break
+			}
+		}
+		if len(dlOp.downstreamChans) == 0 {
+			dlOp.cancel()
+		}
 	}
-	return downstreamChan
+	return
 }
 
-func (ipw *ImgProxy) downloadAndCache(url string, dlOp *downloadOperation) {
-	downloadedData := new(download)
-	cacheKey := ipw.cacheKey(url)
-
-	//log.Printf("Downloading %s (%s)", url, cacheKey)
-	upstreamResp, err := http.Get(url)
-	if err == nil {
-		defer upstreamResp.Body.Close()
-
-		imgData, err := ioutil.ReadAll(upstreamResp.Body)
-		if err == nil {
-			buf := new(bytes.Buffer)
-			fmt.Fprintf(buf, "%s %s\n", upstreamResp.Proto, upstreamResp.Status)
-			upstreamResp.Header.WriteSubset(buf, map[string]bool{"Content-Length": true})
-
-			transformedImgData, err := imageproxy.Transform(imgData, *ipw.transformOptions)
-			if err != nil {
-				log.Printf("Unable to transform image from %s: %v", url, err)
-				// return original response from server
-				fmt.Fprintf(buf, "Content-Length: %d\n\n", len(imgData))
-				buf.Write(imgData)
-				ipw.cache.Delete(cacheKey)
-			} else {
-				// put transformed image in the cache and return transformed image
-				fmt.Fprintf(buf, "Content-Length: %d\n\n", len(transformedImgData))
-				buf.Write(transformedImgData)
-
-				if upstreamResp.StatusCode < 400 {
-					ipw.cache.Set(cacheKey, buf.Bytes())
-				}
-			}
-			downloadedData.httpResponseData = buf.Bytes()
-		} else {
-			log.Printf("unable to read body of download from %s: %v", url, err)
-			downloadedData.err = err
+// upstream headers which are kept in the cache entries. Everything else,
+// like cookies or CORS and HSTS headers, is specific to the upstream
+// server and must not be replayed from honeybee's origin.
+var persistedHeaders = []string{"Content-Type", "Etag", "Last-Modified", "Expires"}
+
+// serialize a http response in the format used for the cache entries
+func serializeResponse(proto string, status string, header http.Header, body []byte) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %s\n", proto, status)
+	sanitizedHeader := make(http.Header)
+	for _, key := range persistedHeaders {
+		if value := header.Get(key); value != "" {
+			sanitizedHeader.Set(key, value)
+		}
+	}
+	sanitizedHeader.Write(buf)
+	fmt.Fprintf(buf, "%s: %s\n", cachedAtHeader, time.Now().UTC().Format(http.TimeFormat))
+	fmt.Fprintf(buf, "Content-Length: %d\n\n", len(body))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// ImageUrlSigner is implemented by sources whose images can only be
+// fetched using signed urls, f.e. from private buckets. Blocks keep the
+// unsigned urls, so cached images stay valid when signatures expire.
+type ImageUrlSigner interface {
+	// sign the url when it belongs to the source. Only asked for the
+	// images of the blocks of the source.
+	SignImageUrl(url string) (signed string, ok bool)
+}
+
+// ImageRequestAuthorizer is implemented by sources whose images can
+// only be fetched with credentials in the headers of the requests, like
+// the api key of a self-hosted server.
+type ImageRequestAuthorizer interface {
+	// headers to send when the url belongs to the source, nil otherwise.
+	// Only asked for the images of the blocks of the source.
+	ImageRequestHeader(url string) http.Header
+}
+
+type imageOriginKey struct{}
+
+// context for fetching the image of a block of the source with the id
+// originId. Only this source may sign the url of the image, so blocks of
+// other sources linking to the same server do not get its private images.
+func contextWithImageOrigin(ctx context.Context, originId string) context.Context {
+	if originId == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, imageOriginKey{}, originId)
+}
+
+// context for fetching the image of a block
+func contextForBlockImage(ctx context.Context, block *Block) context.Context {
+	if block.Origin == nil {
+		return ctx
+	}
+	return contextWithImageOrigin(ctx, block.Origin.Id())
+}
+
+// the id of the source of the block whose image is fetched. Empty for
+// images which do not belong to a block
+func imageOriginId(ctx context.Context) string {
+	id, _ := ctx.Value(imageOriginKey{}).(string)
+	return id
+}
+
+// use the sources implementing ImageUrlSigner to sign image urls and
+// the ones implementing ImageRequestAuthorizer to authorize requests.
+// Only the images of manual sources may be loaded from file:// links.
+func (ipw *ImgProxy) SetUrlSigners(sources Sources) {
+	signers := make(map[string]ImageUrlSigner)
+	authorizers := make(map[string]ImageRequestAuthorizer)
+	fileOrigins := make(map[string]bool)
+	for _, source := range sources.Unfiltered() {
+		if source.Type() == ManualSourceType {
+			fileOrigins[source.Id()] = true
 		}
-	} else {
-		log.Printf("unable to download %s: %v", url, err)
-		downloadedData.err = err
+		if signer, ok := source.(ImageUrlSigner); ok {
+			signers[source.Id()] = signer
+		}
+		if authorizer, ok := source.(ImageRequestAuthorizer); ok {
+			authorizers[source.Id()] = authorizer
+		}
+	}
+	ipw.signersMtx.Lock()
+	ipw.signers = signers
+	ipw.authorizers = authorizers
+	ipw.fileOrigins = fileOrigins
+	ipw.signersMtx.Unlock()
+}
+
+// check if the blocks of a source may link local files
+func (ipw *ImgProxy) mayLoadFiles(originId string) bool {
+	ipw.signersMtx.RLock()
+	defer ipw.signersMtx.RUnlock()
+	return ipw.fileOrigins[originId]
+}
+
+// check if a source signs the urls of its images or authorizes the
+// requests for them
+func (ipw *ImgProxy) hasCredentials(originId string) bool {
+	ipw.signersMtx.RLock()
+	defer ipw.signersMtx.RUnlock()
+	_, signs := ipw.signers[originId]
+	_, authorizes := ipw.authorizers[originId]
+	return signs || authorizes
+}
+
+// credentials to send with the request of an image, added by the source
+// of its block. nil for most images
+func (ipw *ImgProxy) requestHeader(ctx context.Context, url string) http.Header {
+	ipw.signersMtx.RLock()
+	authorizer, found := ipw.authorizers[imageOriginId(ctx)]
+	ipw.signersMtx.RUnlock()
+	if !found {
+		return nil
+	}
+	return authorizer.ImageRequestHeader(url)
+}
+
+// check if an image is fetched through the offload service. Images
+// requiring credentials are fetched and transformed by honeybee, so the
+// credentials are not passed on.
+func (ipw *ImgProxy) offloads(ctx context.Context, url string) bool {
+	return ipw.offload != nil && ipw.requestHeader(ctx, url) == nil
+}
+
+// url to download an image from, signed by the source of its block
+func (ipw *ImgProxy) signedUrl(ctx context.Context, url string) string {
+	ipw.signersMtx.RLock()
+	signer, found := ipw.signers[imageOriginId(ctx)]
+	ipw.signersMtx.RUnlock()
+	if !found {
+		return url
 	}
+	if signed, ok := signer.SignImageUrl(url); ok {
+		return signed
+	}
+	return url
+}
 
-	// remove the download from the operations map
+// build a conditional request for an url using the validators of a
+// previously cached response. Returns a plain request if nothing is cached.
+func (ipw *ImgProxy) upstreamRequest(ctx context.Context, url string, cacheKey string) (req *http.Request, cached *http.Response, cachedBody []byte, err error) {
+	upstreamUrl := ipw.signedUrl(ctx, url)
+	if ipw.offloads(ctx, url) {
+		upstreamUrl = ipw.offload.Url(upstreamUrl)
+	}
+	req, err = http.NewRequestWithContext(ctx, "GET", upstreamUrl, nil)
+	if err != nil {
+		return
+	}
+	for key, values := range ipw.requestHeader(ctx, url) {
+		req.Header[key] = values
+	}
+	cachedData, ok := ipw.cache.Get(cacheKey)
+	if !ok {
+		return
+	}
+	resp, readErr := http.ReadResponse(bufio.NewReader(bytes.NewBuffer(cachedData)), req)
+	if readErr != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, readErr := ioutil.ReadAll(resp.Body)
+	if readErr != nil {
+		return
+	}
+	etag := resp.Header.Get("Etag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	return req, resp, body, nil
+}
+
+func (ipw *ImgProxy) downloadAndCache(url string, operationKey string, dlOp *downloadOperation) {
+	downloadedData := new(download)
+	downloadedData.httpResponseData, downloadedData.err = ipw.download(dlOp.ctx, url)
+	if errors.Is(downloadedData.err, context.Canceled) {
+		requestDebugf(dlOp.ctx, "Cancelled the download of %s, nobody is waiting for it", loggableUrl(url))
+	} else if downloadedData.err != nil {
+		requestInfof(dlOp.ctx, "unable to download %s: %v", loggableUrl(url), downloadedData.err)
+	}
+	dlOp.cancel()
+
+	// remove the download from the operations map, unless it
+	// got replaced after all listeners detached
 	ipw.operationsMtx.Lock()
-	delete(ipw.operations, url)
+	if ipw.operations[operationKey] == dlOp {
+		delete(ipw.operations, operationKey)
+	}
 	ipw.operationsMtx.Unlock()
 
 	dlOp.modifyMtx.Lock()
@@ -149,10 +447,100 @@ func (ipw *ImgProxy) downloadAndCache(url string, dlOp *downloadOperation) {
 	}
 }
 
+// download an image, transform it and put it in the cache. Returns the
+// serialized http response.
+func (ipw *ImgProxy) download(ctx context.Context, url string) (data []byte, err error) {
+	cacheKey := ipw.cacheKey(ctx, url)
+	if loader := localLoaderFor(url); loader != nil {
+		return ipw.loadLocal(ctx, url, cacheKey, loader)
+	}
+
+	requestDebugf(ctx, "Downloading %s (cacheKey: %s)", url, cacheKey)
+	req, cached, cachedBody, err := ipw.upstreamRequest(ctx, url, cacheKey)
+	if err != nil {
+		return
+	}
+	upstreamResp, err := ipw.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer upstreamResp.Body.Close()
+
+	if upstreamResp.StatusCode == http.StatusNotModified && cached != nil {
+		// the cached image is still current, only renew its timestamp
+		requestDebugf(ctx, "Not modified: %s (cacheKey: %s)", loggableUrl(url), cacheKey)
+		data = serializeResponse(cached.Proto, cached.Status, cached.Header, cachedBody)
+		ipw.cache.Set(cacheKey, data)
+		return
+	}
+
+	imgData, err := ioutil.ReadAll(upstreamResp.Body)
+	if err != nil {
+		return
+	}
+	// images fetched from the offload service are resized already
+	return ipw.transformAndCache(ctx, url, cacheKey, upstreamResp, imgData, !ipw.offloads(ctx, url))
+}
+
+// transform the image data of a response and put it in the cache.
+// Returns the serialized http response.
+func (ipw *ImgProxy) transformAndCache(ctx context.Context, url string, cacheKey string, upstreamResp *http.Response, imgData []byte, transform bool) (data []byte, err error) {
+	// the image may have changed, so the metadata has to be decoded again
+	ipw.forgetMetadata(cacheKey)
+
+	// do not trust the content type sent by the upstream server
+	contentType := sniffContentType(imgData)
+	if !ipw.isAllowedType(contentType) {
+		ipw.cache.Delete(cacheKey)
+		return nil, fmt.Errorf("Refusing content of type %s", contentType)
+	}
+	upstreamResp.Header.Set("Content-Type", contentType)
+	if !transform {
+		data = serializeResponse(upstreamResp.Proto, upstreamResp.Status, upstreamResp.Header, imgData)
+		if upstreamResp.StatusCode < 400 {
+			ipw.cache.Set(cacheKey, data)
+		}
+		return
+	}
+
+	transformedImgData, transformErr := ipw.transform.Transform(imgData, contentType)
+	if transformErr != nil {
+		requestInfof(ctx, "Unable to transform image from %s: %v", loggableUrl(url), transformErr)
+		// return original response from server
+		ipw.cache.Delete(cacheKey)
+		data = serializeResponse(upstreamResp.Proto, upstreamResp.Status, upstreamResp.Header, imgData)
+		return
+	}
+
+	requestDebugf(ctx, "Transformed image from %s using %s", loggableUrl(url), ipw.transform)
+	// put transformed image in the cache and return transformed image
+	upstreamResp.Header.Set("Content-Type", sniffContentType(transformedImgData))
+	data = serializeResponse(upstreamResp.Proto, upstreamResp.Status, upstreamResp.Header, transformedImgData)
+	if upstreamResp.StatusCode < 400 {
+		ipw.cache.Set(cacheKey, data)
+	}
+	return
+}
+
 // load an external image or fetch it from the cache
 // and write it to the ResponseWriter
 func (ipw *ImgProxy) ProxyImage(w http.ResponseWriter, req *http.Request, url string) (err error) {
-	cacheKey := ipw.cacheKey(url)
+	return ipw.proxyImage(w, req, url, true, "")
+}
+
+// write an image requested by a client to the ResponseWriter. With
+// transform-on-update, images which are not cached are not fetched
+// and ErrImageNotCached is returned. Successful responses are marked
+// as immutable when file is the name derived from the content of the
+// served image, as the url requested with it changes with the image.
+func (ipw *ImgProxy) ServeImage(w http.ResponseWriter, req *http.Request, url string, file string) (err error) {
+	return ipw.proxyImage(w, req, url, !ipw.transformOnUpdate, file)
+}
+
+// write an image to the ResponseWriter. Missing and stale images are
+// only fetched from upstream when fetch is set.
+func (ipw *ImgProxy) proxyImage(w http.ResponseWriter, req *http.Request, url string, fetch bool, file string) (err error) {
+	cacheKey := ipw.cacheKey(req.Context(), url)
 	xCacheHeader := "HIT"
 
 	var resp *http.Response
@@ -163,20 +551,45 @@ func (ipw *ImgProxy) ProxyImage(w http.ResponseWriter, req *http.Request, url st
 		b := bytes.NewBuffer(cachedData)
 		resp, err = http.ReadResponse(bufio.NewReader(b), req)
 		if err != nil {
-			log.Printf("Unable to read cached entry for %s: %v (cacheKey: %s)", url, err, cacheKey)
+			requestInfof(req.Context(), "Unable to read cached entry for %s: %v (cacheKey: %s)", loggableUrl(url), err, cacheKey)
 
 			// remove any invalid data from the cache and
 			// fetch it fresh from upstream
 			ipw.cache.Delete(cacheKey)
 			resp = nil
+		} else if !ipw.isAllowedType(resp.Header.Get("Content-Type")) {
+			// written before the content type was checked
+			requestInfof(req.Context(), "Unexpected content type in cached entry for %s (cacheKey: %s)", loggableUrl(url), cacheKey)
+			ipw.cache.Delete(cacheKey)
+			resp = nil
+		} else if ipw.isStale(resp) && !ipw.readOnly && fetch {
+			// serve the stale entry and refresh it in the background
+			xCacheHeader = "STALE"
+			ipw.revalidate(req.Context(), url)
 		}
 	}
 
 	// fetch from upstream
 	if resp == nil {
 		xCacheHeader = "MISS"
+		if ipw.readOnly {
+			requestDebugf(req.Context(), "%s %s (cacheKey: %s)", xCacheHeader, loggableUrl(url), cacheKey)
+			return ErrReadOnly
+		}
+		if !fetch {
+			requestDebugf(req.Context(), "%s %s (cacheKey: %s)", xCacheHeader, loggableUrl(url), cacheKey)
+			return ErrImageNotCached
+		}
 
-		downloadedData := <-ipw.fetchFromUpstream(url)
+		// abandon the download when the client goes away
+		downloadChan, detach := ipw.fetchFromUpstream(req.Context(), url)
+		var downloadedData *download
+		select {
+		case downloadedData = <-downloadChan:
+		case <-req.Context().Done():
+			detach()
+			return req.Context().Err()
+		}
 		if downloadedData.err != nil {
 			return downloadedData.err
 		}
@@ -186,6 +599,8 @@ func (ipw *ImgProxy) ProxyImage(w http.ResponseWriter, req *http.Request, url st
 		}
 	}
 
+	requestDebugf(req.Context(), "%s %s (cacheKey: %s)", xCacheHeader, loggableUrl(url), cacheKey)
+
 	// write to responsewriter
 	copyHeader(w, resp, "Last-Modified")
 	copyHeader(w, resp, "Expires")
@@ -199,17 +614,121 @@ func (ipw *ImgProxy) ProxyImage(w http.ResponseWriter, req *http.Request, url st
 
 	copyHeader(w, resp, "Content-Length")
 	copyHeader(w, resp, "Content-Type")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if file != "" && resp.StatusCode == http.StatusOK {
+		// errors of the upstream server and images changed since the
+		// analysis of the block must not be kept by caches
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if file == imageHash(body)+filepath.Ext(file) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
 	w.WriteHeader(resp.StatusCode)
 	io.Copy(w, resp.Body)
 
 	return nil
 }
 
+// check if a cached response is older than the configured maximum age
+func (ipw *ImgProxy) isStale(resp *http.Response) bool {
+	if ipw.maxAge <= 0 {
+		return false
+	}
+	cachedAt, err := http.ParseTime(resp.Header.Get(cachedAtHeader))
+	if err != nil {
+		// entries without a timestamp were written by older versions
+		return true
+	}
+	return time.Since(cachedAt) > ipw.maxAge
+}
+
+// refresh the cache entry for an url asynchronously. The upstream server
+// is asked conditionally, so unchanged images are not downloaded again.
+// Concurrent refreshes of the same url are pooled by fetchFromUpstream.
+func (ipw *ImgProxy) revalidate(ctx context.Context, url string) {
+	go func() {
+		downloadChan, _ := ipw.fetchFromUpstream(ctx, url)
+		downloadedData := <-downloadChan
+		if downloadedData.err != nil {
+			requestInfof(ctx, "Unable to refresh stale cache entry for %s: %v", loggableUrl(url), downloadedData.err)
+		}
+	}()
+}
+
+// fetch an image which is missing in the cache or stale and wait
+// until it has been transformed and cached
+func (ipw *ImgProxy) warm(ctx context.Context, url string) error {
+	if ipw.readOnly {
+		return nil
+	}
+	if data, ok := ipw.cache.Get(ipw.cacheKey(ctx, url)); ok {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+		if err == nil && ipw.isAllowedType(resp.Header.Get("Content-Type")) && !ipw.isStale(resp) {
+			return nil
+		}
+	}
+	downloadChan, _ := ipw.fetchFromUpstream(ctx, url)
+	return (<-downloadChan).err
+}
+
 // return a image.Config instance of a cached image. If the image
 // is not in the cache it will be fetched
 func (ipw *ImgProxy) GetImageConfig(url string) (cfg image.Config, err error) {
+	meta, err := ipw.GetImageMetadata(url)
+	if err != nil {
+		return
+	}
+	cfg.Width = meta.Width
+	cfg.Height = meta.Height
+	return
+}
+
+// return the dimensions and format of an image. The metadata is kept in
+// memory and in the cache, so the image only needs to be decoded once.
+func (ipw *ImgProxy) GetImageMetadata(url string) (meta *ImageMetadata, err error) {
+	return ipw.imageMetadata(context.Background(), url)
+}
+
+// the metadata of an image, which is fetched using ctx when it is
+// not cached
+func (ipw *ImgProxy) imageMetadata(ctx context.Context, url string) (meta *ImageMetadata, err error) {
+	cacheKey := ipw.cacheKey(ctx, url)
+
+	ipw.metadataMtx.RLock()
+	meta, found := ipw.metadata[cacheKey]
+	ipw.metadataMtx.RUnlock()
+	if found {
+		return
+	}
+
+	if data, ok := ipw.cache.Get(metadataCacheKey(cacheKey)); ok {
+		meta = new(ImageMetadata)
+		if json.Unmarshal(data, meta) == nil {
+			ipw.rememberMetadata(cacheKey, meta)
+			return
+		}
+		ipw.cache.Delete(metadataCacheKey(cacheKey))
+	}
+
+	meta, err = ipw.decodeMetadata(ctx, url)
+	if err != nil {
+		return
+	}
+	if data, jsonErr := json.Marshal(meta); jsonErr == nil {
+		ipw.cache.Set(metadataCacheKey(cacheKey), data)
+	}
+	ipw.rememberMetadata(cacheKey, meta)
+	return
+}
+
+// decode the metadata of an image by replaying it through the proxy
+func (ipw *ImgProxy) decodeMetadata(ctx context.Context, url string) (meta *ImageMetadata, err error) {
 	var dummyReq *http.Request
-	dummyReq, err = http.NewRequest("GET", url, nil)
+	dummyReq, err = http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return
 	}
@@ -218,10 +737,51 @@ func (ipw *ImgProxy) GetImageConfig(url string) (cfg image.Config, err error) {
 	if err != nil {
 		return
 	}
-	cfg, _, err = image.DecodeConfig(bufio.NewReader(recorder.Body))
+	hash := imageHash(recorder.Body.Bytes())
+	cfg, format, err := image.DecodeConfig(bufio.NewReader(recorder.Body))
+	if err != nil {
+		return
+	}
+	meta = &ImageMetadata{
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Format: format,
+		Hash:   hash,
+	}
+	return
+}
+
+// hash of the content of a transformed image as used in its file name
+func imageHash(data []byte) string {
+	h := sha1.Sum(data)
+	return hex.EncodeToString(h[:8])
+}
+
+// keys of all cache entries belonging to the blocks
+func (ipw *ImgProxy) CacheKeys(blocks []*Block) (keys []string) {
+	for _, block := range blocks {
+		keys = append(keys, shareImageCacheKey(block))
+		if block.HasImage() {
+			cacheKey := ipw.cacheKey(contextForBlockImage(context.Background(), block), block.ImageLink)
+			keys = append(keys, cacheKey, metadataCacheKey(cacheKey))
+		}
+	}
 	return
 }
 
+func (ipw *ImgProxy) rememberMetadata(cacheKey string, meta *ImageMetadata) {
+	ipw.metadataMtx.Lock()
+	ipw.metadata[cacheKey] = meta
+	ipw.metadataMtx.Unlock()
+}
+
+func (ipw *ImgProxy) forgetMetadata(cacheKey string) {
+	ipw.metadataMtx.Lock()
+	delete(ipw.metadata, cacheKey)
+	ipw.metadataMtx.Unlock()
+	ipw.cache.Delete(metadataCacheKey(cacheKey))
+}
+
 func copyHeader(w http.ResponseWriter, r *http.Response, header string) {
 	key := http.CanonicalHeaderKey(header)
 	if value, ok := r.Header[key]; ok {
@@ -256,53 +816,95 @@ func check304(req *http.Request, resp *http.Response) bool {
 	return false
 }
 
+// number of analyzed images by result, "ok" or "failed"
+var imagesAnalyzedVar = expvar.NewMap("honeybee_images_analyzed")
+
+// ImageAnalyzer fills the image dimensions of the blocks it receives.
+// ReceiveBlocks may be called concurrently by multiple sources.
 type ImageAnalyzer struct {
-	imgProxy  *ImgProxy
-	outBlocks []*Block
+	imgProxy     *ImgProxy
+	outBlocks    []*Block
+	outBlocksMtx *sync.Mutex
 }
 
 func NewImageAnalyzer(imgProxy *ImgProxy) (ia *ImageAnalyzer) {
 	return &ImageAnalyzer{
-		imgProxy: imgProxy,
+		imgProxy:     imgProxy,
+		outBlocksMtx: new(sync.Mutex),
 	}
 }
 
-func (ia *ImageAnalyzer) ReceiveBlocks(blocks []*Block) { // TODO: rename to seed
-	in_chan := make(chan *Block)
-
-	analyzeImageworker := func(in_chan chan *Block) {
-		for block := range in_chan {
-			block.ModifyMtx.Lock()
-			defer block.ModifyMtx.Unlock()
-
-			if block.HasImage() == false {
-				continue
-			}
+// fill the image dimensions of a single block
+func (ia *ImageAnalyzer) analyzeBlock(block *Block) {
+	block.ModifyMtx.Lock()
+	defer block.ModifyMtx.Unlock()
 
-			image_cfg, err := ia.imgProxy.GetImageConfig(block.ImageLink)
-			if err != nil {
-				log.Printf("Could not analyze image from %v. Cause: %v", block.ImageLink, err)
-				continue
-			}
+	if block.HasImage() == false {
+		return
+	}
 
-			block.ImageWidth = image_cfg.Width
-			block.ImageHeight = image_cfg.Height
+	ctx := contextForBlockImage(context.Background(), block)
+	if ia.imgProxy.transformOnUpdate {
+		// a failed download keeps the previously cached image
+		if err := ia.imgProxy.warm(ctx, block.ImageLink); err != nil {
+			logInfof("Could not fetch image from %v. Cause: %v", loggableUrl(block.ImageLink), err)
 		}
 	}
 
+	meta, err := ia.imgProxy.imageMetadata(ctx, block.ImageLink)
+	if err != nil {
+		logInfof("Could not analyze image from %v. Cause: %v", loggableUrl(block.ImageLink), err)
+		imagesAnalyzedVar.Add("failed", 1)
+		return
+	}
+	imagesAnalyzedVar.Add("ok", 1)
+
+	block.ImageWidth = meta.Width
+	block.ImageHeight = meta.Height
+	block.ImageFile = meta.FileName()
+}
+
+// analyze the images of the blocks. Returns after all blocks
+// have been analyzed.
+func (ia *ImageAnalyzer) ReceiveBlocks(blocks []*Block) { // TODO: rename to seed
+	ia.analyzeBlocks(blocks)
+
+	ia.outBlocksMtx.Lock()
+	ia.outBlocks = append(ia.outBlocks, blocks...)
+	ia.outBlocksMtx.Unlock()
+}
+
+// analyze the blocks using a pool of workers
+func (ia *ImageAnalyzer) analyzeBlocks(blocks []*Block) {
+	in_chan := make(chan *Block)
+	wg := new(sync.WaitGroup)
+
 	// start workers
-	for wid := 0; wid < runtime.NumCPU()*2; wid++ {
-		go analyzeImageworker(in_chan)
+	numWorkers := runtime.NumCPU() * 2
+	if numWorkers > len(blocks) {
+		numWorkers = len(blocks)
+	}
+	for wid := 0; wid < numWorkers; wid++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for block := range in_chan {
+				ia.analyzeBlock(block)
+			}
+		}()
 	}
 
 	for _, block := range blocks {
 		in_chan <- block
 	}
 	close(in_chan)
-
-	ia.outBlocks = append(ia.outBlocks, blocks...)
+	wg.Wait()
 }
 
 func (ia *ImageAnalyzer) GetBlocks() ([]*Block, error) {
-	return ia.outBlocks, nil
+	ia.outBlocksMtx.Lock()
+	defer ia.outBlocksMtx.Unlock()
+	blocks := make([]*Block, len(ia.outBlocks))
+	copy(blocks, ia.outBlocks)
+	return blocks, nil
 }
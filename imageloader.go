@@ -0,0 +1,140 @@
+package honeybee
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maximum length of data: uris. Larger images should be linked instead
+const maxDataUriLength = 1024 * 1024
+
+// loads the data of images which are not fetched using http
+type localImageLoader func(ipw *ImgProxy, url string) (data []byte, modTime time.Time, err error)
+
+// loaders by url scheme
+var localImageLoaders = map[string]localImageLoader{
+	"file": loadFileImage,
+	"data": loadDataUriImage,
+}
+
+// find the loader for an url, nil for http urls
+func localLoaderFor(rawUrl string) localImageLoader {
+	scheme := rawUrl
+	if i := strings.Index(rawUrl, ":"); i >= 0 {
+		scheme = rawUrl[:i]
+	}
+	return localImageLoaders[strings.ToLower(scheme)]
+}
+
+// shorten data: uris for log messages
+func loggableUrl(url string) string {
+	if len(url) > 64 && strings.HasPrefix(url, "data:") {
+		return url[:64] + "..."
+	}
+	return url
+}
+
+// load an image without http and put it through the same transformation
+// and cache as downloaded images. Returns the serialized http response.
+func (ipw *ImgProxy) loadLocal(ctx context.Context, url string, cacheKey string, loader localImageLoader) (data []byte, err error) {
+	if strings.HasPrefix(strings.ToLower(url), "file:") && !ipw.mayLoadFiles(imageOriginId(ctx)) {
+		err = fmt.Errorf("file:// links are only supported for %v sources: %v", ManualSourceType, url)
+		return
+	}
+	requestDebugf(ctx, "Loading %s (cacheKey: %s)", loggableUrl(url), cacheKey)
+	imgData, modTime, err := loader(ipw, url)
+	if err != nil {
+		return
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+	}
+	if !modTime.IsZero() {
+		resp.Header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	// the offload service can not reach local images
+	return ipw.transformAndCache(ctx, url, cacheKey, resp, imgData, true)
+}
+
+// read an image from a file:// url. The file has to be located in
+// one of the configured local directories.
+func loadFileImage(ipw *ImgProxy, rawUrl string) (data []byte, modTime time.Time, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		err = fmt.Errorf("Files on other hosts are not supported: %v", u.Host)
+		return
+	}
+	// resolve symlinks, so they can not point out of the directories
+	path, err := filepath.EvalSymlinks(filepath.FromSlash(u.Path))
+	if err != nil {
+		return
+	}
+	if !ipw.isLocalPathAllowed(path) {
+		err = fmt.Errorf("File is outside of the local directories: %v", path)
+		return
+	}
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if finfo.IsDir() {
+		err = fmt.Errorf("%v is a directory", path)
+		return
+	}
+	data, err = ioutil.ReadFile(path)
+	return data, finfo.ModTime(), err
+}
+
+// check if a path is located in one of the local directories
+func (ipw *ImgProxy) isLocalPathAllowed(path string) bool {
+	for _, dir := range ipw.localDirectories {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decode the data of a data: uri. The media type of the uri is
+// ignored, as the content type is detected from the data.
+func loadDataUriImage(ipw *ImgProxy, rawUrl string) (data []byte, modTime time.Time, err error) {
+	if len(rawUrl) > maxDataUriLength {
+		err = fmt.Errorf("Data uri exceeds %d bytes", maxDataUriLength)
+		return
+	}
+	sep := strings.Index(rawUrl, ",")
+	if sep < 0 {
+		err = errors.New("Malformed data uri")
+		return
+	}
+	mediaType, encoded := rawUrl[len("data:"):sep], rawUrl[sep+1:]
+	if strings.HasSuffix(strings.ToLower(mediaType), ";base64") {
+		// tolerate percent-encoded and unpadded base64
+		if unescaped, unescapeErr := url.PathUnescape(encoded); unescapeErr == nil {
+			encoded = unescaped
+		}
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		return
+	}
+	unescaped, err := url.PathUnescape(encoded)
+	return []byte(unescaped), modTime, err
+}
@@ -0,0 +1,111 @@
+package honeybee
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// external services the resizing of images can be offloaded to
+const (
+	// https://github.com/willnorris/imageproxy
+	ImageproxyOffload = "imageproxy"
+	// https://github.com/imgproxy/imgproxy
+	ImgproxyOffload = "imgproxy"
+)
+
+// imageOffload builds the urls of an external service which fetches
+// and resizes the images. honeybee downloads and caches the resized
+// images from there as it does with the original ones.
+type imageOffload struct {
+	service string
+	baseUrl string
+	// key and salt of the signatures. Decoded from hex for imgproxy
+	key  []byte
+	salt []byte
+	// size and quality of the resized images
+	transform *imageTransform
+}
+
+// create the offloading for the configured service. Returns nil when
+// the images are transformed by honeybee itself.
+func newImageOffload(c *ImageConfiguration) (offload *imageOffload, err error) {
+	if c.Offload.Service == "" {
+		return nil, nil
+	}
+	if c.Offload.Url == "" {
+		return nil, fmt.Errorf("The url of the %v instance is not set", c.Offload.Service)
+	}
+	offload = &imageOffload{
+		service:   c.Offload.Service,
+		baseUrl:   strings.TrimSuffix(c.Offload.Url, "/"),
+		transform: newImageTransform(c),
+	}
+	switch c.Offload.Service {
+	case ImageproxyOffload:
+		offload.key = []byte(c.Offload.Key)
+	case ImgproxyOffload:
+		offload.key, err = hex.DecodeString(c.Offload.Key)
+		if err != nil {
+			return nil, fmt.Errorf("The imgproxy key must be hex encoded: %w", err)
+		}
+		offload.salt, err = hex.DecodeString(c.Offload.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("The imgproxy salt must be hex encoded: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown image offload service: %v", c.Offload.Service)
+	}
+	return
+}
+
+// description of the service, used for the keys of the cache
+func (o *imageOffload) String() string {
+	return o.service + ":" + o.baseUrl
+}
+
+// url of the resized image at the service
+func (o *imageOffload) Url(imageUrl string) string {
+	if o.service == ImgproxyOffload {
+		return o.imgproxyUrl(imageUrl)
+	}
+	return o.imageproxyUrl(imageUrl)
+}
+
+func (o *imageOffload) sign(data string) []byte {
+	mac := hmac.New(sha256.New, o.key)
+	mac.Write(o.salt)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// see https://pkg.go.dev/willnorris.com/go/imageproxy#hdr-URL_Structure.
+// The signature covers the url of the image. Without a key the
+// instance has to allow the hosts of the images instead.
+func (o *imageOffload) imageproxyUrl(imageUrl string) string {
+	options := o.transform.options
+	if len(o.key) > 0 {
+		options.Signature = base64.URLEncoding.EncodeToString(o.sign(imageUrl))
+	}
+	return o.baseUrl + "/" + options.String() + "/" + imageUrl
+}
+
+// see https://docs.imgproxy.net/usage/processing. Without a key the
+// signature is not checked by imgproxy.
+func (o *imageOffload) imgproxyUrl(imageUrl string) string {
+	options := o.transform.options
+	resizingType := "fill"
+	if options.Fit {
+		resizingType = "fit"
+	}
+	path := fmt.Sprintf("/rs:%v:%d:%d/q:%d/%v", resizingType, int(options.Width), int(options.Height),
+		options.Quality, base64.RawURLEncoding.EncodeToString([]byte(imageUrl)))
+	signature := "insecure"
+	if len(o.key) > 0 {
+		signature = base64.RawURLEncoding.EncodeToString(o.sign(path))
+	}
+	return o.baseUrl + "/" + signature + path
+}
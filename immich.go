@@ -0,0 +1,221 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ImmichAlbumSourceType = "immich-album"
+
+	// size of the thumbnails, about 1440 pixels wide
+	immichThumbnailSize = "preview"
+)
+
+// ImmichAlbumSource provides the photos and videos of an album of a
+// self-hosted Immich server. The thumbnails require the api key, which
+// the image proxy sends with its requests.
+type ImmichAlbumSource struct {
+	serverUrl string
+	// api key of a user with access to the album
+	key string
+	// id of the album, the uuid in its url
+	albumId string
+	limit   int
+}
+
+func NewImmichAlbumSource(params SourceParams) (is *ImmichAlbumSource, err error) {
+	is = &ImmichAlbumSource{
+		limit: 25,
+	}
+	for k, v := range params {
+		switch k {
+		case "url":
+			is.serverUrl = strings.TrimRight(v, "/")
+			if !strings.Contains(is.serverUrl, "://") {
+				is.serverUrl = "https://" + is.serverUrl
+			}
+		case "key":
+			is.key = v
+		case "album":
+			is.albumId = v
+		case "limit":
+			is.limit, err = strconv.Atoi(v)
+			if err != nil || is.limit < 1 {
+				err = fmt.Errorf("limit must be a positive number, not %v", v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", ImmichAlbumSourceType, k)
+			return
+		}
+	}
+	if is.serverUrl == "" {
+		err = errors.New("'url' parameter is not set")
+		return
+	}
+	if is.key == "" {
+		err = errors.New("'key' parameter is not set")
+		return
+	}
+	if is.albumId == "" {
+		err = errors.New("'album' parameter is not set")
+		return
+	}
+	return is, nil
+}
+
+func (is *ImmichAlbumSource) Type() string {
+	return ImmichAlbumSourceType
+}
+
+func (is *ImmichAlbumSource) Id() string {
+	return IdEncodeStrings(is.Type(), is.serverUrl, is.albumId)
+}
+
+func (is *ImmichAlbumSource) Upstreams() []string {
+	return []string{is.serverUrl}
+}
+
+// the own user is only returned for valid keys
+func (is *ImmichAlbumSource) CheckCredentials() error {
+	var user struct {
+		Id string `json:"id"`
+	}
+	return is.get("/api/users/me", &user)
+}
+
+// send the api key with the requests of the thumbnails of the server.
+// The image proxy only asks for the images of the blocks of the album,
+// and only urls of thumbnails get the key.
+func (is *ImmichAlbumSource) ImageRequestHeader(url string) http.Header {
+	prefix := is.serverUrl + "/api/assets/"
+	suffix := "/thumbnail?size=" + immichThumbnailSize
+	if !strings.HasPrefix(url, prefix) || !strings.HasSuffix(url, suffix) || len(url) <= len(prefix)+len(suffix) {
+		return nil
+	}
+	if assetId := url[len(prefix) : len(url)-len(suffix)]; strings.ContainsAny(assetId, "/?#") {
+		return nil
+	}
+	return http.Header{"X-Api-Key": {is.key}}
+}
+
+// immichError is returned for failed api requests
+type immichError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *immichError) Error() string {
+	return fmt.Sprintf("Immich API: %v", e.Message)
+}
+
+func (e *immichError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		// the server is self-hosted, often behind a reverse proxy
+		return ErrorKindNetwork
+	}
+	return ErrorKindOther
+}
+
+type immichAsset struct {
+	Id string `json:"id"`
+	// IMAGE, VIDEO, AUDIO or OTHER
+	Type             string    `json:"type"`
+	OriginalFileName string    `json:"originalFileName"`
+	FileCreatedAt    time.Time `json:"fileCreatedAt"`
+	IsTrashed        bool      `json:"isTrashed"`
+	ExifInfo         *struct {
+		Description string   `json:"description"`
+		Make        string   `json:"make"`
+		Model       string   `json:"model"`
+		City        string   `json:"city"`
+		Country     string   `json:"country"`
+		Latitude    *float64 `json:"latitude"`
+		Longitude   *float64 `json:"longitude"`
+	} `json:"exifInfo"`
+}
+
+// call the api and decode the json response
+func (is *ImmichAlbumSource) get(apiPath string, v interface{}) (err error) {
+	req, err := http.NewRequest("GET", is.serverUrl+apiPath, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Api-Key", is.key)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Message json.RawMessage `json:"message"`
+		}
+		message := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && len(errResp.Message) > 0 {
+			// validation errors come as a list of messages
+			message = strings.Trim(string(errResp.Message), `"[]`)
+		}
+		return &immichError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (is *ImmichAlbumSource) GetBlocks() (blocks []*Block, err error) {
+	var album struct {
+		Assets []immichAsset `json:"assets"`
+	}
+	err = is.get("/api/albums/"+is.albumId, &album)
+	if err != nil {
+		return
+	}
+
+	// the assets are ordered as arranged in the album
+	sort.SliceStable(album.Assets, func(i, j int) bool {
+		return album.Assets[i].FileCreatedAt.After(album.Assets[j].FileCreatedAt)
+	})
+	for _, asset := range album.Assets {
+		if len(blocks) >= is.limit {
+			break
+		}
+		if asset.IsTrashed || (asset.Type != "IMAGE" && asset.Type != "VIDEO") {
+			continue
+		}
+		block := NewBlock(is)
+		block.Title = strings.TrimSuffix(asset.OriginalFileName, path.Ext(asset.OriginalFileName))
+		block.Link = is.serverUrl + "/albums/" + is.albumId + "/photos/" + asset.Id
+		block.ImageLink = is.serverUrl + "/api/assets/" + asset.Id + "/thumbnail?size=" + immichThumbnailSize
+		block.TimeStamp = asset.FileCreatedAt.UTC()
+		if asset.Type == "VIDEO" {
+			block.Tags = append(block.Tags, VideoTag)
+		}
+		if exif := asset.ExifInfo; exif != nil {
+			if exif.Description != "" {
+				block.Title = exif.Description
+			}
+			block.SetMeta("camera", strings.TrimSpace(exif.Make+" "+exif.Model))
+			block.SetMeta("city", exif.City)
+			block.SetMeta("country", exif.Country)
+			if exif.Latitude != nil && exif.Longitude != nil {
+				block.SetMeta("latitude", strconv.FormatFloat(*exif.Latitude, 'f', -1, 64))
+				block.SetMeta("longitude", strconv.FormatFloat(*exif.Longitude, 'f', -1, 64))
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
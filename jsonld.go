@@ -0,0 +1,189 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// schema.org types of the blocks in the structured data of the pages
+const (
+	ImageObjectSchemaType        = "ImageObject"
+	SoftwareSourceCodeSchemaType = "SoftwareSourceCode"
+	ArticleSchemaType            = "Article"
+)
+
+// sources providing photos, whose blocks are described as images even
+// when they come with a description
+var photoSourceTypes = map[string]bool{
+	FlickrUserPhotosetSourceType:      true,
+	FiveHundredPxUserPhotosSourceType: true,
+	ImmichAlbumSourceType:             true,
+	PhotoPrismAlbumSourceType:         true,
+	PixelfedAccountSourceType:         true,
+	WikimediaCommonsUserSourceType:    true,
+	S3BucketSourceType:                true,
+}
+
+// the schema.org type describing a block: software projects carry their
+// programming language, photos come from the photo sources or have no
+// text besides the title. Everything else is an article.
+func (b *Block) SchemaType() string {
+	if b.Language != "" {
+		return SoftwareSourceCodeSchemaType
+	}
+	if b.Origin != nil {
+		switch b.Origin.Type() {
+		case GithubUserReposSourceType, GiteaUserReposSourceType:
+			return SoftwareSourceCodeSchemaType
+		}
+		if photoSourceTypes[b.Origin.Type()] && b.HasImage() {
+			return ImageObjectSchemaType
+		}
+	}
+	if b.HasImage() && b.Content == "" && b.HtmlContent == "" {
+		return ImageObjectSchemaType
+	}
+	return ArticleSchemaType
+}
+
+type jsonLdPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type jsonLdBlock struct {
+	Context          string        `json:"@context,omitempty"`
+	Type             string        `json:"@type"`
+	Name             string        `json:"name,omitempty"`
+	Headline         string        `json:"headline,omitempty"`
+	Description      string        `json:"description,omitempty"`
+	Url              string        `json:"url,omitempty"`
+	MainEntityOfPage string        `json:"mainEntityOfPage,omitempty"`
+	DatePublished    string        `json:"datePublished,omitempty"`
+	Author           *jsonLdPerson `json:"author,omitempty"`
+	License          string        `json:"license,omitempty"`
+	Keywords         string        `json:"keywords,omitempty"`
+	// ImageObject
+	ContentUrl string `json:"contentUrl,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	CreditText string `json:"creditText,omitempty"`
+	// Article
+	Image string `json:"image,omitempty"`
+	// SoftwareSourceCode
+	CodeRepository      string `json:"codeRepository,omitempty"`
+	ProgrammingLanguage string `json:"programmingLanguage,omitempty"`
+}
+
+type jsonLdListItem struct {
+	Type     string       `json:"@type"`
+	Position int          `json:"position"`
+	Item     *jsonLdBlock `json:"item"`
+}
+
+type jsonLdItemList struct {
+	Context         string           `json:"@context"`
+	Type            string           `json:"@type"`
+	ItemListElement []jsonLdListItem `json:"itemListElement"`
+}
+
+// absolute url of the image of a block as linked by the pages. Empty
+// for images served by honeybee when the public url is not configured
+func absoluteImageUrl(config *Configuration, block *Block) string {
+	if block.DirectImage {
+		return block.ImageLink
+	}
+	if config.Http.PublicUrl == "" {
+		return ""
+	}
+	return strings.TrimRight(config.Http.PublicUrl, "/") + "/" + imageUrl(block)
+}
+
+// permalinks tells if the theme has pages for single blocks
+func newJsonLdBlock(config *Configuration, block *Block, permalinks bool) *jsonLdBlock {
+	ld := &jsonLdBlock{
+		Type:          block.SchemaType(),
+		Description:   block.Summary,
+		Url:           block.Link,
+		DatePublished: block.TimeStamp.UTC().Format(time.RFC3339),
+		Keywords:      strings.Join(block.Tags, ","),
+	}
+	if permalinks && config.Http.PublicUrl != "" {
+		ld.MainEntityOfPage = config.PermalinkUrl(block.Id())
+	}
+	if ld.Description == "" {
+		ld.Description = block.Content
+	}
+	if author := block.Author(); author != "" {
+		ld.Author = &jsonLdPerson{Type: "Person", Name: author}
+	}
+	if license := block.License(); license != nil {
+		ld.License = license.Url
+		if ld.License == "" {
+			ld.License = license.Name
+		}
+	}
+	switch ld.Type {
+	case ImageObjectSchemaType:
+		ld.Name = block.Title
+		ld.ContentUrl = absoluteImageUrl(config, block)
+		ld.Width = block.ImageWidth
+		ld.Height = block.ImageHeight
+		ld.CreditText = block.Author()
+	case SoftwareSourceCodeSchemaType:
+		ld.Name = block.Title
+		ld.CodeRepository = block.Link
+		ld.ProgrammingLanguage = block.Language
+	default:
+		ld.Headline = block.Title
+		if block.HasImage() {
+			ld.Image = absoluteImageUrl(config, block)
+		}
+	}
+	return ld
+}
+
+// schema.org structured data of a block, or of a list of blocks for
+// index pages, as a script element for the head of a page. Blocks
+// which should not be indexed are left out.
+func jsonLd(config *Configuration, data interface{}, permalinks bool) string {
+	var v interface{}
+	switch d := data.(type) {
+	case *Block:
+		if d == nil || d.NoIndex {
+			return ""
+		}
+		ld := newJsonLdBlock(config, d, permalinks)
+		ld.Context = "https://schema.org"
+		v = ld
+	case []*Block:
+		list := jsonLdItemList{
+			Context:         "https://schema.org",
+			Type:            "ItemList",
+			ItemListElement: []jsonLdListItem{},
+		}
+		for _, block := range d {
+			if block.NoIndex || block.IsAbout() {
+				continue
+			}
+			list.ItemListElement = append(list.ItemListElement, jsonLdListItem{
+				Type:     "ListItem",
+				Position: len(list.ItemListElement) + 1,
+				Item:     newJsonLdBlock(config, block, permalinks),
+			})
+		}
+		if len(list.ItemListElement) == 0 {
+			return ""
+		}
+		v = list
+	default:
+		return ""
+	}
+	// <, > and & are escaped, so the data can not end the script element
+	out, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return `<script type="application/ld+json">` + string(out) + `</script>`
+}
@@ -0,0 +1,293 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LastFmUserSourceType = "lastfm-user"
+
+	lastFmApiUrl = "https://ws.audioscrobbler.com/2.0/"
+
+	// modes of the source
+	LastFmRecentTracksMode = "recent-tracks"
+	LastFmTopAlbumsMode    = "top-albums"
+
+	lastFmDefaultLimit  = 20
+	lastFmDefaultPeriod = "1month"
+	// size of the cover images, 300x300 pixels
+	lastFmImageSize = "extralarge"
+	// image returned by last.fm when there is no cover
+	lastFmPlaceholderImage = "2a96cbd8b46e442fc41c2b86b821562f.png"
+)
+
+// time periods of the top albums, as named by the api
+var lastFmPeriods = map[string]bool{
+	"overall": true,
+	"7day":    true,
+	"1month":  true,
+	"3month":  true,
+	"6month":  true,
+	"12month": true,
+}
+
+// LastFmUserSource provides the recently scrobbled tracks or
+// the top albums of a last.fm user, with their cover art.
+type LastFmUserSource struct {
+	userName string
+	key      string
+	mode     string
+	// time period of the top albums
+	period string
+	limit  int
+}
+
+func NewLastFmUserSource(params SourceParams) (ls *LastFmUserSource, err error) {
+	ls = &LastFmUserSource{
+		mode:   LastFmRecentTracksMode,
+		period: lastFmDefaultPeriod,
+		limit:  lastFmDefaultLimit,
+	}
+	for k, v := range params {
+		switch k {
+		case "user":
+			ls.userName = v
+		case "key":
+			ls.key = v
+		case "mode":
+			if v != LastFmRecentTracksMode && v != LastFmTopAlbumsMode {
+				err = fmt.Errorf("Unknown mode for %v: %v", LastFmUserSourceType, v)
+				return
+			}
+			ls.mode = v
+		case "period":
+			if !lastFmPeriods[v] {
+				err = fmt.Errorf("Unknown period for %v: %v", LastFmUserSourceType, v)
+				return
+			}
+			ls.period = v
+		case "limit":
+			ls.limit, err = strconv.Atoi(v)
+			if err != nil || ls.limit < 1 {
+				err = fmt.Errorf("Limit of %v has to be a positive number: %v", LastFmUserSourceType, v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", LastFmUserSourceType, k)
+			return
+		}
+	}
+	if ls.userName == "" {
+		err = errors.New("last.fm source needs a user")
+		return
+	}
+	if ls.key == "" {
+		err = errors.New("last.fm source needs a key")
+		return
+	}
+	return ls, nil
+}
+
+func (ls *LastFmUserSource) Type() string {
+	return LastFmUserSourceType
+}
+
+func (ls *LastFmUserSource) Id() string {
+	return IdEncodeStrings(ls.Type(), ls.userName, ls.mode, ls.period)
+}
+
+func (ls *LastFmUserSource) Upstreams() []string {
+	return []string{lastFmApiUrl}
+}
+
+// the user info is refused for invalid keys
+func (ls *LastFmUserSource) CheckCredentials() error {
+	return ls.call("user.getinfo", url.Values{}, &struct{}{})
+}
+
+// lastFmError is returned for failed api requests
+type lastFmError struct {
+	Code    int    `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *lastFmError) Error() string {
+	return fmt.Sprintf("Last.fm API: %v", e.Message)
+}
+
+// see https://www.last.fm/api/errorcodes
+func (e *lastFmError) ErrorKind() ErrorKind {
+	switch e.Code {
+	case 4, 9, 10, 14, 26:
+		// authentication failed, invalid session, invalid api key,
+		// unauthorized token, suspended api key
+		return ErrorKindAuth
+	case 29:
+		return ErrorKindRateLimit
+	case 11, 16:
+		// service offline, temporarily unavailable
+		return ErrorKindNetwork
+	}
+	return ErrorKindOther
+}
+
+// text of an element which has attributes
+type lastFmText struct {
+	Text string `json:"#text"`
+}
+
+type lastFmImage struct {
+	Size string `json:"size"`
+	Url  string `json:"#text"`
+}
+
+type lastFmRecentTracksResponse struct {
+	RecentTracks struct {
+		Track []struct {
+			Name   string        `json:"name"`
+			Url    string        `json:"url"`
+			Artist lastFmText    `json:"artist"`
+			Album  lastFmText    `json:"album"`
+			Image  []lastFmImage `json:"image"`
+			// missing for the track which is playing right now
+			Date *struct {
+				Uts string `json:"uts"`
+			} `json:"date"`
+		} `json:"track"`
+	} `json:"recenttracks"`
+}
+
+type lastFmTopAlbumsResponse struct {
+	TopAlbums struct {
+		Album []struct {
+			Name   string        `json:"name"`
+			Url    string        `json:"url"`
+			Image  []lastFmImage `json:"image"`
+			Artist struct {
+				Name string `json:"name"`
+			} `json:"artist"`
+		} `json:"album"`
+	} `json:"topalbums"`
+}
+
+// call a method of the api for the user and decode its response
+func (ls *LastFmUserSource) call(method string, query url.Values, response interface{}) error {
+	query.Set("method", method)
+	query.Set("user", ls.userName)
+	query.Set("api_key", ls.key)
+	query.Set("format", "json")
+
+	resp, err := http.Get(lastFmApiUrl + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var data json.RawMessage
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	// errors are reported in the body, with varying status codes
+	apiErr := new(lastFmError)
+	if err == nil && json.Unmarshal(data, apiErr) == nil && apiErr.Code != 0 {
+		return apiErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &lastFmError{Message: resp.Status}
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, response)
+}
+
+// url of the cover in the preferred size. Empty when there is no cover
+func lastFmCover(images []lastFmImage) (cover string) {
+	for _, image := range images {
+		if image.Url != "" {
+			cover = image.Url
+		}
+		if image.Size == lastFmImageSize && image.Url != "" {
+			break
+		}
+	}
+	if strings.HasSuffix(cover, lastFmPlaceholderImage) {
+		return ""
+	}
+	return
+}
+
+func (ls *LastFmUserSource) GetBlocks() (blocks []*Block, err error) {
+	if ls.mode == LastFmTopAlbumsMode {
+		return ls.topAlbums()
+	}
+	return ls.recentTracks()
+}
+
+func (ls *LastFmUserSource) recentTracks() (blocks []*Block, err error) {
+	var tracksResp lastFmRecentTracksResponse
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(ls.limit))
+	err = ls.call("user.getrecenttracks", query, &tracksResp)
+	if err != nil {
+		return
+	}
+	// repeated plays of a track end up as one block
+	seen := make(map[string]bool)
+	for _, track := range tracksResp.RecentTracks.Track {
+		if seen[track.Url] {
+			continue
+		}
+		seen[track.Url] = true
+
+		block := NewBlock(ls)
+		block.Title = fmt.Sprintf("%v – %v", track.Artist.Text, track.Name)
+		block.Content = track.Album.Text
+		block.SetMeta("artist", track.Artist.Text)
+		block.SetMeta("album", track.Album.Text)
+		block.Link = track.Url
+		block.ImageLink = lastFmCover(track.Image)
+		// the track playing right now comes without a date
+		block.TimeStamp = time.Now().UTC()
+		if track.Date != nil {
+			uts, parseErr := strconv.ParseInt(track.Date.Uts, 10, 64)
+			if parseErr != nil {
+				continue
+			}
+			block.TimeStamp = time.Unix(uts, 0).UTC()
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (ls *LastFmUserSource) topAlbums() (blocks []*Block, err error) {
+	var albumsResp lastFmTopAlbumsResponse
+	query := url.Values{}
+	query.Set("period", ls.period)
+	query.Set("limit", strconv.Itoa(ls.limit))
+	err = ls.call("user.gettopalbums", query, &albumsResp)
+	if err != nil {
+		return
+	}
+	// the albums have no time, they are ordered by their rank instead
+	now := time.Now().UTC().Truncate(time.Second)
+	for rank, album := range albumsResp.TopAlbums.Album {
+		block := NewBlock(ls)
+		block.Title = album.Name
+		// the play count is left out, it would change the id of the block
+		block.Content = album.Artist.Name
+		block.SetMeta("artist", album.Artist.Name)
+		block.SetMeta("album", album.Name)
+		block.Link = album.Url
+		block.ImageLink = lastFmCover(album.Image)
+		block.TimeStamp = now.Add(-time.Duration(rank) * time.Second)
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
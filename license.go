@@ -0,0 +1,122 @@
+package honeybee
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// License of the content of a block
+type License struct {
+	// SPDX identifier, or a lowercase name for licenses without one
+	Id   string
+	Name string
+	// page describing the license, empty when there is none
+	Url string
+	// the content may not be reused without permission
+	AllRightsReserved bool
+}
+
+var knownLicenses = map[string]License{
+	"all-rights-reserved": {Name: "All rights reserved", AllRightsReserved: true},
+	"no-known-copyright":  {Name: "No known copyright restrictions", Url: "https://www.flickr.com/commons/usage/"},
+	"us-government-work":  {Name: "United States Government Work", Url: "https://www.usa.gov/government-copyright"},
+	"CC-BY-2.0":           {Name: "CC BY 2.0", Url: "https://creativecommons.org/licenses/by/2.0/"},
+	"CC-BY-SA-2.0":        {Name: "CC BY-SA 2.0", Url: "https://creativecommons.org/licenses/by-sa/2.0/"},
+	"CC-BY-ND-2.0":        {Name: "CC BY-ND 2.0", Url: "https://creativecommons.org/licenses/by-nd/2.0/"},
+	"CC-BY-NC-2.0":        {Name: "CC BY-NC 2.0", Url: "https://creativecommons.org/licenses/by-nc/2.0/"},
+	"CC-BY-NC-SA-2.0":     {Name: "CC BY-NC-SA 2.0", Url: "https://creativecommons.org/licenses/by-nc-sa/2.0/"},
+	"CC-BY-NC-ND-2.0":     {Name: "CC BY-NC-ND 2.0", Url: "https://creativecommons.org/licenses/by-nc-nd/2.0/"},
+	"CC-BY-4.0":           {Name: "CC BY 4.0", Url: "https://creativecommons.org/licenses/by/4.0/"},
+	"CC-BY-SA-4.0":        {Name: "CC BY-SA 4.0", Url: "https://creativecommons.org/licenses/by-sa/4.0/"},
+	"CC-BY-ND-4.0":        {Name: "CC BY-ND 4.0", Url: "https://creativecommons.org/licenses/by-nd/4.0/"},
+	"CC-BY-NC-4.0":        {Name: "CC BY-NC 4.0", Url: "https://creativecommons.org/licenses/by-nc/4.0/"},
+	"CC-BY-NC-SA-4.0":     {Name: "CC BY-NC-SA 4.0", Url: "https://creativecommons.org/licenses/by-nc-sa/4.0/"},
+	"CC-BY-NC-ND-4.0":     {Name: "CC BY-NC-ND 4.0", Url: "https://creativecommons.org/licenses/by-nc-nd/4.0/"},
+	"CC0-1.0":             {Name: "CC0 1.0", Url: "https://creativecommons.org/publicdomain/zero/1.0/"},
+	"PDM-1.0":             {Name: "Public Domain Mark 1.0", Url: "https://creativecommons.org/publicdomain/mark/1.0/"},
+}
+
+// licenses of flickr photos by the id returned in the license extra,
+// see flickr.photos.licenses.getInfo
+var flickrLicenses = map[string]string{
+	"0":  "all-rights-reserved",
+	"1":  "CC-BY-NC-SA-2.0",
+	"2":  "CC-BY-NC-2.0",
+	"3":  "CC-BY-NC-ND-2.0",
+	"4":  "CC-BY-2.0",
+	"5":  "CC-BY-SA-2.0",
+	"6":  "CC-BY-ND-2.0",
+	"7":  "no-known-copyright",
+	"8":  "us-government-work",
+	"9":  "CC0-1.0",
+	"10": "PDM-1.0",
+	"11": "CC-BY-4.0",
+	"12": "CC-BY-SA-4.0",
+	"13": "CC-BY-ND-4.0",
+	"14": "CC-BY-NC-4.0",
+	"15": "CC-BY-NC-SA-4.0",
+	"16": "CC-BY-NC-ND-4.0",
+}
+
+// describe a license by its id. Other SPDX identifiers, like the
+// licenses of repositories, link to the SPDX license list.
+func LookupLicense(id string) License {
+	license, found := knownLicenses[id]
+	if !found {
+		license = License{
+			Name: id,
+			Url:  "https://spdx.org/licenses/" + id + ".html",
+		}
+	}
+	license.Id = id
+	return license
+}
+
+// the license of the content of the block, nil when the source did not
+// provide one
+func (b *Block) License() *License {
+	id := b.Meta["license"]
+	if id == "" {
+		return nil
+	}
+	license := LookupLicense(id)
+	return &license
+}
+
+// the creator of the content, when it is not the owner of the site
+func (b *Block) Author() string {
+	if author := b.Meta["author"]; author != "" {
+		return author
+	}
+	return b.Meta["owner"]
+}
+
+// html attribution line of a block with a license, f.e. for reused
+// photos: "<title> by <author>, <license>". Empty for blocks without
+// a license.
+func attribution(block *Block) string {
+	license := block.License()
+	if license == nil {
+		return ""
+	}
+	line := template.HTMLEscapeString(block.Title)
+	if line != "" && block.Link != "" {
+		line = fmt.Sprintf(`<a href="%v">%v</a>`, template.HTMLEscapeString(block.Link), line)
+	}
+	author := template.HTMLEscapeString(block.Author())
+	if license.AllRightsReserved && author != "" {
+		return strings.TrimSpace(line + " &copy; " + author)
+	}
+	if author != "" {
+		line = strings.TrimSpace(line + " by " + author)
+	}
+	name := template.HTMLEscapeString(license.Name)
+	if license.Url != "" {
+		name = fmt.Sprintf(`<a href="%v" rel="license">%v</a>`, template.HTMLEscapeString(license.Url), name)
+	}
+	if line == "" {
+		return name
+	}
+	return line + ", " + name
+}
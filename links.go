@@ -0,0 +1,111 @@
+package honeybee
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// urls in plain text
+var textUrlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// BlockLink is an url mentioned in the content of a block
+type BlockLink struct {
+	Url string `json:"url" yaml:"url"`
+	// host of the url without a leading "www."
+	Host string `json:"host" yaml:"host"`
+}
+
+// find the urls in the content and the html content of a block. The
+// link and the image of the block itself are left out.
+func extractLinks(block *Block) (links []BlockLink) {
+	seen := map[string]bool{
+		block.Link:      true,
+		block.ImageLink: true,
+	}
+	add := func(rawUrl string) {
+		// punctuation following urls in sentences
+		rawUrl = strings.TrimRight(rawUrl, ".,;:!?")
+		if strings.Count(rawUrl, "(") < strings.Count(rawUrl, ")") {
+			rawUrl = strings.TrimSuffix(rawUrl, ")")
+		}
+		u, err := url.Parse(rawUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return
+		}
+		if seen[u.String()] {
+			return
+		}
+		seen[u.String()] = true
+		links = append(links, BlockLink{
+			Url:  u.String(),
+			Host: strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."),
+		})
+	}
+
+	if block.HtmlContent != "" {
+		if doc, err := html.Parse(strings.NewReader(block.HtmlContent)); err == nil {
+			var walk func(*html.Node)
+			walk = func(n *html.Node) {
+				if n.Type == html.ElementNode && n.Data == "a" {
+					for _, attr := range n.Attr {
+						if attr.Key == "href" {
+							add(ResolveUrl(block.Link, attr.Val))
+						}
+					}
+				}
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					walk(c)
+				}
+			}
+			walk(doc)
+		}
+	}
+	for _, match := range textUrlPattern.FindAllString(block.Content, -1) {
+		add(match)
+	}
+	return
+}
+
+// fill the links of blocks from their content
+func ExtractBlockLinks(blocks []*Block) {
+	for _, block := range blocks {
+		block.ModifyMtx.Lock()
+		block.Links = extractLinks(block)
+		block.ModifyMtx.Unlock()
+	}
+}
+
+// check if one of the links of the block points to one of the domains
+// or their subdomains
+func (b *Block) LinksTo(domains ...string) bool {
+	for _, link := range b.Links {
+		for _, domain := range domains {
+			if link.Host == domain || strings.HasSuffix(link.Host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keep blocks linking to one of a comma separated list of domains
+func makeLinkDomainFilter(filterParam string) (fn FilterFunc, err error) {
+	var domains []string
+	for _, domain := range strings.Split(filterParam, ",") {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		err = fmt.Errorf("Could not parse linkdomain value: %v\n", filterParam)
+		return
+	}
+	fn = func(idx int, block *Block) bool {
+		return block.LinksTo(domains...)
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package honeybee
+
+import (
+	"fmt"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"log"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	// only log problems concerning the whole server
+	LogLevelQuiet LogLevel = iota
+	// additionally log problems with single upstream requests
+	LogLevelInfo
+	// additionally log cache decisions and transforms per request
+	LogLevelDebug
+)
+
+var logLevel = LogLevelInfo
+
+func SetLogLevel(level LogLevel) {
+	logLevel = level
+}
+
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch s {
+	case "quiet":
+		return LogLevelQuiet, nil
+	case "", "info":
+		return LogLevelInfo, nil
+	case "debug":
+		return LogLevelDebug, nil
+	}
+	return LogLevelInfo, fmt.Errorf("Unknown log level: %v", s)
+}
+
+func logInfof(format string, v ...interface{}) {
+	if logLevel >= LogLevelInfo {
+		log.Printf(format, v...)
+	}
+}
+
+func logDebugf(format string, v ...interface{}) {
+	if logLevel >= LogLevelDebug {
+		log.Printf(format, v...)
+	}
+}
+
+type LoggingConfiguration struct {
+	// "quiet", "info" or "debug"
+	Level string
+
+	// file to write the log to. Logs go to stderr when this is not set
+	File string
+	// size in megabytes after which the file gets rotated
+	MaxSize int `yaml:"max-size"`
+	// number of days to keep rotated files
+	MaxAge int `yaml:"max-age"`
+	// number of rotated files to keep
+	MaxBackups int `yaml:"max-backups"`
+	// rotate the file every n hours, regardless of its size
+	RotateInterval int `yaml:"rotate-interval"`
+}
+
+// set the log level and redirect the standard logger to the
+// configured file
+func ConfigureLogging(config *LoggingConfiguration) error {
+	level, err := ParseLogLevel(config.Level)
+	if err != nil {
+		return err
+	}
+	SetLogLevel(level)
+
+	if config.File == "" {
+		return nil
+	}
+	logger := &lumberjack.Logger{
+		Filename:   config.File,
+		MaxSize:    config.MaxSize,
+		MaxAge:     config.MaxAge,
+		MaxBackups: config.MaxBackups,
+		LocalTime:  true,
+	}
+	log.SetOutput(logger)
+
+	if config.RotateInterval > 0 {
+		go func() {
+			for range time.Tick(time.Hour * time.Duration(config.RotateInterval)) {
+				if err := logger.Rotate(); err != nil {
+					log.Printf("Could not rotate the log file: %v", err)
+				}
+			}
+		}()
+	}
+	return nil
+}
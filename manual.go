@@ -0,0 +1,155 @@
+package honeybee
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const ManualSourceType = "manual"
+
+// ManualSource serves blocks which are posted to the site itself, f.e.
+// using the micropub endpoint. The blocks are stored in a file.
+type ManualSource struct {
+	file      string
+	modifyMtx *sync.Mutex
+}
+
+func NewManualSource(params SourceParams) (ms *ManualSource, err error) {
+	file := ""
+	for k, v := range params {
+		switch k {
+		case "file":
+			file = ExpandHome(v)
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", ManualSourceType, k)
+			return
+		}
+	}
+	if file == "" {
+		err = errors.New("'file' parameter is not set")
+		return
+	}
+	ms = &ManualSource{
+		file:      file,
+		modifyMtx: new(sync.Mutex),
+	}
+	return ms, nil
+}
+
+func (ms *ManualSource) Type() string {
+	return ManualSourceType
+}
+
+func (ms *ManualSource) Id() string {
+	return IdEncodeStrings(ms.Type(), ms.file)
+}
+
+func (ms *ManualSource) GetBlocks() (blocks []*Block, err error) {
+	ms.modifyMtx.Lock()
+	defer ms.modifyMtx.Unlock()
+
+	records, err := LoadBlockRecords(ms.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// nothing posted yet
+			return nil, nil
+		}
+		return
+	}
+	for i := range records {
+		blocks = append(blocks, records[i].Block(ms))
+	}
+	return
+}
+
+// store a new block
+func (ms *ManualSource) AddBlock(block *Block) (err error) {
+	ms.modifyMtx.Lock()
+	defer ms.modifyMtx.Unlock()
+
+	records, err := LoadBlockRecords(ms.file)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	block.Origin = ms
+	records = append(records, block.Record())
+	return SaveBlockRecords(ms.file, records)
+}
+
+// find the first manual source
+func (sources *Sources) ManualSource() (ms *ManualSource, found bool) {
+	for _, source := range *sources {
+		if fs, ok := source.(*FilteredSource); ok {
+			source = fs.nestedSource
+		}
+		if ms, ok := source.(*ManualSource); ok {
+			return ms, true
+		}
+	}
+	return nil, false
+}
+
+// image types accepted for uploads
+var uploadExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// store an uploaded image in a directory using a random name.
+// Returns the name of the created file.
+func SaveUpload(directory string, r io.Reader) (name string, err error) {
+	// detect the type from the first bytes of the data
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	ext, ok := uploadExtensions[contentType]
+	if !ok {
+		return "", fmt.Errorf("Unsupported file type: %v", contentType)
+	}
+
+	err = EnsureDirectoryExists(directory)
+	if err != nil {
+		return
+	}
+	randomBytes := make([]byte, 12)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return
+	}
+	name = hex.EncodeToString(randomBytes) + ext
+
+	f, err := os.Create(filepath.Join(directory, name))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(head)
+	if err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return name, nil
+}
+
+// the url of an uploaded file
+func (c Configuration) UploadUrl(name string) string {
+	return strings.TrimRight(c.Http.PublicUrl, "/") + "/static/uploads/" + name
+}
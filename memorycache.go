@@ -0,0 +1,197 @@
+package honeybee
+
+import (
+	"container/list"
+	"sync"
+)
+
+type memoryCacheEntry struct {
+	storageKey string
+	entry      []byte
+}
+
+// MemoryCache keeps the entries in memory and drops the least
+// recently used entries once its maximum size is reached
+type MemoryCache struct {
+	maxSize   int
+	size      int
+	entries   map[string]*list.Element
+	lru       *list.List
+	modifyMtx *sync.Mutex
+}
+
+// create a memory cache holding up to maxSize bytes
+func NewMemoryCache(maxSize int) *MemoryCache {
+	return &MemoryCache{
+		maxSize:   maxSize,
+		size:      0,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		modifyMtx: new(sync.Mutex),
+	}
+}
+
+func (mc *MemoryCache) Get(key string) (resp []byte, ok bool) {
+	entry, err := mc.ReadEntry(keyToFilename(key))
+	if err != nil {
+		return []byte{}, false
+	}
+	return entry, true
+}
+
+func (mc *MemoryCache) Set(key string, resp []byte) {
+	mc.WriteEntry(keyToFilename(key), resp)
+}
+
+func (mc *MemoryCache) Delete(key string) {
+	mc.modifyMtx.Lock()
+	defer mc.modifyMtx.Unlock()
+	if elem, found := mc.entries[keyToFilename(key)]; found {
+		mc.remove(elem)
+	}
+}
+
+// the memory cache drops entries on its own, so
+// there is no need to forget anything
+func (mc *MemoryCache) DeleteSome() {
+}
+
+func (mc *MemoryCache) DeleteAll() {
+	mc.modifyMtx.Lock()
+	defer mc.modifyMtx.Unlock()
+	mc.entries = make(map[string]*list.Element)
+	mc.lru.Init()
+	mc.size = 0
+}
+
+func (mc *MemoryCache) StorageKeys() <-chan string {
+	mc.modifyMtx.Lock()
+	keys := make([]string, 0, len(mc.entries))
+	for storageKey := range mc.entries {
+		keys = append(keys, storageKey)
+	}
+	mc.modifyMtx.Unlock()
+
+	keyChan := make(chan string)
+	go func() {
+		defer close(keyChan)
+		for _, storageKey := range keys {
+			keyChan <- storageKey
+		}
+	}()
+	return keyChan
+}
+
+// in contrast to the other backends the memory cache does not
+// store checksums as there is nothing which could corrupt the entries
+func (mc *MemoryCache) ReadEntry(storageKey string) ([]byte, error) {
+	mc.modifyMtx.Lock()
+	defer mc.modifyMtx.Unlock()
+	elem, found := mc.entries[storageKey]
+	if !found {
+		return nil, errCacheMiss
+	}
+	mc.lru.MoveToFront(elem)
+	return elem.Value.(*memoryCacheEntry).entry, nil
+}
+
+func (mc *MemoryCache) WriteEntry(storageKey string, entry []byte) error {
+	if data, err := decodeCacheEntry(entry); err == nil {
+		// entry copied from another backend
+		entry = data
+	}
+	if len(entry) > mc.maxSize {
+		return nil
+	}
+
+	mc.modifyMtx.Lock()
+	defer mc.modifyMtx.Unlock()
+	if elem, found := mc.entries[storageKey]; found {
+		mc.remove(elem)
+	}
+	mc.entries[storageKey] = mc.lru.PushFront(&memoryCacheEntry{
+		storageKey: storageKey,
+		entry:      entry,
+	})
+	mc.size += len(entry)
+
+	for mc.size > mc.maxSize {
+		mc.remove(mc.lru.Back())
+		cacheEvictionsVar.Add(MemoryCacheBackend, 1)
+	}
+	return nil
+}
+
+func (mc *MemoryCache) DeleteEntry(storageKey string) {
+	mc.modifyMtx.Lock()
+	defer mc.modifyMtx.Unlock()
+	if elem, found := mc.entries[storageKey]; found {
+		mc.remove(elem)
+	}
+}
+
+// remove an element. the mutex must be held by the caller
+func (mc *MemoryCache) remove(elem *list.Element) {
+	mcEntry := mc.lru.Remove(elem).(*memoryCacheEntry)
+	delete(mc.entries, mcEntry.storageKey)
+	mc.size -= len(mcEntry.entry)
+}
+
+// TieredCache layers multiple caches. Reads go through the tiers in order
+// and copy found entries to the faster tiers, writes go to all tiers.
+type TieredCache struct {
+	tiers []Cache
+}
+
+func NewTieredCache(tiers ...Cache) *TieredCache {
+	return &TieredCache{
+		tiers: tiers,
+	}
+}
+
+func (tc *TieredCache) Get(key string) (resp []byte, ok bool) {
+	for i, tier := range tc.tiers {
+		resp, ok = tier.Get(key)
+		if ok {
+			for j := 0; j < i; j++ {
+				tc.tiers[j].Set(key, resp)
+			}
+			return
+		}
+	}
+	return []byte{}, false
+}
+
+func (tc *TieredCache) Set(key string, resp []byte) {
+	for _, tier := range tc.tiers {
+		tier.Set(key, resp)
+	}
+}
+
+func (tc *TieredCache) Delete(key string) {
+	for _, tier := range tc.tiers {
+		tier.Delete(key)
+	}
+}
+
+func (tc *TieredCache) DeleteSome() {
+	for _, tier := range tc.tiers {
+		tier.DeleteSome()
+	}
+}
+
+func (tc *TieredCache) DeleteAll() {
+	for _, tier := range tc.tiers {
+		tier.DeleteAll()
+	}
+}
+
+// any of the tiers is degraded
+func (tc *TieredCache) Degraded() bool {
+	for _, tier := range tc.tiers {
+		if dc, ok := tier.(DegradableCache); ok && dc.Degraded() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package honeybee
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maximum size of micropub requests including uploaded photos
+const maxMicropubRequestSize = 32 << 20
+
+type MicropubConfiguration struct {
+	// token clients have to send to post. The endpoint is disabled
+	// when no token is set
+	Token string
+}
+
+// properties of a micropub h-entry in the JSON syntax
+type micropubJsonRequest struct {
+	Type       []string                     `json:"type"`
+	Properties map[string][]json.RawMessage `json:"properties"`
+}
+
+// check the token of the request in the header or form
+func (s *Server) isMicropubAuthorized(r *http.Request) bool {
+	token := r.FormValue("access_token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = auth[len("Bearer "):]
+	}
+	config, _ := s.current()
+	return subtle.ConstantTimeCompare([]byte(token), []byte(config.Micropub.Token)) == 1
+}
+
+// first string value of a property. photos may be objects
+// having a value and an alt text
+func micropubProperty(properties map[string][]json.RawMessage, name string) (value string, alt string) {
+	values := properties[name]
+	if len(values) == 0 {
+		return
+	}
+	if err := json.Unmarshal(values[0], &value); err == nil {
+		return value, ""
+	}
+	var obj struct {
+		Value string `json:"value"`
+		Alt   string `json:"alt"`
+		Html  string `json:"html"`
+	}
+	json.Unmarshal(values[0], &obj)
+	if obj.Value == "" {
+		obj.Value = obj.Html
+	}
+	return obj.Value, obj.Alt
+}
+
+// create a block from a micropub request
+func (s *Server) micropubBlock(r *http.Request, config *Configuration) (block *Block, err error) {
+	block = NewBlock(nil)
+	block.TimeStamp = time.Now().UTC()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req micropubJsonRequest
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			return
+		}
+		if len(req.Type) != 1 || req.Type[0] != "h-entry" {
+			return nil, errors.New("only h-entry posts are supported")
+		}
+		block.Title, _ = micropubProperty(req.Properties, "name")
+		block.Content, _ = micropubProperty(req.Properties, "content")
+		var alt string
+		block.ImageLink, alt = micropubProperty(req.Properties, "photo")
+		if block.Content == "" {
+			block.Content = alt
+		}
+		return block, nil
+	}
+
+	if h := r.FormValue("h"); h != "" && h != "entry" {
+		return nil, errors.New("only h-entry posts are supported")
+	}
+	block.Title = r.FormValue("name")
+	block.Content = r.FormValue("content")
+	block.ImageLink = r.FormValue("photo")
+
+	if r.MultipartForm != nil {
+		if files := r.MultipartForm.File["photo"]; len(files) > 0 {
+			f, err := files[0].Open()
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			name, err := SaveUpload(config.UploadDirectory(), f)
+			if err != nil {
+				return nil, err
+			}
+			block.ImageLink = config.UploadUrl(name)
+		}
+	}
+	return block, nil
+}
+
+// handle posts of micropub clients
+func (s *Server) handleMicropubPost(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMicropubRequestSize)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := r.ParseMultipartForm(maxMicropubRequestSize); err != nil && err != http.ErrNotMultipart {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !s.isMicropubAuthorized(r) {
+		httpError(w, r, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	config, sources := s.current()
+	ms, found := sources.ManualSource()
+	if !found {
+		httpError(w, r, "no manual source configured", http.StatusInternalServerError)
+		return
+	}
+	if config.ReadOnly {
+		// nothing is updated in read-only mode, the post would not be shown
+		httpError(w, r, ErrReadOnly.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	block, err := s.micropubBlock(r, config)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if block.Title == "" && block.Content == "" && block.ImageLink == "" {
+		httpError(w, r, "empty post", http.StatusBadRequest)
+		return
+	}
+	err = ms.AddBlock(block)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not store micropub post: %v", err)
+		httpError(w, r, "could not store the post", http.StatusInternalServerError)
+		return
+	}
+	err = s.refreshSource(ms)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not update the blocks of the manual source: %v", err)
+	}
+
+	w.Header().Set("Location", strings.TrimRight(config.Http.PublicUrl, "/")+"/#"+block.Id())
+	w.WriteHeader(http.StatusCreated)
+}
+
+// answer the configuration queries of micropub clients
+func (s *Server) handleMicropubQuery(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !s.isMicropubAuthorized(r) {
+		httpError(w, r, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch r.FormValue("q") {
+	case "config":
+		w.Write([]byte(`{"syndicate-to": []}`))
+	case "syndicate-to":
+		w.Write([]byte(`{"syndicate-to": []}`))
+	default:
+		w.Write([]byte(`{}`))
+	}
+}
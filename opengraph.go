@@ -0,0 +1,166 @@
+package honeybee
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maximum number of bytes of a page read to find the open graph metadata
+	openGraphMaxPageSize = 1 << 20
+	// the metadata of a page is fetched again after this time
+	openGraphTtl = 24 * time.Hour
+	// pages which could not be read are retried after this time
+	openGraphRetryAfter = time.Hour
+	// number of pages whose metadata is kept by a modifier
+	openGraphMaxKnown = 1000
+)
+
+// open graph metadata of a web page
+type OpenGraph struct {
+	Image       string
+	Description string
+}
+
+// fetch a page and read its open graph metadata
+func FetchOpenGraph(pageUrl string) (og *OpenGraph, err error) {
+	resp, err := politeFetcher.Get(pageUrl)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status fetching %v: %v", pageUrl, resp.Status)
+	}
+	og, err = parseOpenGraph(io.LimitReader(resp.Body, openGraphMaxPageSize))
+	if err != nil {
+		return
+	}
+
+	// resolve relative image urls against the page the
+	// redirects ended at
+	og.Image = ResolveUrl(resp.Request.URL.String(), og.Image)
+	return
+}
+
+// read the open graph meta tags from the head of a html document
+func parseOpenGraph(r io.Reader) (og *OpenGraph, err error) {
+	og = new(OpenGraph)
+	tokenizer := html.NewTokenizer(r)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() == io.EOF {
+				return og, nil
+			}
+			return nil, tokenizer.Err()
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "head" {
+				return og, nil
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			if string(name) != "meta" || !hasAttr {
+				continue
+			}
+			var property, content string
+			for {
+				key, val, more := tokenizer.TagAttr()
+				switch string(key) {
+				case "property", "name":
+					property = string(val)
+				case "content":
+					content = strings.TrimSpace(string(val))
+				}
+				if !more {
+					break
+				}
+			}
+			switch property {
+			case "og:image", "og:image:url":
+				if og.Image == "" {
+					og.Image = content
+				}
+			case "og:description":
+				if og.Description == "" {
+					og.Description = content
+				}
+			}
+		}
+	}
+}
+
+// open graph metadata of a page fetched by the modifier
+type knownOpenGraph struct {
+	og      *OpenGraph
+	expires time.Time
+}
+
+// fill the image and the content of blocks without an image from the
+// open graph metadata of the linked page. The metadata of a link is
+// fetched again after openGraphTtl, pages which could not be read are
+// retried after openGraphRetryAfter.
+func makeOpenGraphModifier(modifierParam string) (fn ModifierFunc, err error) {
+	enabled, boolerr := strconv.ParseBool(modifierParam)
+	if boolerr != nil {
+		err = fmt.Errorf("Could not parse opengraph value: %v\n", modifierParam)
+		return
+	}
+	known := make(map[string]knownOpenGraph)
+	knownMtx := new(sync.Mutex)
+
+	fn = func(block *Block) {
+		if !enabled || block.HasImage() || block.Link == "" {
+			return
+		}
+		knownMtx.Lock()
+		entry, found := known[block.Link]
+		knownMtx.Unlock()
+		og := entry.og
+		if !found || time.Now().After(entry.expires) {
+			var ogErr error
+			expires := time.Now().Add(openGraphTtl)
+			og, ogErr = FetchOpenGraph(block.Link)
+			if ogErr != nil {
+				logInfof("Could not read open graph metadata of %v: %v", block.Link, ogErr)
+				og = new(OpenGraph)
+				expires = time.Now().Add(openGraphRetryAfter)
+			}
+			knownMtx.Lock()
+			rememberOpenGraph(known, block.Link, knownOpenGraph{og: og, expires: expires})
+			knownMtx.Unlock()
+		}
+		block.ImageLink = og.Image
+		if block.Content == "" {
+			block.Content = og.Description
+		}
+	}
+	return
+}
+
+// keep the metadata of a page. When openGraphMaxKnown pages are known,
+// the expired entries are removed, or else the one expiring first.
+func rememberOpenGraph(known map[string]knownOpenGraph, pageUrl string, entry knownOpenGraph) {
+	if _, found := known[pageUrl]; !found && len(known) >= openGraphMaxKnown {
+		now := time.Now()
+		firstUrl := ""
+		for url, candidate := range known {
+			if now.After(candidate.expires) {
+				delete(known, url)
+			} else if firstUrl == "" || candidate.expires.Before(known[firstUrl].expires) {
+				firstUrl = url
+			}
+		}
+		if len(known) >= openGraphMaxKnown {
+			delete(known, firstUrl)
+		}
+	}
+	known[pageUrl] = entry
+}
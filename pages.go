@@ -0,0 +1,183 @@
+package honeybee
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type PageConfiguration struct {
+	// name of the page, used in its url /page/<name>
+	Name  string
+	Title string
+	// names of the sources whose blocks are shown. All sources when empty
+	Sources []string
+	// only show blocks having one of these tags
+	Tags []string
+	// require authentication. Blocks shown on a private page are not
+	// shown on the index page or on public pages. Private pages require
+	// sources or tags.
+	Private bool
+	// credentials for private pages. Defaults to the admin credentials
+	Users map[string]string
+}
+
+// Page is an additional page showing a subset of the blocks
+type Page struct {
+	config    *PageConfiguration
+	sourceIds map[string]bool
+}
+
+// create the configured pages. The sources are referred to by their names.
+func CreatePages(config *Configuration, sources Sources) (pages []*Page, err error) {
+	// sources are created in the order of the configuration
+	sourceIdsByName := make(map[string]string)
+	for i, sourceconfig := range config.Sources {
+		if sourceconfig.Name != "" {
+			sourceIdsByName[sourceconfig.Name] = sources[i].Id()
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Pages {
+		pageconfig := &config.Pages[i]
+		if pageconfig.Name == "" {
+			return nil, errors.New("pages require a name")
+		}
+		if names[pageconfig.Name] {
+			return nil, fmt.Errorf("Duplicate page name: %v", pageconfig.Name)
+		}
+		names[pageconfig.Name] = true
+		if pageconfig.Private && len(pageconfig.Users) == 0 && config.Admin.Password == "" {
+			return nil, fmt.Errorf("Private page %v requires users or an admin password", pageconfig.Name)
+		}
+		if pageconfig.Private && len(pageconfig.Sources) == 0 && len(pageconfig.Tags) == 0 {
+			// it would contain all blocks
+			return nil, fmt.Errorf("Private page %v requires sources or tags", pageconfig.Name)
+		}
+
+		page := &Page{
+			config:    pageconfig,
+			sourceIds: make(map[string]bool),
+		}
+		for _, sourceName := range pageconfig.Sources {
+			sourceId, found := sourceIdsByName[sourceName]
+			if !found {
+				return nil, fmt.Errorf("Unknown source %v on page %v", sourceName, pageconfig.Name)
+			}
+			page.sourceIds[sourceId] = true
+		}
+		pages = append(pages, page)
+	}
+	return
+}
+
+func (p *Page) Name() string {
+	return p.config.Name
+}
+
+func (p *Page) Title() string {
+	return p.config.Title
+}
+
+// check if a block is shown on the page
+func (p *Page) Contains(block *Block) bool {
+	if len(p.sourceIds) > 0 && (block.Origin == nil || !p.sourceIds[block.Origin.Id()]) {
+		return false
+	}
+	if len(p.config.Tags) == 0 {
+		return true
+	}
+	for _, tag := range p.config.Tags {
+		if block.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// check the basic auth credentials of a request
+func (p *Page) authorized(r *http.Request, admin *AdminConfiguration) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	users := p.config.Users
+	if len(users) == 0 {
+		users = map[string]string{admin.User: admin.Password}
+	}
+	expected, found := users[user]
+	return found && subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+}
+
+// private pages the block is shown on
+func (s *Server) privatePagesOf(block *Block) (pages []*Page) {
+	for _, page := range s.pages {
+		if page.config.Private && page.Contains(block) {
+			pages = append(pages, page)
+		}
+	}
+	return
+}
+
+// blocks of private pages are not public
+func (s *Server) isPublic(block *Block) bool {
+	return len(s.privatePagesOf(block)) == 0
+}
+
+// check if the request may access the block. Otherwise
+// the client is asked for credentials.
+func (s *Server) authorizeBlock(w http.ResponseWriter, r *http.Request, block *Block) bool {
+	pages := s.privatePagesOf(block)
+	if len(pages) == 0 {
+		return true
+	}
+	for _, page := range pages {
+		if page.authorized(r, &s.config.Admin) {
+			w.Header().Set("Cache-Control", "private")
+			return true
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="honeybee"`)
+	httpError(w, r, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// handle the request to a configured page
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var page *Page
+	for _, p := range s.pages {
+		if p.Name() == ps.ByName("name") {
+			page = p
+		}
+	}
+	if page == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if page.config.Private && !page.authorized(r, &s.config.Admin) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="honeybee"`)
+		httpError(w, r, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.renderedMtx.Lock()
+	rendered := s.renderedPages[page.Name()]
+	s.renderedMtx.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if page.config.Private {
+		w.Header().Set("Cache-Control", "private")
+	}
+	s.writeWarmupStatus(w)
+	if rendered != nil {
+		w.Write(rendered)
+		return
+	}
+	err := s.renderPage(w, page)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not render the page %v: %v", page.Name(), err)
+	}
+}
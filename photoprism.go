@@ -0,0 +1,249 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PhotoPrismAlbumSourceType = "photoprism-album"
+
+	// size of the thumbnails, fitted into 1280x1024
+	photoPrismThumbnailSize = "fit_1280"
+	// token in the urls of thumbnails of instances without authentication.
+	// The image links of the blocks use it, the image proxy replaces it
+	// with the preview token of the session.
+	photoPrismPublicToken = "public"
+)
+
+// PhotoPrismAlbumSource provides the newest photos and videos of an
+// album of a PhotoPrism instance
+type PhotoPrismAlbumSource struct {
+	serverUrl string
+	// access token or app password. Empty for public instances
+	token string
+	// uid of the album, as in its url
+	albumUid string
+	limit    int
+
+	// token for the thumbnails, returned with the api responses, and
+	// the hashes of the published photos of the last pull, the only
+	// thumbnails signed with it
+	previewTokenMtx sync.Mutex
+	previewToken    string
+	hashes          map[string]bool
+}
+
+func NewPhotoPrismAlbumSource(params SourceParams) (ps *PhotoPrismAlbumSource, err error) {
+	ps = &PhotoPrismAlbumSource{
+		limit: 25,
+	}
+	for k, v := range params {
+		switch k {
+		case "url":
+			ps.serverUrl = strings.TrimRight(v, "/")
+			if !strings.Contains(ps.serverUrl, "://") {
+				ps.serverUrl = "https://" + ps.serverUrl
+			}
+		case "token":
+			ps.token = v
+		case "album":
+			ps.albumUid = v
+		case "limit":
+			ps.limit, err = strconv.Atoi(v)
+			if err != nil || ps.limit < 1 {
+				err = fmt.Errorf("limit must be a positive number, not %v", v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", PhotoPrismAlbumSourceType, k)
+			return
+		}
+	}
+	if ps.serverUrl == "" {
+		err = errors.New("'url' parameter is not set")
+		return
+	}
+	if ps.albumUid == "" {
+		err = errors.New("'album' parameter is not set")
+		return
+	}
+	return ps, nil
+}
+
+func (ps *PhotoPrismAlbumSource) Type() string {
+	return PhotoPrismAlbumSourceType
+}
+
+func (ps *PhotoPrismAlbumSource) Id() string {
+	return IdEncodeStrings(ps.Type(), ps.serverUrl, ps.albumUid)
+}
+
+func (ps *PhotoPrismAlbumSource) Upstreams() []string {
+	return []string{ps.serverUrl}
+}
+
+// the album is refused for invalid tokens. The listing of the photos
+// returns the preview token.
+func (ps *PhotoPrismAlbumSource) CheckCredentials() error {
+	var album struct {
+		UID string `json:"UID"`
+	}
+	if err := ps.get("/api/v1/albums/"+ps.albumUid, url.Values{}, &album); err != nil {
+		return err
+	}
+	_, err := ps.photos(1)
+	return err
+}
+
+// photoPrismError is returned for failed api requests
+type photoPrismError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *photoPrismError) Error() string {
+	return fmt.Sprintf("PhotoPrism API: %v", e.Message)
+}
+
+func (e *photoPrismError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrorKindNetwork
+	}
+	return ErrorKindOther
+}
+
+type photoPrismPhoto struct {
+	UID         string    `json:"UID"`
+	Title       string    `json:"Title"`
+	Description string    `json:"Description"`
+	TakenAt     time.Time `json:"TakenAt"`
+	// image, video, live, raw or animated
+	Type string `json:"Type"`
+	// hash of the primary file, used for its thumbnails
+	Hash        string  `json:"Hash"`
+	Private     bool    `json:"Private"`
+	Lat         float64 `json:"Lat"`
+	Lng         float64 `json:"Lng"`
+	CameraMake  string  `json:"CameraMake"`
+	CameraModel string  `json:"CameraModel"`
+	PlaceLabel  string  `json:"PlaceLabel"`
+}
+
+// call the api and decode the json response. The preview token sent
+// along is remembered for signing the thumbnail urls.
+func (ps *PhotoPrismAlbumSource) get(path string, query url.Values, v interface{}) (err error) {
+	req, err := http.NewRequest("GET", ps.serverUrl+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	if ps.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ps.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		message := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != "" {
+			message = errResp.Error
+		}
+		return &photoPrismError{StatusCode: resp.StatusCode, Message: message}
+	}
+	if previewToken := resp.Header.Get("X-Preview-Token"); previewToken != "" {
+		ps.previewTokenMtx.Lock()
+		ps.previewToken = previewToken
+		ps.previewTokenMtx.Unlock()
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (ps *PhotoPrismAlbumSource) photos(count int) (photos []photoPrismPhoto, err error) {
+	query := url.Values{}
+	query.Set("s", ps.albumUid)
+	query.Set("count", strconv.Itoa(count))
+	query.Set("offset", "0")
+	query.Set("order", "newest")
+	query.Set("merged", "true")
+	err = ps.get("/api/v1/photos", query, &photos)
+	return
+}
+
+// put the preview token into the urls of the thumbnails of the
+// published photos of the album, so the blocks keep the same image links
+// when it changes. The token is known after the first pull, blocks loaded
+// from the store file are not signed before.
+func (ps *PhotoPrismAlbumSource) SignImageUrl(rawUrl string) (signed string, ok bool) {
+	if ps.token == "" {
+		return "", false
+	}
+	// <server>/api/v1/t/<hash>/public/<size>
+	hash := strings.TrimPrefix(rawUrl, ps.serverUrl+"/api/v1/t/")
+	hash = strings.TrimSuffix(hash, "/"+photoPrismPublicToken+"/"+photoPrismThumbnailSize)
+	if len(hash) == len(rawUrl) || strings.Contains(hash, "/") {
+		return "", false
+	}
+	ps.previewTokenMtx.Lock()
+	defer ps.previewTokenMtx.Unlock()
+	if ps.previewToken == "" || !ps.hashes[hash] {
+		return "", false
+	}
+	return strings.Replace(rawUrl, "/"+photoPrismPublicToken+"/", "/"+ps.previewToken+"/", 1), true
+}
+
+func (ps *PhotoPrismAlbumSource) GetBlocks() (blocks []*Block, err error) {
+	photos, err := ps.photos(ps.limit)
+	if err != nil {
+		return
+	}
+
+	hashes := make(map[string]bool)
+	defer func() {
+		ps.previewTokenMtx.Lock()
+		ps.hashes = hashes
+		ps.previewTokenMtx.Unlock()
+	}()
+
+	for _, photo := range photos {
+		if photo.Private || photo.Hash == "" {
+			continue
+		}
+		hashes[photo.Hash] = true
+		block := NewBlock(ps)
+		block.Title = photo.Title
+		block.Content = photo.Description
+		block.Link = ps.serverUrl + "/library/browse?view=cards&q=uid:" + photo.UID
+		block.ImageLink = fmt.Sprintf("%v/api/v1/t/%v/%v/%v", ps.serverUrl, photo.Hash, photoPrismPublicToken, photoPrismThumbnailSize)
+		block.TimeStamp = photo.TakenAt.UTC()
+		if photo.Type == "video" || photo.Type == "live" || photo.Type == "animated" {
+			block.Tags = append(block.Tags, VideoTag)
+		}
+		block.SetMeta("camera", strings.TrimSpace(photo.CameraMake+" "+photo.CameraModel))
+		if photo.PlaceLabel != "Unknown" {
+			block.SetMeta("place", photo.PlaceLabel)
+		}
+		if photo.Lat != 0 || photo.Lng != 0 {
+			block.SetMeta("latitude", strconv.FormatFloat(photo.Lat, 'f', -1, 64))
+			block.SetMeta("longitude", strconv.FormatFloat(photo.Lng, 'f', -1, 64))
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
@@ -0,0 +1,118 @@
+package honeybee
+
+import (
+	"fmt"
+	"sync"
+)
+
+// stages of the block pipeline. The blocks pulled from the sources
+// pass the configured stages in order before they are stored. The
+// modifiers of the sources are applied before the stages in any case,
+// as they sanitize the content and restrict the images.
+const (
+	// apply the filters of the sources and extract the links of
+	// the blocks
+	FilterStage = "filter"
+	// fetch the images to fill the image dimensions of the blocks
+	AnalyzeStage = "analyze"
+	// shorten the content to the summary of the blocks
+	SummarizeStage = "summarize"
+)
+
+var DefaultPipeline = []string{FilterStage, AnalyzeStage, SummarizeStage}
+
+// check the names of the stages of a pipeline
+func validatePipeline(stages []string) error {
+	seen := make(map[string]bool)
+	for _, stage := range stages {
+		switch stage {
+		case FilterStage, AnalyzeStage, SummarizeStage:
+		default:
+			return fmt.Errorf("Unknown pipeline stage: %v", stage)
+		}
+		if seen[stage] {
+			return fmt.Errorf("Pipeline stage %v is used more than once", stage)
+		}
+		seen[stage] = true
+	}
+	return nil
+}
+
+type stageFunc func([]*Block) []*Block
+
+// Pipeline passes the blocks it receives through the configured stages
+// and collects them. ReceiveBlocks may be called concurrently by multiple
+// sources, each call is expected to contain the blocks of one source.
+type Pipeline struct {
+	stages       []stageFunc
+	outBlocks    []*Block
+	outBlocksMtx *sync.Mutex
+}
+
+// create the pipeline of the configuration. The sources are used to
+// look up the filters of the blocks.
+func NewPipeline(config *Configuration, sources Sources, imgProxy *ImgProxy) *Pipeline {
+	p := &Pipeline{
+		outBlocksMtx: new(sync.Mutex),
+	}
+	filteredSources := make(map[string]*FilteredSource)
+	for _, source := range sources {
+		if fs, ok := source.(*FilteredSource); ok {
+			filteredSources[fs.Id()] = fs
+		}
+	}
+	filteredSource := func(blocks []*Block) *FilteredSource {
+		if len(blocks) == 0 || blocks[0].Origin == nil {
+			return nil
+		}
+		return filteredSources[blocks[0].Origin.Id()]
+	}
+	p.stages = append(p.stages, func(blocks []*Block) []*Block {
+		if fs := filteredSource(blocks); fs != nil {
+			return fs.Modify(blocks)
+		}
+		return blocks
+	})
+	for _, stage := range config.Pipeline {
+		switch stage {
+		case FilterStage:
+			p.stages = append(p.stages, func(blocks []*Block) []*Block {
+				if fs := filteredSource(blocks); fs != nil {
+					return fs.Filter(blocks)
+				}
+				ExtractBlockLinks(blocks)
+				return blocks
+			})
+		case AnalyzeStage:
+			ia := NewImageAnalyzer(imgProxy)
+			p.stages = append(p.stages, func(blocks []*Block) []*Block {
+				ia.analyzeBlocks(blocks)
+				return blocks
+			})
+		case SummarizeStage:
+			maxLength := config.Summary.MaxLength
+			p.stages = append(p.stages, func(blocks []*Block) []*Block {
+				SummarizeBlocks(blocks, maxLength)
+				return blocks
+			})
+		}
+	}
+	return p
+}
+
+func (p *Pipeline) ReceiveBlocks(blocks []*Block) {
+	for _, stage := range p.stages {
+		blocks = stage(blocks)
+	}
+	p.outBlocksMtx.Lock()
+	p.outBlocks = append(p.outBlocks, blocks...)
+	p.outBlocksMtx.Unlock()
+}
+
+func (p *Pipeline) GetBlocks() ([]*Block, error) {
+	p.outBlocksMtx.Lock()
+	defer p.outBlocksMtx.Unlock()
+	blocks := make([]*Block, len(p.outBlocks))
+	copy(blocks, p.outBlocks)
+	return blocks, nil
+}
@@ -0,0 +1,202 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PixelfedAccountSourceType = "pixelfed-account"
+
+	// maximum number of characters of titles taken from the text of posts
+	pixelfedTitleLength = 80
+)
+
+// PixelfedAccountSource provides the public image posts of a Pixelfed
+// account using the mastodon compatible api of the instance
+type PixelfedAccountSource struct {
+	instance string
+	userName string
+	// optional access token for instances which require authentication
+	token string
+	limit int
+}
+
+func NewPixelfedAccountSource(params SourceParams) (ps *PixelfedAccountSource, err error) {
+	ps = &PixelfedAccountSource{
+		limit: 40,
+	}
+	for k, v := range params {
+		switch k {
+		case "instance":
+			ps.instance = strings.TrimRight(v, "/")
+			if !strings.Contains(ps.instance, "://") {
+				ps.instance = "https://" + ps.instance
+			}
+		case "user":
+			ps.userName = strings.TrimPrefix(v, "@")
+		case "token":
+			ps.token = v
+		case "limit":
+			ps.limit, err = strconv.Atoi(v)
+			if err != nil || ps.limit < 1 {
+				err = fmt.Errorf("limit must be a positive number, not %v", v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", PixelfedAccountSourceType, k)
+			return
+		}
+	}
+	if ps.instance == "" {
+		err = errors.New("'instance' parameter is not set")
+		return
+	}
+	if ps.userName == "" {
+		err = errors.New("'user' parameter is not set")
+		return
+	}
+	return ps, nil
+}
+
+func (ps *PixelfedAccountSource) Type() string {
+	return PixelfedAccountSourceType
+}
+
+func (ps *PixelfedAccountSource) Id() string {
+	return IdEncodeStrings(ps.Type(), ps.instance, ps.userName)
+}
+
+func (ps *PixelfedAccountSource) Upstreams() []string {
+	return []string{ps.instance}
+}
+
+// the optional token is verified with the account it belongs to
+func (ps *PixelfedAccountSource) CheckCredentials() error {
+	if ps.token == "" {
+		return nil
+	}
+	var account struct {
+		Id string `json:"id"`
+	}
+	return ps.get("/api/v1/accounts/verify_credentials", url.Values{}, &account)
+}
+
+// pixelfedError is returned for failed api requests
+type pixelfedError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *pixelfedError) Error() string {
+	return fmt.Sprintf("Pixelfed API: %v", e.Message)
+}
+
+func (e *pixelfedError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+type pixelfedStatus struct {
+	Id        string    `json:"id"`
+	Url       string    `json:"url"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Sensitive bool      `json:"sensitive"`
+	Tags      []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	MediaAttachments []struct {
+		Type        string `json:"type"`
+		Url         string `json:"url"`
+		Description string `json:"description"`
+	} `json:"media_attachments"`
+}
+
+// call the api of the instance and decode the json response
+func (ps *PixelfedAccountSource) get(path string, query url.Values, v interface{}) (err error) {
+	req, err := http.NewRequest("GET", ps.instance+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	if ps.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ps.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		message := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != "" {
+			message = errResp.Error
+		}
+		return &pixelfedError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (ps *PixelfedAccountSource) GetBlocks() (blocks []*Block, err error) {
+	var account struct {
+		Id string `json:"id"`
+	}
+	err = ps.get("/api/v1/accounts/lookup", url.Values{"acct": {ps.userName}}, &account)
+	if err != nil {
+		return
+	}
+
+	query := url.Values{}
+	query.Set("only_media", "true")
+	query.Set("exclude_replies", "true")
+	query.Set("exclude_reblogs", "true")
+	query.Set("limit", strconv.Itoa(ps.limit))
+	var statuses []pixelfedStatus
+	err = ps.get("/api/v1/accounts/"+account.Id+"/statuses", query, &statuses)
+	if err != nil {
+		return
+	}
+
+	for _, status := range statuses {
+		// posts with content warnings are not shown
+		if status.Sensitive || len(status.MediaAttachments) == 0 {
+			continue
+		}
+		attachment := status.MediaAttachments[0]
+		if attachment.Type != "image" {
+			continue
+		}
+
+		block := NewBlock(ps)
+		text, _, htmlErr := ExtractHtml(status.Content)
+		if htmlErr != nil {
+			text = ""
+		}
+		block.Title = Summarize(strings.SplitN(text, "\n", 2)[0], pixelfedTitleLength)
+		// the alt text describes the image
+		block.Content = attachment.Description
+		block.ImageLink = attachment.Url
+		block.Link = status.Url
+		block.TimeStamp = status.CreatedAt.UTC()
+		for _, tag := range status.Tags {
+			block.Tags = append(block.Tags, tag.Name)
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
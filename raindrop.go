@@ -0,0 +1,192 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	RaindropCollectionSourceType = "raindrop-collection"
+
+	raindropApiUrl = "https://api.raindrop.io/rest/v1"
+	// bookmarks per request allowed by the api
+	raindropMaxPerPage = 50
+)
+
+// RaindropCollectionSource provides the bookmarks of a Raindrop.io
+// collection with their cover images
+type RaindropCollectionSource struct {
+	// test token of an integration, or an access token
+	token string
+	// id of the collection. 0 are all bookmarks except the trash,
+	// -1 the unsorted ones
+	collection string
+	// only bookmarks with this tag
+	tag   string
+	limit int
+}
+
+func NewRaindropCollectionSource(params SourceParams) (rs *RaindropCollectionSource, err error) {
+	rs = &RaindropCollectionSource{
+		collection: "0",
+		limit:      25,
+	}
+	for k, v := range params {
+		switch k {
+		case "token":
+			rs.token = v
+		case "collection":
+			if _, convErr := strconv.Atoi(v); convErr != nil {
+				err = fmt.Errorf("collection must be the numeric id of the collection, not %v", v)
+				return
+			}
+			rs.collection = v
+		case "tag":
+			rs.tag = v
+		case "limit":
+			rs.limit, err = strconv.Atoi(v)
+			if err != nil || rs.limit < 1 {
+				err = fmt.Errorf("limit must be a positive number, not %v", v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", RaindropCollectionSourceType, k)
+			return
+		}
+	}
+	if rs.token == "" {
+		err = errors.New("'token' parameter is not set")
+		return
+	}
+	return rs, nil
+}
+
+func (rs *RaindropCollectionSource) Type() string {
+	return RaindropCollectionSourceType
+}
+
+func (rs *RaindropCollectionSource) Id() string {
+	return IdEncodeStrings(rs.Type(), rs.collection, rs.tag)
+}
+
+func (rs *RaindropCollectionSource) Upstreams() []string {
+	return []string{raindropApiUrl}
+}
+
+// the user of the token is only returned for valid tokens
+func (rs *RaindropCollectionSource) CheckCredentials() error {
+	var user struct {
+		User struct {
+			Id int `json:"_id"`
+		} `json:"user"`
+	}
+	return rs.get("/user", url.Values{}, &user)
+}
+
+// raindropError is returned for failed api requests
+type raindropError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *raindropError) Error() string {
+	return fmt.Sprintf("Raindrop.io API: %v", e.Message)
+}
+
+func (e *raindropError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+type raindropItemsResponse struct {
+	Items []struct {
+		Title   string    `json:"title"`
+		Excerpt string    `json:"excerpt"`
+		Note    string    `json:"note"`
+		Link    string    `json:"link"`
+		Cover   string    `json:"cover"`
+		Created time.Time `json:"created"`
+		Tags    []string  `json:"tags"`
+		// link, article, image, video, document or audio
+		Type   string `json:"type"`
+		Domain string `json:"domain"`
+	} `json:"items"`
+	Count int `json:"count"`
+}
+
+// call the api and decode the json response
+func (rs *RaindropCollectionSource) get(path string, query url.Values, v interface{}) (err error) {
+	req, err := http.NewRequest("GET", raindropApiUrl+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+rs.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			ErrorMessage string `json:"errorMessage"`
+		}
+		message := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.ErrorMessage != "" {
+			message = errResp.ErrorMessage
+		}
+		return &raindropError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (rs *RaindropCollectionSource) GetBlocks() (blocks []*Block, err error) {
+	query := url.Values{}
+	query.Set("sort", "-created")
+	query.Set("perpage", strconv.Itoa(raindropMaxPerPage))
+	if rs.tag != "" {
+		query.Set("search", "#"+strconv.Quote(rs.tag))
+	}
+
+	for page := 0; len(blocks) < rs.limit; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var items raindropItemsResponse
+		err = rs.get("/raindrops/"+rs.collection, query, &items)
+		if err != nil {
+			return
+		}
+		for _, item := range items.Items {
+			if len(blocks) >= rs.limit {
+				break
+			}
+			block := NewBlock(rs)
+			block.Title = item.Title
+			block.Link = item.Link
+			// the own note describes why the page was bookmarked
+			block.Content = item.Note
+			if block.Content == "" {
+				block.Content = item.Excerpt
+			}
+			block.ImageLink = item.Cover
+			block.TimeStamp = item.Created.UTC()
+			block.Tags = item.Tags
+			block.SetMeta("domain", item.Domain)
+			blocks = append(blocks, block)
+		}
+		// check if the last page has been reached
+		if len(items.Items) < raindropMaxPerPage || (page+1)*raindropMaxPerPage >= items.Count {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,151 @@
+package honeybee
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// header of the recorded responses naming the request they belong to
+const recordedRequestHeader = "X-Honeybee-Recorded-Request"
+
+// query parameters which are not part of the name of a recording. These
+// hold credentials or change with every request, like oauth nonces.
+var recorderIgnoredParams = []string{"api_key", "key", "consumer_key", "access_token", "token", "api_sig",
+	"X-Amz-Credential", "X-Amz-Date", "X-Amz-Security-Token", "X-Amz-Signature"}
+
+// UpstreamRecorder stores the responses of upstream servers in a directory
+// and replays them later on, so sources can be developed and tested
+// without network access or API keys. Each response is kept in its own
+// file, named after a hash of the method, url and body of the request.
+// Credentials in headers and query parameters do not change the names.
+type UpstreamRecorder struct {
+	directory string
+	replay    bool
+	next      http.RoundTripper
+}
+
+// route all requests to upstream servers through a recorder. With replay
+// the recorded responses are served instead, requests which have not
+// been recorded fail.
+func InstallUpstreamRecorder(directory string, replay bool) error {
+	if replay {
+		finfo, err := os.Stat(directory)
+		if err != nil {
+			return fmt.Errorf("Could not open the recordings: %w", err)
+		}
+		if !finfo.IsDir() {
+			return fmt.Errorf("%v should be a directory", directory)
+		}
+	} else {
+		err := os.MkdirAll(directory, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	http.DefaultTransport = &UpstreamRecorder{
+		directory: directory,
+		replay:    replay,
+		next:      http.DefaultTransport,
+	}
+	return nil
+}
+
+func (ur *UpstreamRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	name := recordingName(req, body)
+	path := filepath.Join(ur.directory, name+".http")
+
+	if ur.replay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("No recorded response for %v %v: %w", req.Method, redactedUrl(req), err)
+		}
+		logDebugf("Replaying %v %v from %v", req.Method, redactedUrl(req), path)
+		return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	}
+
+	// a RoundTripper must not modify the request
+	forwarded := req.Clone(req.Context())
+	if body != nil {
+		forwarded.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := ur.next.RoundTrip(forwarded)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// store the decoded body with its exact length
+	recorded := *resp
+	recorded.Header = resp.Header.Clone()
+	recorded.Header.Set(recordedRequestHeader, req.Method+" "+redactedUrl(req))
+	recorded.Header.Del("Content-Encoding")
+	recorded.Header.Del("Set-Cookie")
+	recorded.TransferEncoding = nil
+	recorded.ContentLength = int64(len(respBody))
+	recorded.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	buf := new(bytes.Buffer)
+	err = recorded.Write(buf)
+	if err == nil {
+		err = ioutil.WriteFile(path, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		logInfof("Could not record the response of %v: %v", redactedUrl(req), err)
+	} else {
+		logDebugf("Recorded %v %v to %v", req.Method, redactedUrl(req), path)
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// name of the recording of a request
+func recordingName(req *http.Request, body []byte) string {
+	h := sha1.New()
+	io.WriteString(h, req.Method)
+	io.WriteString(h, " ")
+	io.WriteString(h, redactedUrl(req))
+	io.WriteString(h, "\n")
+	h.Write(body)
+	return req.URL.Hostname() + "-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// url of a request without credentials and oauth parameters. The
+// remaining query parameters are sorted.
+func redactedUrl(req *http.Request) string {
+	u := *req.URL
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "oauth_") {
+			query.Del(key)
+		}
+	}
+	for _, key := range recorderIgnoredParams {
+		query.Del(key)
+	}
+	// the parameters are encoded sorted by key
+	u.RawQuery = query.Encode()
+	u.User = nil
+	return u.String()
+}
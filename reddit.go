@@ -0,0 +1,232 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RedditSourceType = "reddit"
+
+	redditBaseUrl = "https://www.reddit.com"
+	// reddit throttles requests with generic user agents
+	redditUserAgent = "honeybee (+https://github.com/nmandery/honeybee)"
+	// the listings return at most this many posts
+	redditMaxLimit = 100
+)
+
+// time periods of the top posts of a subreddit, as named by reddit
+var redditPeriods = map[string]bool{
+	"hour":  true,
+	"day":   true,
+	"week":  true,
+	"month": true,
+	"year":  true,
+	"all":   true,
+}
+
+// RedditSource provides the submissions of a user or the top posts
+// of a subreddit using the public json listings
+type RedditSource struct {
+	userName  string
+	subreddit string
+	// time period of the top posts of the subreddit
+	period string
+	limit  int
+}
+
+func NewRedditSource(params SourceParams) (rs *RedditSource, err error) {
+	rs = &RedditSource{
+		period: "week",
+		limit:  25,
+	}
+	for k, v := range params {
+		switch k {
+		case "user":
+			rs.userName = strings.TrimPrefix(strings.TrimPrefix(v, "/"), "u/")
+		case "subreddit":
+			rs.subreddit = strings.TrimPrefix(strings.TrimPrefix(v, "/"), "r/")
+		case "period":
+			if !redditPeriods[v] {
+				err = fmt.Errorf("Unknown period for %v: %v", RedditSourceType, v)
+				return
+			}
+			rs.period = v
+		case "limit":
+			rs.limit, err = strconv.Atoi(v)
+			if err != nil || rs.limit < 1 || rs.limit > redditMaxLimit {
+				err = fmt.Errorf("limit must be a number from 1 to %d, not %v", redditMaxLimit, v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", RedditSourceType, k)
+			return
+		}
+	}
+	if (rs.userName == "") == (rs.subreddit == "") {
+		err = errors.New("either the 'user' or the 'subreddit' parameter must be set")
+		return
+	}
+	return rs, nil
+}
+
+func (rs *RedditSource) Type() string {
+	return RedditSourceType
+}
+
+func (rs *RedditSource) Id() string {
+	if rs.subreddit != "" {
+		return IdEncodeStrings(rs.Type(), "r", rs.subreddit, rs.period)
+	}
+	return IdEncodeStrings(rs.Type(), "u", rs.userName)
+}
+
+func (rs *RedditSource) Upstreams() []string {
+	return []string{redditBaseUrl}
+}
+
+// redditError is returned for failed requests
+type redditError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *redditError) Error() string {
+	return fmt.Sprintf("Reddit: %v", e.Message)
+}
+
+func (e *redditError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		// private or banned subreddits and suspended users
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return ErrorKindNetwork
+	}
+	return ErrorKindOther
+}
+
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Kind string     `json:"kind"`
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	Title       string  `json:"title"`
+	Permalink   string  `json:"permalink"`
+	Url         string  `json:"url"`
+	SelfText    string  `json:"selftext"`
+	IsSelf      bool    `json:"is_self"`
+	Over18      bool    `json:"over_18"`
+	Spoiler     bool    `json:"spoiler"`
+	CreatedUtc  float64 `json:"created_utc"`
+	Subreddit   string  `json:"subreddit"`
+	Author      string  `json:"author"`
+	Score       int     `json:"score"`
+	NumComments int     `json:"num_comments"`
+	FlairText   string  `json:"link_flair_text"`
+	PostHint    string  `json:"post_hint"`
+	Preview     struct {
+		Images []struct {
+			Source struct {
+				Url string `json:"url"`
+			} `json:"source"`
+		} `json:"images"`
+	} `json:"preview"`
+}
+
+// the full size preview of the post, or the linked image itself
+func (p *redditPost) imageUrl() string {
+	if len(p.Preview.Images) > 0 && p.Preview.Images[0].Source.Url != "" {
+		return p.Preview.Images[0].Source.Url
+	}
+	if p.PostHint == "image" {
+		return p.Url
+	}
+	return ""
+}
+
+func (rs *RedditSource) listingUrl() string {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(rs.limit))
+	// urls in the response are not html escaped
+	query.Set("raw_json", "1")
+	if rs.subreddit != "" {
+		query.Set("t", rs.period)
+		return redditBaseUrl + "/r/" + url.PathEscape(rs.subreddit) + "/top.json?" + query.Encode()
+	}
+	query.Set("sort", "new")
+	return redditBaseUrl + "/user/" + url.PathEscape(rs.userName) + "/submitted.json?" + query.Encode()
+}
+
+func (rs *RedditSource) GetBlocks() (blocks []*Block, err error) {
+	req, err := http.NewRequest("GET", rs.listingUrl(), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", redditUserAgent)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Message string `json:"message"`
+			Reason  string `json:"reason"`
+		}
+		message := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Message != "" {
+			message = errResp.Message
+			if errResp.Reason != "" {
+				message += " (" + errResp.Reason + ")"
+			}
+		}
+		return nil, &redditError{StatusCode: resp.StatusCode, Message: message}
+	}
+	var listing redditListing
+	err = json.NewDecoder(resp.Body).Decode(&listing)
+	if err != nil {
+		return
+	}
+
+	for _, child := range listing.Data.Children {
+		post := child.Data
+		// comments are not part of the listings used, but nsfw posts are
+		if child.Kind != "t3" || post.Over18 || post.Spoiler {
+			continue
+		}
+		block := NewBlock(rs)
+		block.Title = post.Title
+		block.Link = redditBaseUrl + post.Permalink
+		block.Content = post.SelfText
+		if !post.IsSelf {
+			// the linked page, to have it in the links of the block
+			block.Content = post.Url
+		}
+		block.ImageLink = post.imageUrl()
+		block.TimeStamp = time.Unix(int64(post.CreatedUtc), 0).UTC()
+		if post.FlairText != "" {
+			block.Tags = []string{post.FlairText}
+		}
+		block.SetMeta("subreddit", post.Subreddit)
+		block.SetMeta("author", post.Author)
+		block.SetMeta("score", strconv.Itoa(post.Score))
+		block.SetMeta("comments", strconv.Itoa(post.NumComments))
+		blocks = append(blocks, block)
+	}
+	return
+}
@@ -0,0 +1,167 @@
+package honeybee
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"log"
+	"time"
+)
+
+// prefix of all keys used by the redis cache
+const redisCacheKeyPrefix = "honeybee:cache:"
+
+// RedisCache stores the cache entries in a redis server, allowing
+// multiple instances to share one cache
+type RedisCache struct {
+	pool *redis.Pool
+
+	// see ForgettingCache
+	forgetPercent int
+	forgetCounter int
+}
+
+func newRedisPool(config *RedisConfiguration) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", config.Address,
+				redis.DialPassword(config.Password),
+				redis.DialDatabase(config.Database))
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+func NewRedisCache(config *RedisConfiguration) (rc *RedisCache, err error) {
+	rc = &RedisCache{
+		pool:          newRedisPool(config),
+		forgetPercent: 10,
+		forgetCounter: 0,
+	}
+
+	// fail early when the server is not reachable
+	conn := rc.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("PING")
+	if err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func (rc *RedisCache) Get(key string) (resp []byte, ok bool) {
+	storageKey := keyToFilename(key)
+	entry, err := rc.ReadEntry(storageKey)
+	if err != nil {
+		if err != redis.ErrNil {
+			log.Printf("Could not read from redis cache: %v", err)
+		}
+		return []byte{}, false
+	}
+	resp, err = decodeCacheEntry(entry)
+	if err != nil {
+		log.Printf("Evicting cache entry %s: %v", storageKey, err)
+		rc.erase(storageKey)
+		return []byte{}, false
+	}
+	return resp, true
+}
+
+func (rc *RedisCache) Set(key string, resp []byte) {
+	err := rc.WriteEntry(keyToFilename(key), encodeCacheEntry(resp))
+	if err != nil {
+		log.Printf("Could not write to redis cache: %v", err)
+	}
+}
+
+func (rc *RedisCache) Delete(key string) {
+	rc.erase(keyToFilename(key))
+}
+
+func (rc *RedisCache) erase(storageKey string) {
+	conn := rc.pool.Get()
+	defer conn.Close()
+	conn.Do("DEL", redisCacheKeyPrefix+storageKey)
+}
+
+func (rc *RedisCache) DeleteEntry(storageKey string) {
+	rc.erase(storageKey)
+}
+
+// see ForgettingCache.DeleteSome
+func (rc *RedisCache) DeleteSome() {
+	modValue := 1
+	if rc.forgetPercent > 0 && rc.forgetPercent <= 100 {
+		modValue = 100 / rc.forgetPercent
+	}
+
+	for storageKey := range rc.StorageKeys() {
+		if shouldForget(storageKey, modValue, rc.forgetCounter) {
+			rc.erase(storageKey)
+			cacheEvictionsVar.Add(RedisCacheBackend, 1)
+		}
+	}
+
+	rc.forgetCounter++
+	if rc.forgetCounter == modValue {
+		rc.forgetCounter = 0
+	}
+}
+
+func (rc *RedisCache) DeleteAll() {
+	for storageKey := range rc.StorageKeys() {
+		rc.erase(storageKey)
+	}
+}
+
+// iterate over all keys of the cache using SCAN. The keys are
+// returned without the prefix
+func (rc *RedisCache) StorageKeys() <-chan string {
+	keyChan := make(chan string)
+	go func() {
+		defer close(keyChan)
+		conn := rc.pool.Get()
+		defer conn.Close()
+
+		cursor := 0
+		for {
+			values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", redisCacheKeyPrefix+"*", "COUNT", 500))
+			if err != nil {
+				log.Printf("Could not list keys of redis cache: %v", err)
+				return
+			}
+			var keys []string
+			_, err = redis.Scan(values, &cursor, &keys)
+			if err != nil {
+				log.Printf("Could not list keys of redis cache: %v", err)
+				return
+			}
+			for _, key := range keys {
+				keyChan <- key[len(redisCacheKeyPrefix):]
+			}
+			if cursor == 0 {
+				return
+			}
+		}
+	}()
+	return keyChan
+}
+
+func (rc *RedisCache) ReadEntry(storageKey string) ([]byte, error) {
+	conn := rc.pool.Get()
+	defer conn.Close()
+	return redis.Bytes(conn.Do("GET", redisCacheKeyPrefix+storageKey))
+}
+
+func (rc *RedisCache) WriteEntry(storageKey string, entry []byte) error {
+	conn := rc.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", redisCacheKeyPrefix+storageKey, entry)
+	return err
+}
@@ -0,0 +1,150 @@
+package honeybee
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"log"
+	"os"
+	"time"
+)
+
+// time to wait for further changes before reloading. Editors and
+// kubernetes ConfigMap updates write several files at once.
+const watchSettleTime = 2 * time.Second
+
+// replace the sources, pages and templates by the ones of a new
+// configuration. Settings which are only used when the server is
+// created, like the port or the cache, keep their current values.
+// The blocks of sources which are still configured are kept.
+//
+// Sources which are not part of the current configuration are pulled
+// before anything gets replaced. When one of them fails, the reload is
+// aborted and the server keeps running with the current configuration.
+func (s *Server) Reload(config *Configuration) error {
+	s.reloadMtx.RLock()
+	current := s.config
+	currentSources := s.sources
+	s.reloadMtx.RUnlock()
+
+	config.Http = current.Http
+	config.Cache = current.Cache
+	config.Cluster = current.Cluster
+	config.Logging = current.Logging
+	config.Image = current.Image
+	config.Admin = current.Admin
+	config.Micropub = current.Micropub
+	config.Store.File = current.Store.File
+	config.ReadOnly = current.ReadOnly
+
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+	sources, pages, templ, err := setupSite(config)
+	if err != nil {
+		return err
+	}
+
+	var newSources Sources
+	for _, source := range sources {
+		if _, found := currentSources.Get(source.Id()); !found {
+			newSources = append(newSources, source)
+		}
+	}
+	pipeline := NewPipeline(config, sources, s.imgProxy)
+	if len(newSources) > 0 && !config.ReadOnly {
+		log.Printf("Trying %d new sources ...", len(newSources))
+		newSources = newSources.Unfiltered()
+		err = newSources.SendBlocksTo(pipeline, nil)
+		if err != nil {
+			return fmt.Errorf("Keeping the current sources, the new ones failed: %w", err)
+		}
+	}
+	newBlocks, err := pipeline.GetBlocks()
+	if err != nil {
+		return err
+	}
+
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+
+	// move the blocks over to the new sources
+	blocks := s.blockStore.List()
+	records := make([]BlockRecord, len(blocks))
+	for i, block := range blocks {
+		records[i] = block.Record()
+	}
+	blocks = BlocksFromRecords(records, sources)
+	if len(blocks) < len(records) {
+		log.Printf("Dropped %d blocks of sources which are not configured anymore.",
+			len(records)-len(blocks))
+	}
+
+	s.config = config
+	s.sources = sources
+	s.imgProxy.SetUrlSigners(sources)
+	s.pages = pages
+	s.templ = templ
+	for i, sourceconfig := range config.Sources {
+		s.status.SetMaxAuthFailures(sources[i], sourceconfig.MaxAuthFailures)
+	}
+	if config.HasPipelineStage(SummarizeStage) {
+		SummarizeBlocks(blocks, config.Summary.MaxLength)
+	}
+	s.blockStore.Replace(blocks)
+	s.blockStore.ReceiveBlocks(newBlocks)
+	s.trimStore()
+	return s.blocksChanged()
+}
+
+// watch the configuration directory and its templates for changes and call
+// changed once the files have settled. The directories are watched instead
+// of the files, as kubernetes replaces the files of mounted ConfigMaps
+// by swapping a symlink.
+func WatchConfiguration(config *Configuration, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	directories := []string{config.Directory}
+	if config.Theme != BuiltinTheme {
+		directories = append(directories, config.TemplateDirectory())
+	}
+	for _, directory := range directories {
+		if _, statErr := os.Stat(directory); statErr != nil {
+			continue
+		}
+		err = watcher.Add(directory)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		logDebugf("Watching %v for changes", directory)
+	}
+
+	go func() {
+		var settle *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				logDebugf("Configuration changed: %v", event)
+				if settle != nil {
+					settle.Stop()
+				}
+				settle = time.AfterFunc(watchSettleTime, changed)
+			case watchErr, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Error watching the configuration: %v", watchErr)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,87 @@
+package honeybee
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// render the index page of a site without running the server. With
+// fixtures the configured sources are replaced by a fixture source,
+// otherwise the blocks of the store file are used. Relative times are
+// calculated against now, so the output is reproducible.
+func Render(w io.Writer, config *Configuration, fixtures bool, now time.Time) (err error) {
+	if fixtures {
+		config.Sources = []SourceConfiguration{{
+			Type: FixtureSourceType,
+			Params: SourceParams{
+				"images": "http://localhost/placeholder/",
+			},
+		}}
+		// pages refer to the configured sources
+		config.Pages = nil
+	}
+	err = config.Validate()
+	if err != nil {
+		return
+	}
+
+	sources, err := CreateSources(config)
+	if err != nil {
+		return
+	}
+	pages, err := CreatePages(config, sources)
+	if err != nil {
+		return
+	}
+	var templ TemplateEngine
+	funcs, err := templateFuncs(config, func() time.Time { return now }, func(name string) bool {
+		return templ != nil && templ.HasTemplate(name)
+	})
+	if err != nil {
+		return
+	}
+	templ, err = newTemplateEngine(config, funcs)
+	if err != nil {
+		return
+	}
+
+	var blocks []*Block
+	if fixtures {
+		blocks, err = sources[0].GetBlocks()
+		if err != nil {
+			return
+		}
+	} else {
+		if config.Store.File == "" {
+			return errors.New("Rendering without fixtures requires a store file")
+		}
+		var records []BlockRecord
+		records, err = LoadBlockRecords(config.Store.File)
+		if err != nil {
+			return
+		}
+		blocks = BlocksFromRecords(records, sources)
+	}
+	if config.HasPipelineStage(SummarizeStage) {
+		SummarizeBlocks(blocks, config.Summary.MaxLength)
+	}
+
+	srv := &Server{
+		config:      config,
+		sources:     sources,
+		blockStore:  NewBlockStore(),
+		templ:       templ,
+		pages:       pages,
+		renderedMtx: new(sync.Mutex),
+		warmedUp:    true,
+	}
+	srv.blockStore.Replace(blocks)
+	err = srv.renderPage(w, nil)
+	if err != nil {
+		return fmt.Errorf("Could not render the index page: %w", err)
+	}
+	return nil
+}
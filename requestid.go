@@ -0,0 +1,85 @@
+package honeybee
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// header carrying the id of a request. Ids sent by a proxy in front of
+// honeybee are kept, so its logs can be matched with the ones of honeybee.
+const RequestIdHeader = "X-Request-ID"
+
+// ids accepted from clients, which end up in the logs
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type requestIdKey struct{}
+
+// the id of the request a context belongs to, empty for work which was
+// not started by a request, like the updates of the sources
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+func contextWithRequestId(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// assign an id to a request, or keep the valid one it came with, and
+// return it to the client in the response headers
+func identifyRequest(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(RequestIdHeader)
+	if !validRequestId.MatchString(id) {
+		id = newRequestId()
+	}
+	w.Header().Set(RequestIdHeader, id)
+	return r.WithContext(contextWithRequestId(r.Context(), id))
+}
+
+// reply with an error message mentioning the id of the request, so a
+// reported error can be found in the logs
+func httpError(w http.ResponseWriter, r *http.Request, message string, code int) {
+	if id := RequestId(r.Context()); id != "" {
+		message = fmt.Sprintf("%v (request %v)", message, id)
+	}
+	http.Error(w, message, code)
+}
+
+// prefix of the log messages concerning a request
+func requestLogPrefix(ctx context.Context) string {
+	if id := RequestId(ctx); id != "" {
+		return "[" + id + "] "
+	}
+	return ""
+}
+
+// log functions prefixing the messages with the id of the request of ctx
+func requestPrintf(ctx context.Context, format string, v ...interface{}) {
+	log.Print(requestLogPrefix(ctx) + fmt.Sprintf(format, v...))
+}
+
+func requestInfof(ctx context.Context, format string, v ...interface{}) {
+	if logLevel >= LogLevelInfo {
+		requestPrintf(ctx, format, v...)
+	}
+}
+
+func requestDebugf(ctx context.Context, format string, v ...interface{}) {
+	if logLevel >= LogLevelDebug {
+		requestPrintf(ctx, format, v...)
+	}
+}
@@ -0,0 +1,367 @@
+package honeybee
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	S3BucketSourceType = "s3-bucket"
+
+	s3DefaultRegion = "us-east-1"
+	s3DefaultLimit  = 50
+	// validity of the presigned urls. They are used right away by the
+	// image proxy, which signs the url again for every download
+	s3PresignExpiry = 15 * time.Minute
+
+	awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+	awsTimeFormat       = "20060102T150405Z"
+	awsUnsignedPayload  = "UNSIGNED-PAYLOAD"
+)
+
+// file extensions of the objects listed as blocks
+var s3ImageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// S3BucketSource provides the images in a bucket of S3 or a compatible
+// object storage like MinIO, newest first. Objects of private buckets
+// are fetched by the image proxy using presigned urls.
+type S3BucketSource struct {
+	endpoint     string
+	region       string
+	bucket       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	limit        int
+}
+
+func NewS3BucketSource(params SourceParams) (ss *S3BucketSource, err error) {
+	ss = &S3BucketSource{
+		region: s3DefaultRegion,
+		limit:  s3DefaultLimit,
+	}
+	for k, v := range params {
+		switch k {
+		case "endpoint":
+			ss.endpoint = strings.TrimSuffix(v, "/")
+		case "region":
+			ss.region = v
+		case "bucket":
+			ss.bucket = v
+		case "prefix":
+			ss.prefix = v
+		case "access-key":
+			ss.accessKey = v
+		case "secret-key":
+			ss.secretKey = v
+		case "session-token":
+			ss.sessionToken = v
+		case "limit":
+			ss.limit, err = strconv.Atoi(v)
+			if err != nil || ss.limit < 1 {
+				err = fmt.Errorf("Limit of %v has to be a positive number: %v", S3BucketSourceType, v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", S3BucketSourceType, k)
+			return
+		}
+	}
+	if ss.bucket == "" {
+		err = errors.New("S3 source needs a bucket")
+		return
+	}
+	if (ss.accessKey == "") != (ss.secretKey == "") {
+		err = errors.New("S3 source needs both an access-key and a secret-key")
+		return
+	}
+	if ss.endpoint == "" {
+		ss.endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", ss.region)
+	}
+	endpointUrl, parseErr := url.Parse(ss.endpoint)
+	if parseErr != nil || endpointUrl.Host == "" || (endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https") {
+		err = fmt.Errorf("Unusable endpoint for %v: %v", S3BucketSourceType, ss.endpoint)
+		return
+	}
+	return ss, nil
+}
+
+func (ss *S3BucketSource) Type() string {
+	return S3BucketSourceType
+}
+
+func (ss *S3BucketSource) Id() string {
+	return IdEncodeStrings(ss.Type(), ss.endpoint, ss.bucket, ss.prefix)
+}
+
+func (ss *S3BucketSource) Upstreams() []string {
+	return []string{ss.endpoint}
+}
+
+// listing a single object is refused for invalid credentials
+func (ss *S3BucketSource) CheckCredentials() error {
+	_, err := ss.listObjects("", 1)
+	return err
+}
+
+// s3Error is returned for failed requests
+type s3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("S3: %v", e.Code)
+	}
+	return fmt.Sprintf("S3: %v: %v", e.Code, e.Message)
+}
+
+func (e *s3Error) ErrorKind() ErrorKind {
+	switch e.Code {
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken":
+		return ErrorKindAuth
+	case "SlowDown", "RequestLimitExceeded":
+		return ErrorKindRateLimit
+	}
+	switch e.StatusCode {
+	case http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusServiceUnavailable:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list a page of the objects below the prefix
+func (ss *S3BucketSource) listObjects(continuationToken string, maxKeys int) (result s3ListBucketResult, err error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", ss.prefix)
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	if continuationToken != "" {
+		query.Set("continuation-token", continuationToken)
+	}
+	req, err := http.NewRequest("GET", ss.endpoint+"/"+awsEscape(ss.bucket, true)+"?"+awsCanonicalQuery(query), nil)
+	if err != nil {
+		return
+	}
+	ss.signRequest(req, time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &s3Error{StatusCode: resp.StatusCode, Code: resp.Status}
+		xml.NewDecoder(resp.Body).Decode(apiErr)
+		return result, apiErr
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	return
+}
+
+// url of an object, without any signature
+func (ss *S3BucketSource) objectUrl(key string) string {
+	return ss.endpoint + "/" + awsEscape(ss.bucket, true) + "/" + awsEscape(key, false)
+}
+
+func (ss *S3BucketSource) GetBlocks() (blocks []*Block, err error) {
+	var continuationToken string
+	for {
+		var result s3ListBucketResult
+		result, err = ss.listObjects(continuationToken, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			extension := strings.ToLower(path.Ext(object.Key))
+			if !s3ImageExtensions[extension] {
+				continue
+			}
+			block := NewBlock(ss)
+			block.Title = strings.TrimSuffix(strings.TrimPrefix(object.Key, ss.prefix), path.Ext(object.Key))
+			block.Title = strings.TrimPrefix(block.Title, "/")
+			block.ImageLink = ss.objectUrl(object.Key)
+			if ss.accessKey == "" {
+				// objects of private buckets can not be linked
+				block.Link = block.ImageLink
+			}
+			block.TimeStamp = object.LastModified
+			blocks = append(blocks, block)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].TimeStamp.After(blocks[j].TimeStamp)
+	})
+	if len(blocks) > ss.limit {
+		blocks = blocks[:ss.limit]
+	}
+	return blocks, nil
+}
+
+// presign the urls of the objects of the blocks of the source. Urls of
+// public buckets are used as they are.
+func (ss *S3BucketSource) SignImageUrl(rawUrl string) (signed string, ok bool) {
+	if ss.accessKey == "" || !strings.HasPrefix(rawUrl, ss.objectUrl(ss.prefix)) {
+		return "", false
+	}
+	signed, err := ss.presign(rawUrl, time.Now(), s3PresignExpiry)
+	if err != nil {
+		return "", false
+	}
+	return signed, true
+}
+
+// add a signature valid for the given time to an url
+func (ss *S3BucketSource) presign(rawUrl string, now time.Time, expiry time.Duration) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	now = now.UTC()
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", awsSigningAlgorithm)
+	query.Set("X-Amz-Credential", ss.accessKey+"/"+ss.credentialScope(now))
+	query.Set("X-Amz-Date", now.Format(awsTimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if ss.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", ss.sessionToken)
+	}
+	canonicalQuery := awsCanonicalQuery(query)
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		awsEscape(u.Path, false),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		awsUnsignedPayload,
+	}, "\n")
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + ss.signature(now, canonicalRequest)
+	return u.String(), nil
+}
+
+// sign a request using the authorization header. Requests of sources
+// without credentials stay anonymous.
+func (ss *S3BucketSource) signRequest(req *http.Request, now time.Time) {
+	if ss.accessKey == "" {
+		return
+	}
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(awsTimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", awsUnsignedPayload)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + awsUnsignedPayload + "\n" +
+		"x-amz-date:" + now.Format(awsTimeFormat) + "\n"
+	if ss.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", ss.sessionToken)
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + ss.sessionToken + "\n"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, false),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		awsUnsignedPayload,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%v Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		awsSigningAlgorithm, ss.accessKey, ss.credentialScope(now), signedHeaders, ss.signature(now, canonicalRequest)))
+}
+
+func (ss *S3BucketSource) credentialScope(now time.Time) string {
+	return now.Format("20060102") + "/" + ss.region + "/s3/aws4_request"
+}
+
+// signature version 4 of a canonical request, see
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (ss *S3BucketSource) signature(now time.Time, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		awsSigningAlgorithm,
+		now.Format(awsTimeFormat),
+		ss.credentialScope(now),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	key := hmacSha256([]byte("AWS4"+ss.secretKey), now.Format("20060102"))
+	key = hmacSha256(key, ss.region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	return hex.EncodeToString(hmacSha256(key, stringToSign))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// percent-encode everything but the unreserved characters, as
+// required by the signatures. Slashes are kept in paths.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// query parameters sorted by name, encoded for signatures
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,273 @@
+package honeybee
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sent with the requests for pages and robots.txt files
+	scraperUserAgent = "honeybee (+https://github.com/nmandery/honeybee)"
+	// name matched against the user-agent lines of robots.txt files
+	scraperRobotsAgent = "honeybee"
+
+	// minimum time between two requests to the same host
+	scraperHostDelay = time.Second
+	// crawl-delays of robots.txt files are capped, pulls would
+	// stall for hours otherwise
+	scraperMaxHostDelay = time.Minute
+	// how long the rules of a robots.txt file are used
+	scraperRobotsTtl = 24 * time.Hour
+	// hosts whose robots.txt could not be fetched are not scraped
+	// for this long
+	scraperRobotsRetryInterval = time.Hour
+	// robots.txt files are not read beyond this size
+	scraperRobotsMaxSize = 512 * 1024
+)
+
+// the fetcher shared by the sources and modifiers reading web pages
+var politeFetcher = NewPoliteFetcher(newUpstreamClient(5, 10*time.Second))
+
+// PoliteFetcher fetches web pages of sites without apis. It honors the
+// robots.txt files of the sites and waits between requests to the
+// same host.
+type PoliteFetcher struct {
+	client *http.Client
+
+	hostsMtx sync.Mutex
+	hosts    map[string]*scrapedHost
+}
+
+// state of a host pages are fetched from
+type scrapedHost struct {
+	// held while waiting for the delay and while fetching the
+	// robots.txt, requests to the host run one after another
+	mtx           sync.Mutex
+	robots        *robotsRules
+	robotsExpires time.Time
+	lastRequest   time.Time
+}
+
+func NewPoliteFetcher(client *http.Client) *PoliteFetcher {
+	return &PoliteFetcher{
+		client: client,
+		hosts:  make(map[string]*scrapedHost),
+	}
+}
+
+func (pf *PoliteFetcher) host(u *url.URL) *scrapedHost {
+	key := u.Scheme + "://" + u.Host
+	pf.hostsMtx.Lock()
+	defer pf.hostsMtx.Unlock()
+	host, found := pf.hosts[key]
+	if !found {
+		host = new(scrapedHost)
+		pf.hosts[key] = host
+	}
+	return host
+}
+
+// get a page. ErrDisallowedByRobots is returned when the robots.txt of
+// the site does not allow honeybee to fetch it.
+func (pf *PoliteFetcher) Get(rawUrl string) (*http.Response, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Can not fetch %v: unsupported scheme", rawUrl)
+	}
+	host := pf.host(u)
+	host.mtx.Lock()
+	defer host.mtx.Unlock()
+
+	if time.Now().After(host.robotsExpires) {
+		host.robots, err = pf.fetchRobots(u)
+		host.lastRequest = time.Now()
+		if err != nil {
+			logInfof("Not scraping %v for %v, its robots.txt could not be read: %v", u.Host, scraperRobotsRetryInterval, err)
+			host.robots = disallowAllRobots
+			host.robotsExpires = time.Now().Add(scraperRobotsRetryInterval)
+		} else {
+			host.robotsExpires = time.Now().Add(scraperRobotsTtl)
+		}
+	}
+	if !host.robots.Allowed(u.RequestURI()) {
+		return nil, fmt.Errorf("%w: %v", ErrDisallowedByRobots, rawUrl)
+	}
+
+	delay := scraperHostDelay
+	if host.robots.crawlDelay > delay {
+		delay = host.robots.crawlDelay
+	}
+	if delay > scraperMaxHostDelay {
+		delay = scraperMaxHostDelay
+	}
+	time.Sleep(time.Until(host.lastRequest.Add(delay)))
+	host.lastRequest = time.Now()
+
+	req, err := http.NewRequest("GET", rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", scraperUserAgent)
+	return pf.client.Do(req)
+}
+
+// read the rules of the robots.txt of the host of u. Missing files
+// allow everything, server errors are returned.
+func (pf *PoliteFetcher) fetchRobots(u *url.URL) (*robotsRules, error) {
+	req, err := http.NewRequest("GET", u.Scheme+"://"+u.Host+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", scraperUserAgent)
+	resp, err := pf.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return parseRobots(io.LimitReader(resp.Body, scraperRobotsMaxSize), scraperRobotsAgent), nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, fmt.Errorf("Unexpected status: %v", resp.Status)
+	}
+	// no robots.txt, or one which is not public
+	return new(robotsRules), nil
+}
+
+// a rule of a robots.txt file
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// the rules of a robots.txt file which apply to one user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+var disallowAllRobots = &robotsRules{
+	rules: []robotsRule{{pattern: "/", allow: false}},
+}
+
+// read the rules of the group of a robots.txt for the agent, or those
+// of the "*" group when there is no group naming it. See RFC 9309.
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+	var own, wildcard *robotsRules
+	// the groups the current rules belong to
+	var current []*robotsRules
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+				inAgents = true
+			}
+			name := strings.ToLower(value)
+			if name == "*" {
+				if wildcard == nil {
+					wildcard = new(robotsRules)
+				}
+				current = append(current, wildcard)
+			} else if strings.HasPrefix(agent, name) {
+				if own == nil {
+					own = new(robotsRules)
+				}
+				current = append(current, own)
+			}
+			continue
+		}
+		inAgents = false
+		for _, rules := range current {
+			switch key {
+			case "allow", "disallow":
+				// an empty disallow allows everything
+				if value != "" {
+					rules.rules = append(rules.rules, robotsRule{pattern: value, allow: key == "allow"})
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	if own != nil {
+		return own
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return new(robotsRules)
+}
+
+// check a path, including its query, against the rules. The longest
+// matching pattern decides, allow wins over disallow for patterns of the
+// same length.
+func (rr *robotsRules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed := true
+	matched := -1
+	for _, rule := range rr.rules {
+		if !robotsPatternMatches(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > matched || (len(rule.pattern) == matched && rule.allow) {
+			allowed = rule.allow
+			matched = len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// patterns match the start of the path. "*" matches any sequence of
+// characters and a trailing "$" the end of the path.
+func robotsPatternMatches(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return !anchored || rest == ""
+}
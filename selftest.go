@@ -0,0 +1,163 @@
+package honeybee
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"time"
+)
+
+// timeout for establishing connections to upstream servers during the self test
+const selfTestDialTimeout = 10 * time.Second
+
+// sources fetching their blocks from remote servers implement
+// UpstreamSource to let the self test check the connectivity
+type UpstreamSource interface {
+	// urls of the servers the source talks to
+	Upstreams() []string
+}
+
+// sources using credentials implement CredentialChecker. The
+// credentials are verified using a cheap api call.
+type CredentialChecker interface {
+	CheckCredentials() error
+}
+
+type SelfTestResult struct {
+	Name string
+	Err  error
+}
+
+// the results of all checks of the self test
+type SelfTestReport []SelfTestResult
+
+func (r *SelfTestReport) add(name string, err error) {
+	*r = append(*r, SelfTestResult{Name: name, Err: err})
+}
+
+// true when all checks succeeded
+func (r SelfTestReport) Ready() bool {
+	for _, result := range r {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (r SelfTestReport) Write(w io.Writer) {
+	failed := 0
+	for _, result := range r {
+		if result.Err != nil {
+			fmt.Fprintf(w, "FAIL  %v: %v\n", result.Name, result.Err)
+			failed++
+		} else {
+			fmt.Fprintf(w, "ok    %v\n", result.Name)
+		}
+	}
+	if failed == 0 {
+		fmt.Fprintf(w, "\nReady: all %d checks passed\n", len(r))
+	} else {
+		fmt.Fprintf(w, "\nNot ready: %d of %d checks failed\n", failed, len(r))
+	}
+}
+
+// check the configuration, the cache, the templates and the
+// upstream servers and credentials of the sources
+func SelfTest(config *Configuration) (report SelfTestReport) {
+	err := config.Validate()
+	report.add("configuration", err)
+	if err != nil {
+		return
+	}
+
+	report.add("cache is writable", checkCache(&config.Cache))
+
+	// render a copy, as rendering fixtures replaces the sources
+	renderConfig := *config
+	report.add("templates render", Render(ioutil.Discard, &renderConfig, true, FixtureTime))
+
+	sources, err := CreateSources(config)
+	report.add("sources", err)
+	if err != nil {
+		return
+	}
+	checkedHosts := make(map[string]bool)
+	for _, source := range sources {
+		if fs, ok := source.(*FilteredSource); ok {
+			source = fs.nestedSource
+		}
+		if us, ok := source.(UpstreamSource); ok {
+			for _, upstream := range us.Upstreams() {
+				host, hostErr := upstreamHost(upstream)
+				if hostErr != nil {
+					report.add(fmt.Sprintf("upstream %v of %v", upstream, source.Type()), hostErr)
+					continue
+				}
+				if checkedHosts[host] {
+					continue
+				}
+				checkedHosts[host] = true
+				checkUpstream(&report, host)
+			}
+		}
+		if cc, ok := source.(CredentialChecker); ok {
+			report.add(fmt.Sprintf("credentials of %v %v", source.Type(), source.Id()), cc.CheckCredentials())
+		}
+	}
+	return
+}
+
+// write, read and delete an entry of the configured cache
+func checkCache(config *CacheConfiguration) error {
+	cache, err := CreateConfiguredCache(config)
+	if err != nil {
+		return err
+	}
+	key := "honeybee-selftest"
+	value := []byte(time.Now().String())
+	cache.Set(key, value)
+	defer cache.Delete(key)
+	if stored, found := cache.Get(key); !found || !bytes.Equal(stored, value) {
+		return errors.New("Written entry could not be read back")
+	}
+	return nil
+}
+
+// host and port of an upstream url
+func upstreamHost(upstream string) (host string, err error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("Url has no host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// resolve the name of an upstream server and connect to it
+func checkUpstream(report *SelfTestReport, host string) {
+	hostname, _, _ := net.SplitHostPort(host)
+	_, err := net.LookupHost(hostname)
+	report.add(fmt.Sprintf("dns %v", hostname), err)
+	if err != nil {
+		return
+	}
+	conn, err := net.DialTimeout("tcp", host, selfTestDialTimeout)
+	if err == nil {
+		conn.Close()
+	}
+	report.add(fmt.Sprintf("connect %v", host), err)
+}
@@ -1,13 +1,22 @@
 package honeybee
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"expvar"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
-	"github.com/peterbourgon/diskv"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
-	"path"
-	"text/template"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,60 +24,137 @@ type Server struct {
 	config         *Configuration
 	sources        Sources
 	blockStore     BlockStore
-	templ          *template.Template
+	templ          TemplateEngine
 	router         *httprouter.Router
 	imgProxy       *ImgProxy
 	doUpdatingChan chan bool
 	cache          Cache
+	cluster        *Cluster
+	status         *StatusRegistry
+	pages          []*Page
+	// removes unused cache entries. nil when disabled
+	cacheCollector *CacheCollector
+	// blocks of the recent previews of sources by the id of the preview.
+	// Their images are only served to the admin
+	previews    map[string]*adminPreview
+	previewsMtx *sync.Mutex
+
+	// routes mounted with Handle. Replaced as a whole when a route is
+	// added, so the handlers run without holding handlersMtx
+	handlers      *httprouter.Router
+	handlerRoutes []handlerRoute
+	handlersMtx   *sync.Mutex
+
+	// pages rendered after the last update
+	renderedIndex []byte
+	renderedPages map[string][]byte
+	renderedMtx   *sync.Mutex
+	// blocks have been pulled or loaded from the store file. Guarded by renderedMtx
+	warmedUp bool
+	// changes with the contents of the store. Guarded by renderedMtx
+	revision string
+
+	// held for writing while the configuration gets reloaded
+	reloadMtx *sync.RWMutex
+	// one entry for each request being handled. nil without a
+	// limit of the concurrent requests
+	requestSlots chan struct{}
 }
 
-// create a new server from the configuration directory
-func NewServer(config *Configuration) (srv *Server, err error) {
-	err = config.Validate()
+// create the sources, pages and templates of the configuration.
+// These are replaced when the configuration gets reloaded.
+func setupSite(config *Configuration) (sources Sources, pages []*Page, templ TemplateEngine, err error) {
+	sources, err = CreateSources(config)
 	if err != nil {
-		log.Printf("configuration problem: %v\n", err)
+		log.Printf("Could setup sources: %v\n", err)
 		return
 	}
 
-	sources, err := CreateSources(config)
+	pages, err = CreatePages(config, sources)
 	if err != nil {
-		log.Printf("Could setup sources: %v\n", err)
+		log.Printf("Could not setup pages: %v\n", err)
 		return
 	}
 
-	templ, err := template.New("t").ParseGlob(path.Join(config.TemplateDirectory(), "*.html"))
+	funcs, err := templateFuncs(config, time.Now, func(name string) bool {
+		return templ != nil && templ.HasTemplate(name)
+	})
 	if err != nil {
 		log.Printf("Could not setup templates: %v\n", err)
 		return
 	}
+	templ, err = newTemplateEngine(config, funcs)
+	if err != nil {
+		log.Printf("Could not setup templates: %v\n", err)
+		return
+	}
+	return
+}
 
-	err = EnsureDirectoryExists(config.Cache.Directory)
+// create a new server from the configuration directory
+func NewServer(config *Configuration) (srv *Server, err error) {
+	err = config.Validate()
+	if err != nil {
+		log.Printf("configuration problem: %v\n", err)
+		return
+	}
+
+	sources, pages, templ, err := setupSite(config)
+	if err != nil {
+		return
+	}
+
+	cache, err := CreateConfiguredCache(&config.Cache)
 	if err != nil {
-		log.Printf("Could not create cache directory: %v\n", err)
+		log.Printf("Could not setup the cache: %v\n", err)
 		return
 	}
-	cache := NewForgettingCache(
-		diskv.New(diskv.Options{
-			BasePath:     config.Cache.Directory,
-			CacheSizeMax: 0,
-			Transform:    cacheTransformKeyToPath,
-		}), 10)
 
 	imgProxy, err := NewImgProxy(config, cache)
 	if err != nil {
 		log.Printf("Could not setup caching proxy: %v\n", err)
 		return
 	}
+	imgProxy.SetUrlSigners(sources)
+
+	var cluster *Cluster
+	if config.Cluster.Enabled {
+		cluster, err = NewCluster(&config.Cache.Redis)
+		if err != nil {
+			log.Printf("Could not connect to the cluster: %v\n", err)
+			return
+		}
+	}
 
 	srv = &Server{
 		config:         config,
 		sources:        sources,
 		blockStore:     NewBlockStore(),
+		previews:       make(map[string]*adminPreview),
+		previewsMtx:    new(sync.Mutex),
 		templ:          templ,
 		router:         httprouter.New(),
+		handlersMtx:    new(sync.Mutex),
 		imgProxy:       imgProxy,
 		doUpdatingChan: make(chan bool),
 		cache:          cache,
+		cluster:        cluster,
+		status:         NewStatusRegistry(),
+		pages:          pages,
+		renderedMtx:    new(sync.Mutex),
+		reloadMtx:      new(sync.RWMutex),
+		// nothing is pulled in read-only mode, the pages stay as they are
+		warmedUp: config.ReadOnly,
+	}
+	if config.Cache.GcGracePeriod > 0 {
+		srv.cacheCollector = NewCacheCollector(time.Second * time.Duration(config.Cache.GcGracePeriod))
+	}
+	if config.Http.MaxRequests > 0 {
+		srv.requestSlots = make(chan struct{}, config.Http.MaxRequests)
+	}
+	// sources are created in the order of the configuration
+	for i, sourceconfig := range config.Sources {
+		srv.status.SetMaxAuthFailures(sources[i], sourceconfig.MaxAuthFailures)
 	}
 
 	// goroutine to update the blocks from the sources
@@ -77,14 +163,13 @@ func NewServer(config *Configuration) (srv *Server, err error) {
 		updateTimeout := 10
 		for {
 			if doUpdating {
-				log.Printf("Pulling sources.")
-
-				err := srv.PullSources()
+				err := srv.update(time.Second * time.Duration(updateTimeout))
 				if err != nil {
-					log.Printf("Could not pull sources: %v", err)
+					log.Printf("Could not update: %v", err)
 				}
 				if updateTimeout > 0 && srv.blockStore.Size() > 0 {
-					updateTimeout = srv.config.UpdateInterval
+					config, _ := srv.current()
+					updateTimeout = config.UpdateInterval
 				}
 			}
 
@@ -101,10 +186,49 @@ func NewServer(config *Configuration) (srv *Server, err error) {
 		}
 	}()
 
-	srv.router.GET("/", srv.handleIndexPage)
+	if config.Store.File != "" {
+		err = srv.loadStore()
+		if err != nil {
+			log.Printf("Could not load the persisted blocks: %v\n", err)
+			return
+		}
+	}
+
+	// handlers waiting for upstream servers or pulling sources take
+	// what they need of the configuration themselves
+	srv.router.GET("/", srv.readLocked(srv.handleIndexPage))
 	srv.router.GET("/image/:id", srv.handleImageRequest)
+	srv.router.GET("/image/:id/:file", srv.handleImageRequest)
+	srv.router.GET("/status", srv.readLocked(srv.handleStatus))
+	srv.router.GET("/api/blocks", srv.readLocked(srv.handleApiBlocks))
+	srv.router.GET("/page/:name", srv.readLocked(srv.handlePage))
+	// routes of optional templates and of the fixtures are answered with
+	// 404 while the current configuration does not have them
+	srv.router.GET("/placeholder/:name", srv.ifEnabled(hasFixtureSource, srv.readLocked(srv.handlePlaceholderImage)))
+	hasPermalinks := hasTemplate(config.PermalinkTemplateName())
+	srv.router.GET("/block/:id", srv.ifEnabled(hasPermalinks, srv.readLocked(srv.handleBlockPage)))
+	srv.router.GET("/share/:id", srv.ifEnabled(hasPermalinks, srv.handleShareImage))
+	srv.router.GET("/sitemap.xml", srv.ifEnabled(hasPermalinks, srv.readLocked(srv.handleSitemap)))
+	hasArchive := hasTemplate(config.ArchiveTemplateName())
+	srv.router.GET("/archive/:year/:month", srv.ifEnabled(hasArchive, srv.readLocked(srv.handleArchivePage)))
+	if config.Micropub.Token != "" {
+		srv.router.GET("/micropub", srv.handleMicropubQuery)
+		srv.router.POST("/micropub", srv.handleMicropubPost)
+	}
+	if config.Admin.Password != "" {
+		srv.router.GET("/admin/upload", srv.requireAdmin(srv.handleAdminUploadForm))
+		srv.router.POST("/admin/upload", srv.requireAdmin(srv.handleAdminUpload))
+		srv.router.GET("/admin/preview", srv.requireAdmin(srv.handleAdminPreview))
+		srv.router.GET("/admin/preview/:preview/image/:id", srv.requireAdmin(srv.handleAdminPreviewImage))
+		srv.router.GET("/admin/preview/:preview/image/:id/:file", srv.requireAdmin(srv.handleAdminPreviewImage))
+	}
 
-	fileServer := http.FileServer(http.Dir(config.StaticFilesDirectory()))
+	staticFiles, err := fs.Sub(config.SiteFiles(), "static")
+	if err != nil {
+		log.Printf("Could not setup static files: %v\n", err)
+		return
+	}
+	fileServer := http.FileServer(http.FS(staticFiles))
 	srv.router.Handler("GET", "/static/*filepath", http.StripPrefix("/static/", fileServer))
 	// fallback to static files un-resolved requests in root directory - for files
 	// like favicon.ico and robots.txt
@@ -112,6 +236,74 @@ func NewServer(config *Configuration) (srv *Server, err error) {
 	return
 }
 
+// the configuration and the sources, which are replaced when the
+// configuration gets reloaded. Pulls work on these, so reloadMtx is not
+// held while waiting for upstream servers.
+func (s *Server) current() (*Configuration, Sources) {
+	s.reloadMtx.RLock()
+	defer s.reloadMtx.RUnlock()
+	return s.config, s.sources
+}
+
+// wrap a handler reading the configuration, the pages or the templates,
+// so they are not replaced by a reload while it runs. It must not wait
+// for upstream servers, a pending reload blocks all further requests.
+func (s *Server) readLocked(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		s.reloadMtx.RLock()
+		defer s.reloadMtx.RUnlock()
+		handle(w, r, ps)
+	}
+}
+
+// wrap the handler of a route depending on the configuration, which
+// may change with a reload. The handler is called without holding
+// reloadMtx, so it may take it itself.
+func (s *Server) ifEnabled(enabled func(*Configuration, TemplateEngine) bool, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		s.reloadMtx.RLock()
+		found := enabled(s.config, s.templ)
+		s.reloadMtx.RUnlock()
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		handle(w, r, ps)
+	}
+}
+
+// check for an optional template of the site
+func hasTemplate(name string) func(*Configuration, TemplateEngine) bool {
+	return func(_ *Configuration, templ TemplateEngine) bool {
+		return templ.HasTemplate(name)
+	}
+}
+
+// the placeholder images are served for the fixture sources
+func hasFixtureSource(config *Configuration, _ TemplateEngine) bool {
+	for _, sourceconfig := range config.Sources {
+		if sourceconfig.Type == FixtureSourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// move blocks pulled with the sources of config over to the current
+// sources, in case the configuration got reloaded during the pull.
+// Blocks of sources which are not configured anymore are dropped.
+// Requires the write lock of reloadMtx.
+func (s *Server) currentBlocks(config *Configuration, blocks []*Block) []*Block {
+	if config == s.config {
+		return blocks
+	}
+	records := make([]BlockRecord, len(blocks))
+	for i, block := range blocks {
+		records[i] = block.Record()
+	}
+	return BlocksFromRecords(records, s.sources)
+}
+
 func (s *Server) StartUpdating() {
 	s.doUpdatingChan <- true
 }
@@ -120,67 +312,701 @@ func (s *Server) StopUpdating() {
 	s.doUpdatingChan <- false
 }
 
+// update the blocks. When running in a cluster, only the instance
+// getting the update lock pulls the sources.
+func (s *Server) update(interval time.Duration) error {
+	config, sources := s.current()
+	if config.ReadOnly {
+		return nil
+	}
+	if s.cluster == nil {
+		log.Printf("Pulling sources.")
+		return s.PullSources()
+	}
+
+	// let the lock expire shortly before the next update
+	lockTtl := interval - time.Second
+	if lockTtl < time.Second {
+		lockTtl = time.Second
+	}
+	isLeader, err := s.cluster.AcquireUpdateLock(lockTtl)
+	if err != nil {
+		return err
+	}
+	if !isLeader {
+		blocks, err := s.cluster.FetchBlocks(sources)
+		if err != nil {
+			return err
+		}
+		if len(blocks) > 0 {
+			s.reloadMtx.Lock()
+			defer s.reloadMtx.Unlock()
+			s.blockStore.Replace(s.currentBlocks(config, blocks))
+			return s.blocksChanged()
+		}
+		return nil
+	}
+
+	log.Printf("Pulling sources.")
+	err = s.PullSources()
+	if err != nil {
+		return err
+	}
+	return s.cluster.PublishBlocks(s.blockStore.List())
+}
+
+// load the blocks published by other instances of the cluster.
+// Does nothing when not running in a cluster.
+func (s *Server) LoadSharedBlocks() error {
+	if s.cluster == nil {
+		return nil
+	}
+	config, sources := s.current()
+	blocks, err := s.cluster.FetchBlocks(sources)
+	if err != nil {
+		return err
+	}
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+	s.blockStore.Replace(s.currentBlocks(config, blocks))
+	return s.prerender()
+}
+
+// pull a single source and update its blocks in the store. Nothing
+// is pulled in read-only mode.
+func (s *Server) refreshSource(source Source) error {
+	config, configSources := s.current()
+	if config.ReadOnly {
+		return ErrReadOnly
+	}
+	pipeline := NewPipeline(config, configSources, s.imgProxy)
+	sources := Sources{source}
+	sources = sources.Unfiltered()
+	err := sources.SendBlocksTo(pipeline, s.status)
+	if err != nil {
+		return err
+	}
+	blocks, _ := pipeline.GetBlocks()
+
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+	s.blockStore.ReceiveBlocks(s.currentBlocks(config, blocks))
+	s.trimStore()
+	return s.blocksChanged()
+}
+
+// load the blocks persisted in the store file
+func (s *Server) loadStore() error {
+	records, err := LoadBlockRecords(s.config.Store.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	blocks := BlocksFromRecords(records, s.sources)
+	if len(blocks) < len(records) {
+		log.Printf("Dropped %d persisted blocks of sources which are not configured anymore.",
+			len(records)-len(blocks))
+	}
+	// the limits may have changed since the blocks were stored
+	if s.config.HasPipelineStage(SummarizeStage) {
+		SummarizeBlocks(blocks, s.config.Summary.MaxLength)
+	}
+	s.blockStore.Replace(blocks)
+	s.trimStore()
+	if len(blocks) > 0 {
+		s.renderedMtx.Lock()
+		s.warmedUp = true
+		s.renderedMtx.Unlock()
+	}
+	return s.prerender()
+}
+
+// true until the blocks of the first update, or the persisted
+// blocks, are available
+func (s *Server) WarmingUp() bool {
+	s.renderedMtx.Lock()
+	defer s.renderedMtx.Unlock()
+	return !s.warmedUp
+}
+
+// answer with 503 while warming up, when configured. The page is
+// written nevertheless for the visitors.
+func (s *Server) writeWarmupStatus(w http.ResponseWriter) {
+	if s.config.Http.WarmupRetryAfter > 0 && s.WarmingUp() {
+		w.Header().Set("Retry-After", strconv.Itoa(s.config.Http.WarmupRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// remove the blocks exceeding the configured maximums and
+// apply the overflow policy to them
+func (s *Server) trimStore() {
+	maxBlocksPerSource := make(map[string]int)
+	// sources are created in the order of the configuration
+	for i, sourceconfig := range s.config.Sources {
+		maxBlocksPerSource[s.sources[i].Id()] = sourceconfig.MaxBlocks
+	}
+	removed := s.blockStore.Trim(s.config.Store.MaxBlocks, maxBlocksPerSource)
+	if len(removed) == 0 {
+		return
+	}
+	logDebugf("Removed %d blocks exceeding the maximum number of blocks", len(removed))
+
+	if s.config.Store.Overflow == ArchiveOverflow {
+		records := make([]BlockRecord, len(removed))
+		for i, block := range removed {
+			records[i] = block.Record()
+		}
+		err := ArchiveBlockRecords(s.config.Store.ArchiveFile, records)
+		if err != nil {
+			log.Printf("Could not archive %d blocks: %v", len(records), err)
+		}
+	}
+}
+
+// persist and pre-render the blocks after the contents of
+// the store have been changed
+func (s *Server) blocksChanged() error {
+	blocksVar.Set(int64(s.blockStore.Size()))
+	s.renderedMtx.Lock()
+	s.warmedUp = true
+	s.renderedMtx.Unlock()
+	err := s.saveStore()
+	if err != nil {
+		return err
+	}
+	return s.prerender()
+}
+
+// duration and size of the last rendering of each page
+var renderDurationVar = expvar.NewMap("honeybee_render_duration_ms")
+var renderSizeVar = expvar.NewMap("honeybee_render_bytes")
+
+// render a page into a buffer and record the duration and size
+func (s *Server) renderMeasured(page *Page) (rendered []byte, err error) {
+	name := "index"
+	if page != nil {
+		name = "page/" + page.Name()
+	}
+	started := time.Now()
+	buf := new(bytes.Buffer)
+	err = s.renderPage(buf, page)
+	if err != nil {
+		return
+	}
+	recordRender(name, time.Since(started), buf.Len())
+	return buf.Bytes(), nil
+}
+
+// export the duration and size of a rendered page
+func recordRender(name string, duration time.Duration, size int) {
+	durationVar := new(expvar.Float)
+	durationVar.Set(float64(duration) / float64(time.Millisecond))
+	renderDurationVar.Set(name, durationVar)
+	sizeVar := new(expvar.Int)
+	sizeVar.Set(int64(size))
+	renderSizeVar.Set(name, sizeVar)
+	logDebugf("Rendered %v in %v (%d bytes)", name, duration, size)
+}
+
+// number of blocks added to and removed from the store by the updates
+var blocksAddedVar = expvar.NewInt("honeybee_blocks_added")
+var blocksRemovedVar = expvar.NewInt("honeybee_blocks_removed")
+
+// number of blocks in the store
+var blocksVar = expvar.NewInt("honeybee_blocks")
+
+// export the changes between the blocks before and after an update
+func recordStoreChanges(before []*Block, after []*Block) {
+	ids := make(map[string]bool)
+	for _, block := range before {
+		ids[block.Id()] = true
+	}
+	for _, block := range after {
+		if ids[block.Id()] {
+			delete(ids, block.Id())
+		} else {
+			blocksAddedVar.Add(1)
+		}
+	}
+	blocksRemovedVar.Add(int64(len(ids)))
+}
+
+// render the pages using the current blocks, so requests can be answered
+// without rendering. This also surfaces template errors during updates.
+func (s *Server) prerender() error {
+	renderedIndex, err := s.renderMeasured(nil)
+	if err != nil {
+		return err
+	}
+	renderedPages := make(map[string][]byte)
+	for _, page := range s.pages {
+		renderedPages[page.Name()], err = s.renderMeasured(page)
+		if err != nil {
+			return err
+		}
+	}
+	blocks := s.blockStore.List()
+	ids := make([]string, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.Id()
+	}
+	revision := IdEncodeStrings(ids...)
+
+	s.renderedMtx.Lock()
+	s.renderedIndex = renderedIndex
+	s.renderedPages = renderedPages
+	s.revision = revision
+	s.renderedMtx.Unlock()
+	return nil
+}
+
+// persist the blocks to the store file, if one is configured
+func (s *Server) saveStore() error {
+	if s.config.Store.File == "" {
+		return nil
+	}
+	blocks := s.blockStore.List()
+	records := make([]BlockRecord, len(blocks))
+	for i, block := range blocks {
+		records[i] = block.Record()
+	}
+	return SaveBlockRecords(s.config.Store.File, records)
+}
+
+// the blocks currently served
+func (s *Server) Blocks() []*Block {
+	return s.blockStore.List()
+}
+
+// pull all sources and update the blocks in the store. The sources are
+// pulled without holding reloadMtx, only the store is updated with it.
 func (s *Server) PullSources() (err error) {
 	s.cache.DeleteSome()
 
-	// use the imageanalyser to fill the size attributes of the blocks
-	// this also has the effect of pre-seeding the cache
-	ia := NewImageAnalyzer(s.imgProxy)
-	_ = s.sources.SendBlocksTo(ia)
-	blocks, err := ia.GetBlocks()
+	// the analyze stage of the pipeline fills the size attributes of the
+	// blocks, this also has the effect of pre-seeding the cache
+	config, configSources := s.current()
+	pipeline := NewPipeline(config, configSources, s.imgProxy)
+	sources := configSources.Unfiltered()
+	pullErr := sources.SendBlocksTo(pipeline, s.status)
+	errs, _ := pullErr.(SourceErrors)
+	if len(errs) > 0 {
+		log.Printf("%d of %d sources could not be updated: %v", len(errs), len(configSources), errs.SourceIds())
+	}
+	s.status.ReportPull(len(configSources), errs)
+	blocks, err := pipeline.GetBlocks()
 	if err != nil {
 		return
 	}
-	s.blockStore.ReceiveBlocks(blocks)
-	return nil
+
+	s.reloadMtx.Lock()
+	before := s.blockStore.List()
+	s.blockStore.ReceiveBlocks(s.currentBlocks(config, blocks))
+	s.trimStore()
+	recordStoreChanges(before, s.blockStore.List())
+	cacheKeys := s.imgProxy.CacheKeys(s.blockStore.List())
+	err = s.blocksChanged()
+	s.reloadMtx.Unlock()
+
+	if s.cacheCollector != nil && len(errs) == 0 {
+		// failed sources would lose their cached images
+		deleted := s.cacheCollector.Collect(s.cache, cacheKeys)
+		if deleted > 0 {
+			logInfof("Removed %d unused cache entries", deleted)
+		}
+	}
+	return
 }
 
 // handle the request to an image
 func (s *Server) handleImageRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id := ps.ByName("id")
 	if id == "" {
-		log.Printf("imageRequest: Path variable id not found.\n")
+		requestPrintf(r.Context(), "imageRequest: Path variable id not found.\n")
 		http.NotFound(w, r)
 		return
 	}
-	block, found := s.blockStore.Get(id)
-	if !found {
-		http.NotFound(w, r)
+	block, public, ok := s.lookupBlock(w, r, id)
+	if !ok {
 		return
 	}
 	if !block.HasImage() {
 		http.NotFound(w, r)
 		return
 	}
+	// the url changes with the image, so caches may keep it forever
+	// when the served image matches the file name
+	file := ""
+	if public {
+		file = ps.ByName("file")
+	}
 	//fmt.Fprintf(w, "id=%v, %v", id, found)
+	s.serveBlockImage(w, r, block, file)
+}
+
+// serve the image of a block through the image proxy. See
+// ImgProxy.ServeImage for file
+func (s *Server) serveBlockImage(w http.ResponseWriter, r *http.Request, block *Block, file string) {
+	err := s.imgProxy.ServeImage(w, r.WithContext(contextForBlockImage(r.Context(), block)), block.ImageLink, file)
+	if errors.Is(err, ErrReadOnly) || errors.Is(err, ErrImageNotCached) {
+		http.NotFound(w, r)
+	} else if err != nil && !errors.Is(err, context.Canceled) {
+		requestInfof(r.Context(), "Could not serve the image of block %v: %v", block.Id(), err)
+		httpError(w, r, "Could not read image from upstream server", http.StatusInternalServerError)
+	}
+}
+
+// find a block for a request to its image and check the request may
+// access it. The images are fetched without holding reloadMtx, so a
+// reload does not wait for upstream servers.
+func (s *Server) lookupBlock(w http.ResponseWriter, r *http.Request, id string) (block *Block, public bool, ok bool) {
+	s.reloadMtx.RLock()
+	defer s.reloadMtx.RUnlock()
+	block, found := s.blockStore.Get(id)
+	if !found {
+		http.NotFound(w, r)
+		return nil, false, false
+	}
+	if !s.authorizeBlock(w, r, block) {
+		return nil, false, false
+	}
+	return block, s.isPublic(block), true
+}
 
-	err := s.imgProxy.ProxyImage(w, r, block.ImageLink)
+// handle the request to the page of a single block
+func (s *Server) handleBlockPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	block, found := s.blockStore.Get(ps.ByName("id"))
+	if !found || block.IsAbout() {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorizeBlock(w, r, block) {
+		return
+	}
+
+	blockPage := struct {
+		Block         *Block
+		Url           string
+		ShareImageUrl string
+		Vars          map[string]string
+		MetaTags      map[string]string
+		Image         ImageConfiguration
+	}{
+		Block:         block,
+		Url:           s.config.PermalinkUrl(block.Id()),
+		ShareImageUrl: s.config.ShareImageUrl(block.Id()),
+		Vars:          s.config.Vars,
+		MetaTags:      s.config.MetaTags,
+		Image:         s.config.Image,
+	}
+	started := time.Now()
+	buf := new(bytes.Buffer)
+	err := s.templ.Render(buf, s.config.PermalinkTemplateName(), blockPage)
 	if err != nil {
-		http.Error(w, "Could not read image from upstream server", http.StatusInternalServerError)
+		requestPrintf(r.Context(), "Could not render the page of block %v: %v", block.Id(), err)
+		httpError(w, r, "Could not render the page", http.StatusInternalServerError)
+		return
 	}
+	// block pages are recorded together
+	recordRender("block", time.Since(started), buf.Len())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if block.NoIndex {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	w.Write(buf.Bytes())
+}
+
+// list the index page and the pages of all blocks which may be indexed
+func (s *Server) handleSitemap(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	type sitemapUrl struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod,omitempty"`
+	}
+	sitemap := struct {
+		XMLName xml.Name     `xml:"urlset"`
+		Xmlns   string       `xml:"xmlns,attr"`
+		Urls    []sitemapUrl `xml:"url"`
+	}{
+		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		Urls:  []sitemapUrl{{Loc: strings.TrimRight(s.config.Http.PublicUrl, "/") + "/"}},
+	}
+	for _, block := range s.blockStore.List() {
+		if block.NoIndex || block.IsAbout() || !s.isPublic(block) {
+			continue
+		}
+		sitemap.Urls = append(sitemap.Urls, sitemapUrl{
+			Loc:     s.config.PermalinkUrl(block.Id()),
+			LastMod: block.TimeStamp.UTC().Format("2006-01-02"),
+		})
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(sitemap)
+}
+
+// handle the request to the share image of a block
+func (s *Server) handleShareImage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	block, _, ok := s.lookupBlock(w, r, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	if block.IsAbout() {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := s.imgProxy.ShareImage(block)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not create the share image of block %v: %v", block.Id(), err)
+		httpError(w, r, "Could not create the share image", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
 }
 
 // handle request to the index page
 func (s *Server) handleIndexPage(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s.renderedMtx.Lock()
+	renderedIndex := s.renderedIndex
+	s.renderedMtx.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	s.writePreloadHints(w)
+	s.writeWarmupStatus(w)
+	if renderedIndex != nil {
+		w.Write(renderedIndex)
+		return
+	}
+	err := s.renderPage(w, nil)
+	if err != nil {
+		requestPrintf(r.Context(), "Could not render the index page: %v", err)
+	}
+}
+
+// announce the first images of the index page, so browsers fetch
+// them while the page is still loading
+func (s *Server) writePreloadHints(w http.ResponseWriter) {
+	if s.config.Http.PreloadImages < 1 {
+		return
+	}
+	preloads := 0
+	for _, block := range s.blockStore.List() {
+		if preloads >= s.config.Http.PreloadImages {
+			break
+		}
+		if block.IsAbout() || !block.HasImage() || !s.isPublic(block) {
+			continue
+		}
+		// relative to the index page, like the links of the templates
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=preload; as=image", imageUrl(block)))
+		preloads++
+	}
+	if preloads > 0 && s.config.Http.EarlyHints {
+		w.WriteHeader(http.StatusEarlyHints)
+	}
+}
+
+// render a configured page or the index page when page is nil
+func (s *Server) renderPage(w io.Writer, page *Page) error {
+	if page != nil {
+		return s.renderIndexTemplate(w, page, "../")
+	}
+	return s.renderIndexTemplate(w, nil, "")
+}
+
+// render the admin preview of the blocks, served below /admin/
+func (s *Server) renderPreview(w io.Writer) error {
+	return s.renderIndexTemplate(w, nil, "../")
+}
+
+// render the index template with the blocks of a page, or the public
+// blocks when page is nil. root is the relative path to the root of the site
+func (s *Server) renderIndexTemplate(w io.Writer, page *Page, root string) error {
+	var blocks, about []*Block
+	for _, block := range s.blockStore.List() {
+		if block.IsAbout() {
+			about = append(about, block)
+		} else if page == nil && s.isPublic(block) {
+			blocks = append(blocks, block)
+		} else if page != nil && page.Contains(block) && (page.config.Private || s.isPublic(block)) {
+			// public pages leave out the blocks of private pages
+			blocks = append(blocks, block)
+		}
+	}
+
 	indexPage := struct {
-		Blocks   []*Block
+		Blocks []*Block
+		About  []*Block
+		// title of the page. Empty for the index page
+		Title string
+		// relative path to the root of the site
+		Root     string
 		Vars     map[string]string
 		MetaTags map[string]string
 		Image    ImageConfiguration
+		// the first update is still in progress, so blocks may be missing
+		WarmingUp bool
+		Sources   SourceStatsList
+	}{
+		Blocks:    blocks,
+		About:     about,
+		Vars:      s.config.Vars,
+		MetaTags:  s.config.MetaTags,
+		Image:     s.config.Image,
+		Root:      root,
+		WarmingUp: s.WarmingUp(),
+		Sources:   s.sourceStats(blocks),
+	}
+	if page != nil {
+		indexPage.Title = page.Title()
+	}
+	return s.templ.Render(w, s.config.IndexTemplateName(), indexPage)
+}
+
+// statistics of the sources for the blocks of a page
+func (s *Server) sourceStats(blocks []*Block) SourceStatsList {
+	statsList := make(SourceStatsList, len(s.sources))
+	byId := make(map[string]*SourceStats, len(s.sources))
+	for i, source := range s.sources {
+		stats := &SourceStats{
+			Id:   source.Id(),
+			Type: source.Type(),
+		}
+		// sources are created in the order of the configuration
+		if i < len(s.config.Sources) {
+			stats.Name = s.config.Sources[i].Name
+		}
+		if s.status != nil {
+			if status, found := s.status.Status(source); found {
+				stats.LastUpdate = status.LastSuccess
+			}
+		}
+		statsList[i] = stats
+		byId[stats.Id] = stats
+	}
+	for _, block := range blocks {
+		if block.Origin == nil {
+			continue
+		}
+		if stats, found := byId[block.Origin.Id()]; found {
+			stats.Blocks++
+			if block.TimeStamp.After(stats.Newest) {
+				stats.Newest = block.TimeStamp
+			}
+		}
+	}
+	return statsList
+}
+
+// report the status of the sources as JSON
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	status := struct {
+		LastPull PullSummary    `json:"last_pull"`
+		Sources  []SourceStatus `json:"sources"`
+		// the cache keeps its entries in memory as its storage failed
+		CacheDegraded bool `json:"cache_degraded"`
 	}{
-		Blocks:   s.blockStore.List(),
-		Vars:     s.config.Vars,
-		MetaTags: s.config.MetaTags,
-		Image:    s.config.Image,
+		LastPull: s.status.LastPull(),
+		Sources:  s.status.Sources(),
 	}
-	s.templ.ExecuteTemplate(w, s.config.IndexTemplateName(), indexPage)
+	if dc, ok := s.cache.(DegradableCache); ok {
+		status.CacheDegraded = dc.Degraded()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
 }
 
+// seconds clients are asked to wait when too many requests are handled
+const busyRetryAfter = 5
+
+// number of requests refused because too many were being handled
+var rejectedRequestsVar = expvar.NewInt("honeybee_rejected_requests")
+
 // implements http.Handler
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = identifyRequest(w, r)
+	if s.requestSlots != nil {
+		select {
+		case s.requestSlots <- struct{}{}:
+			defer func() { <-s.requestSlots }()
+		default:
+			rejectedRequestsVar.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(busyRetryAfter))
+			httpError(w, r, "Too many requests, try again later", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if handle, _, _ := s.router.Lookup(r.Method, r.URL.Path); handle == nil {
+		// the routes of the site come first, the mounted handlers can
+		// not shadow them
+		s.handlersMtx.Lock()
+		handlers := s.handlers
+		s.handlersMtx.Unlock()
+		if handlers != nil {
+			if handle, _, _ := handlers.Lookup(r.Method, r.URL.Path); handle != nil {
+				handlers.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
 	s.router.ServeHTTP(w, r)
 }
 
+// the router of the server, for applications embedding honeybee which
+// add their own routes. Routes must not be added while requests are
+// being served, use Handle for that.
+func (s *Server) Router() *httprouter.Router {
+	return s.router
+}
+
+// mount a handler for a path on the listener of the server, f.e. a
+// contact form of an application embedding honeybee. The handler gets
+// the request id and the request limit like the pages of the site.
+// Paths conflicting with the routes of the site or with other handlers
+// are refused.
+func (s *Server) Handle(method string, path string, handler http.Handler) (err error) {
+	if handle, _, _ := s.router.Lookup(method, path); handle != nil {
+		return fmt.Errorf("Could not add the route %v %v: it conflicts with a route of the site", method, path)
+	}
+
+	s.handlersMtx.Lock()
+	defer s.handlersMtx.Unlock()
+	routes := append(s.handlerRoutes[:len(s.handlerRoutes):len(s.handlerRoutes)], handlerRoute{method, path, handler})
+	handlers, err := newHandlerRouter(routes)
+	if err != nil {
+		return fmt.Errorf("Could not add the route %v %v: %v", method, path, err)
+	}
+	s.handlers = handlers
+	s.handlerRoutes = routes
+	return nil
+}
+
+// a route mounted with Server.Handle
+type handlerRoute struct {
+	method  string
+	path    string
+	handler http.Handler
+}
+
+// build a router of the mounted handlers. The router is only used when
+// all routes could be added to it.
+func newHandlerRouter(routes []handlerRoute) (router *httprouter.Router, err error) {
+	defer func() {
+		// httprouter panics on conflicting routes
+		if r := recover(); r != nil {
+			router, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	router = httprouter.New()
+	for _, route := range routes {
+		router.Handler(route.method, route.path, route.handler)
+	}
+	return router, nil
+}
+
 // start the http server, listen on the port from the configuration
 func (s *Server) Serve() error {
 	bindTo := fmt.Sprintf(":%v", s.config.Http.Port)
@@ -192,19 +1018,3 @@ func (s *Server) Serve() error {
 func (s *Server) DropCache() {
 	s.cache.DeleteAll()
 }
-
-// create a nested path for a cache key to avoid many
-// inodes in one directory
-func cacheTransformKeyToPath(s string) (parts []string) {
-	partLen := 2
-	depth := 3
-	sLen := len(s)
-	for i := 0; i < depth; i++ {
-		if (partLen * (i + 1)) > sLen {
-			parts = append(parts, "_")
-			break
-		}
-		parts = append(parts, s[partLen*i:partLen*(i+1)])
-	}
-	return
-}
@@ -0,0 +1,165 @@
+package honeybee
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// size of generated share images as recommended for open graph images
+const (
+	shareImageWidth    = 1200
+	shareImageHeight   = 630
+	shareImageMargin   = 60
+	shareImageFontSize = 56
+	shareImageMaxLines = 4
+)
+
+// background of share images of blocks without an image
+var shareImageBackground = color.RGBA{0x33, 0x7a, 0xb7, 0xff}
+
+// id of the share image of a block in the cache
+func shareImageCacheKey(block *Block) string {
+	h := sha1.New()
+	io.WriteString(h, "share|")
+	io.WriteString(h, block.Id())
+	io.WriteString(h, "|")
+	io.WriteString(h, block.ImageLink)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// return a png image to be used as open graph image of a block. The
+// image shows the title over the photo of the block or a plain background.
+// Generated images are cached.
+func (ipw *ImgProxy) ShareImage(block *Block) (data []byte, err error) {
+	cacheKey := shareImageCacheKey(block)
+	if data, ok := ipw.cache.Get(cacheKey); ok {
+		return data, nil
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, shareImageWidth, shareImageHeight))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(shareImageBackground), image.Point{}, draw.Src)
+	if block.HasImage() {
+		photo, photoErr := ipw.decodeImage(contextForBlockImage(context.Background(), block), block.ImageLink)
+		if photoErr != nil {
+			logInfof("Could not use the image of block %v for its share image: %v", block.Id(), photoErr)
+		} else {
+			drawFilled(canvas, photo)
+			// darken the photo to keep the title readable
+			draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.RGBA{0, 0, 0, 0x80}), image.Point{}, draw.Over)
+		}
+	}
+
+	err = drawTitle(canvas, block.Title)
+	if err != nil {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	err = png.Encode(buf, canvas)
+	if err != nil {
+		return
+	}
+	data = buf.Bytes()
+	ipw.cache.Set(cacheKey, data)
+	return
+}
+
+// decode an image served by the proxy
+func (ipw *ImgProxy) decodeImage(ctx context.Context, url string) (img image.Image, err error) {
+	dummyReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return
+	}
+	recorder := httptest.NewRecorder()
+	err = ipw.ProxyImage(recorder, dummyReq, url)
+	if err != nil {
+		return
+	}
+	img, _, err = image.Decode(bufio.NewReader(recorder.Body))
+	return
+}
+
+// scale and crop an image to cover the complete canvas
+func drawFilled(canvas *image.RGBA, img image.Image) {
+	src := img.Bounds()
+	dst := canvas.Bounds()
+	// crop the source to the aspect ratio of the canvas
+	if src.Dx()*dst.Dy() > src.Dy()*dst.Dx() {
+		width := src.Dy() * dst.Dx() / dst.Dy()
+		src.Min.X += (src.Dx() - width) / 2
+		src.Max.X = src.Min.X + width
+	} else {
+		height := src.Dx() * dst.Dy() / dst.Dx()
+		src.Min.Y += (src.Dy() - height) / 2
+		src.Max.Y = src.Min.Y + height
+	}
+	draw.CatmullRom.Scale(canvas, dst, img, src, draw.Src, nil)
+}
+
+// write the title to the bottom of the canvas, wrapped into lines
+func drawTitle(canvas *image.RGBA, title string) (err error) {
+	parsedFont, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return
+	}
+	face, err := opentype.NewFace(parsedFont, &opentype.FaceOptions{
+		Size:    shareImageFontSize,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.White,
+		Face: face,
+	}
+	maxWidth := fixed.I(shareImageWidth - 2*shareImageMargin)
+
+	// wrap the words of the title into lines
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(title) {
+		candidate := strings.TrimSpace(line + " " + word)
+		if line != "" && drawer.MeasureString(candidate) > maxWidth {
+			lines = append(lines, line)
+			line = word
+		} else {
+			line = candidate
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	if len(lines) > shareImageMaxLines {
+		lines = lines[:shareImageMaxLines]
+		lines[shareImageMaxLines-1] += "…"
+	}
+
+	lineHeight := face.Metrics().Height.Ceil()
+	y := shareImageHeight - shareImageMargin - (len(lines)-1)*lineHeight
+	for _, l := range lines {
+		drawer.Dot = fixed.P(shareImageMargin, y)
+		drawer.DrawString(l)
+		y += lineHeight
+	}
+	return
+}
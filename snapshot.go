@@ -0,0 +1,54 @@
+package honeybee
+
+import (
+	"errors"
+	"fmt"
+)
+
+const SnapshotSourceType = "snapshot"
+
+// SnapshotSource serves blocks from a file written by the
+// export-blocks command
+type SnapshotSource struct {
+	file string
+}
+
+func NewSnapshotSource(params SourceParams) (ss *SnapshotSource, err error) {
+	file := ""
+	for k, v := range params {
+		switch k {
+		case "file":
+			file = ExpandHome(v)
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", SnapshotSourceType, k)
+			return
+		}
+	}
+	if file == "" {
+		err = errors.New("'file' parameter is not set")
+		return
+	}
+	ss = &SnapshotSource{
+		file: file,
+	}
+	return ss, nil
+}
+
+func (ss *SnapshotSource) Type() string {
+	return SnapshotSourceType
+}
+
+func (ss *SnapshotSource) Id() string {
+	return IdEncodeStrings(ss.Type(), ss.file)
+}
+
+func (ss *SnapshotSource) GetBlocks() (blocks []*Block, err error) {
+	records, err := LoadBlockRecords(ss.file)
+	if err != nil {
+		return
+	}
+	for i := range records {
+		blocks = append(blocks, records[i].Block(ss))
+	}
+	return
+}
@@ -1,16 +1,26 @@
 package honeybee
 
 import (
-	"errors"
 	"fmt"
+	"github.com/russross/blackfriday"
 	"log"
+	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type SourceParams map[string]string
 
+// formats of the content of blocks
+const (
+	TextContentFormat     = "text"
+	MarkdownContentFormat = "markdown"
+	HtmlContentFormat     = "html"
+)
+
 type Source interface {
 	GetBlocks() ([]*Block, error)
 	Type() string
@@ -20,16 +30,76 @@ type Source interface {
 type Sources []Source
 type FilterFunc func(int, *Block) bool
 
-func (sources *Sources) SendBlocksTo(receiver BlockReceiver) (err error) {
-	sync_chan := make(chan error)
+// modifiers change blocks before they are filtered
+type ModifierFunc func(*Block)
+
+// the modifiers in the order they are applied to the blocks: the
+// opengraph modifier only looks for images the html modifier did not find
+var modifierOrder = []string{"html", "opengraph", "noindex"}
+
+func isKnownModifier(name string) bool {
+	for _, known := range modifierOrder {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// find a source by its id
+func (sources *Sources) Get(sourceId string) (source Source, found bool) {
+	for _, source = range *sources {
+		if source.Id() == sourceId {
+			return source, true
+		}
+	}
+	return nil, false
+}
+
+// the sources without their filters, for pulling blocks which get
+// filtered later on
+func (sources *Sources) Unfiltered() (unfiltered Sources) {
+	for _, source := range *sources {
+		if fs, ok := source.(*FilteredSource); ok {
+			source = fs.nestedSource
+		}
+		unfiltered = append(unfiltered, source)
+	}
+	return
+}
+
+// pull all sources concurrently and send their blocks to the receiver.
+// The results get recorded in the status registry when one is given,
+// sources disabled by the registry are skipped.
+func (sources *Sources) SendBlocksTo(receiver BlockReceiver, status *StatusRegistry) error {
+	sync_chan := make(chan *SourceError)
 
 	pullSource := func(sourceIndex int) {
-		blocks, pull_err := (*sources)[sourceIndex].GetBlocks()
-		if pull_err != nil {
-			log.Printf("Failed to fetch %v: %v\n", (*sources)[sourceIndex].Type(), pull_err)
+		source := (*sources)[sourceIndex]
+		if status != nil && status.IsDisabled(source) {
+			sync_chan <- nil
+			return
+		}
+		var pull_err *SourceError
+		started := time.Now()
+		blocks, get_err := source.GetBlocks()
+		if status != nil {
+			recordPullDuration(source, time.Since(started))
+		}
+		if get_err != nil {
+			pull_err = NewSourceError(source, get_err)
+			log.Printf("Failed to fetch %v: %v\n", source.Type(), pull_err)
 		} else {
 			receiver.ReceiveBlocks(blocks)
 		}
+		if status != nil {
+			// avoid passing a nil *SourceError as non-nil error
+			if pull_err != nil {
+				status.Report(source, len(blocks), pull_err)
+			} else {
+				status.Report(source, len(blocks), nil)
+			}
+		}
 		sync_chan <- pull_err
 	}
 
@@ -37,19 +107,22 @@ func (sources *Sources) SendBlocksTo(receiver BlockReceiver) (err error) {
 		go pullSource(idx)
 	}
 
-	// wait for all sources to finish
+	// wait for all sources to finish and collect the errors
+	var errs SourceErrors
 	for _ = range *sources {
-		var source_err error
-		source_err = <-sync_chan
-		if err == nil {
-			err = source_err
+		if source_err := <-sync_chan; source_err != nil {
+			errs = append(errs, source_err)
 		}
 	}
-	return err
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 type FilteredSource struct {
 	nestedSource Source
+	modifiers    []ModifierFunc
 	filters      []FilterFunc
 }
 
@@ -65,11 +138,38 @@ func (fs *FilteredSource) AddFilter(fn FilterFunc) {
 	fs.filters = append(fs.filters, fn)
 }
 
+func (fs *FilteredSource) AddModifier(fn ModifierFunc) {
+	fs.modifiers = append(fs.modifiers, fn)
+}
+
 func (fs *FilteredSource) GetBlocks() (blocks []*Block, err error) {
 	blocks, err = fs.nestedSource.GetBlocks()
 	if err != nil {
 		return
 	}
+	return fs.Apply(blocks), nil
+}
+
+// apply the modifiers and filters to blocks of the nested source
+func (fs *FilteredSource) Apply(blocks []*Block) []*Block {
+	return fs.Filter(fs.Modify(blocks))
+}
+
+// apply the modifiers to blocks of the nested source
+func (fs *FilteredSource) Modify(blocks []*Block) []*Block {
+	for _, modifier := range fs.modifiers {
+		for _, block := range blocks {
+			modifier(block)
+		}
+	}
+	return blocks
+}
+
+// apply the filters to blocks of the nested source, after the modifiers
+func (fs *FilteredSource) Filter(blocks []*Block) []*Block {
+	// the modifiers may have changed the content
+	ExtractBlockLinks(blocks)
+
 	// sort, to have the list prepared for index-based filters like the
 	// the "limit" filter
 	sort.Sort(ByTimeStamp(blocks))
@@ -83,14 +183,14 @@ func (fs *FilteredSource) GetBlocks() (blocks []*Block, err error) {
 		}
 		blocks = newBlocks
 	}
-	return blocks, nil
+	return blocks
 }
 
 // limit the number of blocks
 func makeLimitFilter(filterParam string) (fn FilterFunc, err error) {
 	limit, interr := strconv.ParseInt(filterParam, 10, 64)
 	if interr != nil {
-		err = errors.New(fmt.Sprintf("Could not parse limit value: %v\n", filterParam))
+		err = fmt.Errorf("Could not parse limit value: %v\n", filterParam)
 		return
 	}
 	fn = func(idx int, block *Block) bool {
@@ -126,29 +226,289 @@ func makeContentFilter(filterParam string) (fn FilterFunc, err error) {
 	return
 }
 
+// replace html content of blocks by its text. The first image of the
+// content is used as the image of blocks which have none.
+func makeHtmlModifier(modifierParam string) (fn ModifierFunc, err error) {
+	enabled, boolerr := strconv.ParseBool(modifierParam)
+	if boolerr != nil {
+		err = fmt.Errorf("Could not parse html value: %v\n", modifierParam)
+		return
+	}
+	fn = func(block *Block) {
+		if !enabled || block.Content == "" {
+			return
+		}
+		text, imageLink, htmlerr := ExtractHtml(block.Content)
+		if htmlerr != nil {
+			log.Printf("Could not extract text from the content of %v: %v", block.Link, htmlerr)
+			return
+		}
+		block.Content = text
+		if block.ImageLink == "" {
+			// images of the content may be relative to the linked page
+			block.ImageLink = ResolveUrl(block.Link, imageLink)
+		}
+	}
+	return
+}
+
+// exclude the blocks from search engines
+func makeNoIndexModifier(modifierParam string) (fn ModifierFunc, err error) {
+	noIndex, boolerr := strconv.ParseBool(modifierParam)
+	if boolerr != nil {
+		err = fmt.Errorf("Could not parse noindex value: %v\n", modifierParam)
+		return
+	}
+	fn = func(block *Block) {
+		block.NoIndex = noIndex
+	}
+	return
+}
+
+// link the images of the blocks at their upstream urls. Images which
+// only honeybee can load, local files or urls signed or requested with
+// the credentials of the source, are still served through honeybee.
+func makeDirectImageModifier(source Source) ModifierFunc {
+	return func(block *Block) {
+		if localLoaderFor(block.ImageLink) != nil {
+			return
+		}
+		if signer, ok := source.(ImageUrlSigner); ok {
+			if _, signed := signer.SignImageUrl(block.ImageLink); signed {
+				return
+			}
+		}
+		if authorizer, ok := source.(ImageRequestAuthorizer); ok && authorizer.ImageRequestHeader(block.ImageLink) != nil {
+			return
+		}
+		block.DirectImage = true
+	}
+}
+
+// rewrite the hosts of image links. Patterns are host names, or start
+// with "*." to match all subdomains. A replacement is a host name, or
+// an url whose scheme and host replace the ones of the link and whose
+// path is prepended to the path of the link.
+func makeImageHostModifier(hosts map[string]string) (fn ModifierFunc, err error) {
+	replacements := make(map[string]*url.URL, len(hosts))
+	for pattern, replacement := range hosts {
+		if !strings.Contains(replacement, "://") {
+			replacement = "//" + replacement
+		}
+		u, parseErr := url.Parse(replacement)
+		if parseErr != nil || u.Host == "" || u.RawQuery != "" {
+			err = fmt.Errorf("Could not parse image host replacement for %v: %v\n", pattern, hosts[pattern])
+			return
+		}
+		replacements[strings.ToLower(pattern)] = u
+	}
+	lookup := func(host string) *url.URL {
+		if replacement, found := replacements[host]; found {
+			return replacement
+		}
+		for i := strings.Index(host, "."); i >= 0; i = strings.Index(host, ".") {
+			host = host[i+1:]
+			if replacement, found := replacements["*."+host]; found {
+				return replacement
+			}
+		}
+		return nil
+	}
+	fn = func(block *Block) {
+		if block.ImageLink == "" {
+			return
+		}
+		link, parseErr := url.Parse(block.ImageLink)
+		if parseErr != nil || link.Host == "" {
+			return
+		}
+		replacement := lookup(strings.ToLower(link.Hostname()))
+		if replacement == nil {
+			return
+		}
+		if replacement.Scheme != "" {
+			link.Scheme = replacement.Scheme
+		}
+		link.Host = replacement.Host
+		if prefix := strings.TrimSuffix(replacement.Path, "/"); prefix != "" {
+			link.Path = prefix + link.Path
+			link.RawPath = ""
+		}
+		block.ImageLink = link.String()
+	}
+	return
+}
+
+// treat the content of blocks as plain text, markdown or html. Markdown
+// and html are sanitized into the trusted html content of the blocks,
+// the content is replaced by its text. The first image of the content
+// is used as the image of blocks which have none.
+func makeContentModifier(format string, elements []string) (fn ModifierFunc, err error) {
+	if len(elements) == 0 {
+		elements = DefaultSanitizedElements
+	}
+	allowed := make(map[string]bool, len(elements))
+	for _, element := range elements {
+		allowed[strings.ToLower(element)] = true
+	}
+
+	toHtml := func(block *Block) string {
+		return block.Content
+	}
+	switch format {
+	case TextContentFormat:
+		fn = func(block *Block) {
+			block.HtmlContent = ""
+		}
+		return
+	case MarkdownContentFormat:
+		toHtml = func(block *Block) string {
+			return string(blackfriday.MarkdownCommon([]byte(block.Content)))
+		}
+	case HtmlContentFormat:
+	default:
+		err = fmt.Errorf("Unknown content format: %v\n", format)
+		return
+	}
+	fn = func(block *Block) {
+		if block.Content == "" {
+			return
+		}
+		sanitized, htmlErr := SanitizeHtml(toHtml(block), allowed, block.Link)
+		if htmlErr != nil {
+			log.Printf("Could not sanitize the content of %v: %v", block.Link, htmlErr)
+			block.Content = ""
+			return
+		}
+		text, imageLink, htmlErr := ExtractHtml(sanitized)
+		if htmlErr != nil {
+			log.Printf("Could not extract text from the content of %v: %v", block.Link, htmlErr)
+			return
+		}
+		block.HtmlContent = sanitized
+		block.Content = text
+		// like the html modifier, which only sees the text afterwards
+		if block.ImageLink == "" {
+			block.ImageLink = imageLink
+		}
+	}
+	return
+}
+
 func CreateSources(config *Configuration) (sources Sources, err error) {
 	for _, sourceconfig := range config.Sources {
 		var source Source
 		switch sourceconfig.Type {
 		case GithubUserReposSourceType:
 			source, err = NewGithubUserReposSource(sourceconfig.Params)
+		case GithubUserActivitySourceType:
+			source, err = NewGithubUserActivitySource(sourceconfig.Params)
 		case FlickrUserPhotosSourceType:
 			source, err = NewFlickrUserPhotosSource(sourceconfig.Params)
 		case FlickrUserPhotosetSourceType:
 			source, err = NewFlickrUserPhotosetSource(sourceconfig.Params)
+		case AboutSourceType:
+			source, err = NewAboutSource(sourceconfig.Params)
+		case DemoSourceType:
+			source, err = NewDemoSource(sourceconfig.Params)
+		case ManualSourceType:
+			source, err = NewManualSource(sourceconfig.Params)
+		case SnapshotSourceType:
+			source, err = NewSnapshotSource(sourceconfig.Params)
+		case RssFeedSourceType:
+			source, err = NewRssFeedSource(sourceconfig.Params)
+		case BlueskyFeedSourceType:
+			source, err = NewBlueskyFeedSource(sourceconfig.Params)
+		case LastFmUserSourceType:
+			source, err = NewLastFmUserSource(sourceconfig.Params)
+		case S3BucketSourceType:
+			source, err = NewS3BucketSource(sourceconfig.Params)
+		case GhostBlogSourceType:
+			source, err = NewGhostBlogSource(sourceconfig.Params)
+		case HFeedSourceType:
+			source, err = NewHFeedSource(sourceconfig.Params)
+		case RedditSourceType:
+			source, err = NewRedditSource(sourceconfig.Params)
+		case RaindropCollectionSourceType:
+			source, err = NewRaindropCollectionSource(sourceconfig.Params)
+		case StackExchangeUserSourceType:
+			source, err = NewStackExchangeUserSource(sourceconfig.Params)
+		case TwitchChannelSourceType:
+			source, err = NewTwitchChannelSource(sourceconfig.Params)
+		case WikimediaCommonsUserSourceType:
+			source, err = NewWikimediaCommonsUserSource(sourceconfig.Params)
+		case ImmichAlbumSourceType:
+			source, err = NewImmichAlbumSource(sourceconfig.Params)
+		case PhotoPrismAlbumSourceType:
+			source, err = NewPhotoPrismAlbumSource(sourceconfig.Params)
+		case FiveHundredPxUserPhotosSourceType:
+			source, err = NewFiveHundredPxUserPhotosSource(sourceconfig.Params)
+		case PixelfedAccountSourceType:
+			source, err = NewPixelfedAccountSource(sourceconfig.Params)
+		case GiteaUserReposSourceType:
+			source, err = NewGiteaUserReposSource(sourceconfig.Params)
+		case FixtureSourceType:
+			source, err = NewFixtureSource(sourceconfig.Params)
 		default:
-			err = errors.New(fmt.Sprintf("Unknown source type: %v\n", sourceconfig.Type))
+			err = fmt.Errorf("%w: %v", ErrUnknownSourceType, sourceconfig.Type)
 			return
 		}
 		if err != nil {
-			err = errors.New(fmt.Sprintf("Could not create %v source: %v\n", sourceconfig.Type, err))
+			err = fmt.Errorf("Could not create %v source: %w", sourceconfig.Type, err)
 			return
 		}
 
-		if len(sourceconfig.Filters) > 0 {
+		directImages := !config.ProxiesImagesOf(sourceconfig)
+		if len(sourceconfig.Filters) > 0 || len(sourceconfig.Modifiers) > 0 || len(sourceconfig.ImageHosts) > 0 || sourceconfig.Content != "" || directImages {
 			filteredSource := &FilteredSource{
 				nestedSource: source,
 			}
+			if sourceconfig.Content != "" {
+				// before the other modifiers, which expect text
+				var fn ModifierFunc
+				fn, err = makeContentModifier(sourceconfig.Content, sourceconfig.ContentElements)
+				if err != nil {
+					return
+				}
+				filteredSource.AddModifier(fn)
+			}
+			for modifierName := range sourceconfig.Modifiers {
+				if !isKnownModifier(modifierName) {
+					err = fmt.Errorf("Unknown modifier: %v\n", modifierName)
+					return
+				}
+			}
+			for _, modifierName := range modifierOrder {
+				modifierParam, found := sourceconfig.Modifiers[modifierName]
+				if !found {
+					continue
+				}
+				var fn ModifierFunc
+				switch modifierName {
+				case "html":
+					fn, err = makeHtmlModifier(modifierParam)
+				case "opengraph":
+					fn, err = makeOpenGraphModifier(modifierParam)
+				case "noindex":
+					fn, err = makeNoIndexModifier(modifierParam)
+				}
+				if err != nil {
+					return
+				}
+				filteredSource.AddModifier(fn)
+			}
+			if len(sourceconfig.ImageHosts) > 0 {
+				// after the other modifiers, these may set image links
+				var fn ModifierFunc
+				fn, err = makeImageHostModifier(sourceconfig.ImageHosts)
+				if err != nil {
+					return
+				}
+				filteredSource.AddModifier(fn)
+			}
+			if directImages {
+				filteredSource.AddModifier(makeDirectImageModifier(source))
+			}
 			for filterName, filterParam := range sourceconfig.Filters {
 				var fn FilterFunc
 				switch filterName {
@@ -158,8 +518,10 @@ func CreateSources(config *Configuration) (sources Sources, err error) {
 					fn, err = makeTitleFilter(filterParam)
 				case "content":
 					fn, err = makeContentFilter(filterParam)
+				case "linkdomain":
+					fn, err = makeLinkDomainFilter(filterParam)
 				default:
-					err = errors.New(fmt.Sprintf("Unknown filter: %v\n", filterName))
+					err = fmt.Errorf("Unknown filter: %v\n", filterName)
 					return
 				}
 				if err != nil {
@@ -0,0 +1,227 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StackExchangeUserSourceType = "stackexchange-user"
+
+	stackExchangeApiUrl = "https://api.stackexchange.com/2.3"
+	// items per request allowed by the api
+	stackExchangeMaxPageSize = 100
+)
+
+// values of the mode parameter of the stack exchange source
+const (
+	StackExchangeAnswersMode   = "answers"
+	StackExchangeQuestionsMode = "questions"
+)
+
+// StackExchangeUserSource provides the recent answers or questions of a
+// user of a Stack Exchange site like Stack Overflow
+type StackExchangeUserSource struct {
+	// numeric id of the user on the site
+	userId string
+	// api name of the site, f.e. "stackoverflow" or "superuser"
+	site string
+	mode string
+	// optional key of a registered app, which raises the request quota
+	key   string
+	limit int
+}
+
+func NewStackExchangeUserSource(params SourceParams) (ss *StackExchangeUserSource, err error) {
+	ss = &StackExchangeUserSource{
+		site:  "stackoverflow",
+		mode:  StackExchangeAnswersMode,
+		limit: 20,
+	}
+	for k, v := range params {
+		switch k {
+		case "user":
+			if _, convErr := strconv.Atoi(v); convErr != nil {
+				err = fmt.Errorf("user must be the numeric id of the user, not %v", v)
+				return
+			}
+			ss.userId = v
+		case "site":
+			ss.site = v
+		case "mode":
+			switch v {
+			case StackExchangeAnswersMode, StackExchangeQuestionsMode:
+				ss.mode = v
+			default:
+				err = fmt.Errorf("Unknown mode for %v: %v", StackExchangeUserSourceType, v)
+				return
+			}
+		case "key":
+			ss.key = v
+		case "limit":
+			ss.limit, err = strconv.Atoi(v)
+			if err != nil || ss.limit < 1 || ss.limit > stackExchangeMaxPageSize {
+				err = fmt.Errorf("limit must be a number from 1 to %d, not %v", stackExchangeMaxPageSize, v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", StackExchangeUserSourceType, k)
+			return
+		}
+	}
+	if ss.userId == "" {
+		err = errors.New("'user' parameter is not set")
+		return
+	}
+	return ss, nil
+}
+
+func (ss *StackExchangeUserSource) Type() string {
+	return StackExchangeUserSourceType
+}
+
+func (ss *StackExchangeUserSource) Id() string {
+	return IdEncodeStrings(ss.Type(), ss.site, ss.userId, ss.mode)
+}
+
+func (ss *StackExchangeUserSource) Upstreams() []string {
+	return []string{stackExchangeApiUrl}
+}
+
+// stackExchangeError is returned for failed api requests
+type stackExchangeError struct {
+	// error_id of the api, the http status for most errors
+	Code    int    `json:"error_id"`
+	Name    string `json:"error_name"`
+	Message string `json:"error_message"`
+}
+
+func (e *stackExchangeError) Error() string {
+	return fmt.Sprintf("Stack Exchange API: %v (%v)", e.Message, e.Name)
+}
+
+// see https://api.stackexchange.com/docs/error-handling
+func (e *stackExchangeError) ErrorKind() ErrorKind {
+	switch e.Code {
+	case 401, 402, 403, 405, 406:
+		// access token required, invalid, denied or expired, key required
+		return ErrorKindAuth
+	case 502:
+		// throttle violation
+		return ErrorKindRateLimit
+	case 500, 503:
+		return ErrorKindNetwork
+	}
+	return ErrorKindOther
+}
+
+type stackExchangePost struct {
+	QuestionId   int      `json:"question_id"`
+	AnswerId     int      `json:"answer_id"`
+	Title        string   `json:"title"`
+	Link         string   `json:"link"`
+	Score        int      `json:"score"`
+	IsAccepted   bool     `json:"is_accepted"`
+	IsAnswered   bool     `json:"is_answered"`
+	AnswerCount  int      `json:"answer_count"`
+	CreationDate int64    `json:"creation_date"`
+	Tags         []string `json:"tags"`
+}
+
+type stackExchangeResponse struct {
+	Items []stackExchangePost `json:"items"`
+}
+
+// call the api and decode the items of the response
+func (ss *StackExchangeUserSource) get(path string, query url.Values) (items []stackExchangePost, err error) {
+	query.Set("site", ss.site)
+	if ss.key != "" {
+		query.Set("key", ss.key)
+	}
+	// responses are always gzip compressed, which the transport
+	// takes care of
+	resp, err := http.Get(stackExchangeApiUrl + path + "?" + query.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &stackExchangeError{Code: resp.StatusCode, Message: resp.Status}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return nil, apiErr
+	}
+	var response stackExchangeResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	return response.Items, err
+}
+
+func (ss *StackExchangeUserSource) GetBlocks() (blocks []*Block, err error) {
+	query := url.Values{}
+	query.Set("order", "desc")
+	query.Set("sort", "creation")
+	query.Set("pagesize", strconv.Itoa(ss.limit))
+	posts, err := ss.get("/users/"+ss.userId+"/"+ss.mode, query)
+	if err != nil {
+		return
+	}
+
+	// answers come without the title and the tags of their question
+	questions := make(map[int]stackExchangePost)
+	if ss.mode == StackExchangeAnswersMode && len(posts) > 0 {
+		var ids []string
+		for _, post := range posts {
+			ids = append(ids, strconv.Itoa(post.QuestionId))
+		}
+		var found []stackExchangePost
+		found, err = ss.get("/questions/"+strings.Join(ids, ";"), url.Values{"pagesize": {strconv.Itoa(len(ids))}})
+		if err != nil {
+			return
+		}
+		for _, question := range found {
+			questions[question.QuestionId] = question
+		}
+	}
+
+	for _, post := range posts {
+		block := NewBlock(ss)
+		block.TimeStamp = time.Unix(post.CreationDate, 0).UTC()
+		block.SetMeta("score", strconv.Itoa(post.Score))
+		if ss.mode == StackExchangeAnswersMode {
+			question := questions[post.QuestionId]
+			block.Title = html.UnescapeString(question.Title)
+			block.Link = fmt.Sprintf("%v/a/%d", siteUrlOfLink(question.Link), post.AnswerId)
+			block.Tags = question.Tags
+			block.Content = fmt.Sprintf("Score %d", post.Score)
+			if post.IsAccepted {
+				block.Content += ", accepted answer"
+			}
+		} else {
+			block.Title = html.UnescapeString(post.Title)
+			block.Link = post.Link
+			block.Tags = post.Tags
+			block.Content = fmt.Sprintf("Score %d, %d answers", post.Score, post.AnswerCount)
+		}
+		if block.Title == "" {
+			// the question has been deleted
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+	return
+}
+
+// scheme and host of the link of a question, the site it belongs to
+func siteUrlOfLink(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,400 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/google/go-github/v66/github"
+	"github.com/mmcdole/gofeed"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ErrorKind string
+
+const (
+	ErrorKindAuth      ErrorKind = "auth"
+	ErrorKindRateLimit ErrorKind = "rate-limit"
+	ErrorKindNetwork   ErrorKind = "network"
+	ErrorKindParse     ErrorKind = "parse"
+	ErrorKindOther     ErrorKind = "other"
+)
+
+// number of source errors by kind
+var sourceErrorsVar = expvar.NewMap("honeybee_source_errors")
+
+// number of sources which failed during the last pull
+var failedSourcesVar = expvar.NewInt("honeybee_failed_sources")
+
+// time of the last pull of all sources
+var lastPullVar = expvar.NewString("honeybee_last_pull")
+
+// duration of the last pull of each source, keyed by source id
+var sourcePullDurationVar = expvar.NewMap("honeybee_source_pull_duration_ms")
+
+// errors returned by sources can implement this interface
+// to provide their kind
+type kindedError interface {
+	ErrorKind() ErrorKind
+}
+
+// the rate limit of the api a source uses
+type RateLimit struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+	// time the remaining requests are reset to the limit
+	Reset time.Time `json:"reset"`
+}
+
+// sources of apis reporting their rate limit implement this interface.
+// known is false as long as the limit has not been reported.
+type RateLimitedSource interface {
+	RateLimit() (limit RateLimit, known bool)
+}
+
+// SourceError is an error which occurred while pulling a source
+type SourceError struct {
+	Kind       ErrorKind
+	SourceId   string
+	SourceType string
+	Err        error
+}
+
+func NewSourceError(source Source, err error) *SourceError {
+	return &SourceError{
+		Kind:       ClassifyError(err),
+		SourceId:   source.Id(),
+		SourceType: source.Type(),
+		Err:        err,
+	}
+}
+
+func (se *SourceError) Error() string {
+	return fmt.Sprintf("%v source %v (%v error): %v", se.SourceType, se.SourceId, se.Kind, se.Err)
+}
+
+func (se *SourceError) Unwrap() error {
+	return se.Err
+}
+
+// match the sentinel errors of the kinds, so callers can use
+// errors.Is(err, ErrSourceAuth)
+func (se *SourceError) Is(target error) bool {
+	switch target {
+	case ErrSourceAuth:
+		return se.Kind == ErrorKindAuth
+	case ErrSourceRateLimit:
+		return se.Kind == ErrorKindRateLimit
+	}
+	return false
+}
+
+// SourceErrors collects the errors of all sources which failed during a pull
+type SourceErrors []*SourceError
+
+func (se SourceErrors) Error() string {
+	if len(se) == 1 {
+		return se[0].Error()
+	}
+	msgs := make([]string, len(se))
+	for i, err := range se {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d sources failed: %v", len(se), strings.Join(msgs, "; "))
+}
+
+func (se SourceErrors) Unwrap() []error {
+	errs := make([]error, len(se))
+	for i, err := range se {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ids of the failed sources
+func (se SourceErrors) SourceIds() []string {
+	ids := make([]string, len(se))
+	for i, err := range se {
+		ids[i] = err.SourceId
+	}
+	return ids
+}
+
+// determinate the kind of an error. Wrapped errors are classified by
+// the errors they wrap.
+func ClassifyError(err error) ErrorKind {
+	var kinded kindedError
+	if errors.As(err, &kinded) {
+		return kinded.ErrorKind()
+	}
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr) {
+		return ErrorKindRateLimit
+	}
+	var githubErr *github.ErrorResponse
+	if errors.As(err, &githubErr) && githubErr.Response != nil {
+		switch githubErr.Response.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ErrorKindAuth
+		case http.StatusTooManyRequests:
+			return ErrorKindRateLimit
+		}
+	}
+	var feedErr gofeed.HTTPError
+	if errors.As(err, &feedErr) {
+		switch feedErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ErrorKindAuth
+		case http.StatusTooManyRequests:
+			return ErrorKindRateLimit
+		}
+		return ErrorKindNetwork
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var xmlErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &xmlErr) {
+		return ErrorKindParse
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		// includes *url.Error
+		return ErrorKindNetwork
+	}
+	switch {
+	case errors.Is(err, ErrSourceAuth):
+		return ErrorKindAuth
+	case errors.Is(err, ErrSourceRateLimit):
+		return ErrorKindRateLimit
+	case errors.Is(err, gofeed.ErrFeedTypeNotDetected):
+		return ErrorKindParse
+	}
+	return ErrorKindOther
+}
+
+// SourceStatus describes the result of the last pulls of a source
+type SourceStatus struct {
+	Id                      string    `json:"id"`
+	Type                    string    `json:"type"`
+	LastPull                time.Time `json:"last_pull"`
+	LastSuccess             time.Time `json:"last_success"`
+	BlockCount              int       `json:"block_count"`
+	LastError               string    `json:"last_error,omitempty"`
+	LastErrorKind           ErrorKind `json:"last_error_kind,omitempty"`
+	ConsecutiveFailures     int       `json:"consecutive_failures"`
+	ConsecutiveAuthFailures int       `json:"consecutive_auth_failures"`
+	// disabled after too many authentication failures
+	Disabled bool `json:"disabled"`
+	// rate limit of the api after the last pull, for sources which know it
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+
+	// number of consecutive authentication failures after which the
+	// source gets disabled. 0 means never
+	maxAuthFailures int
+}
+
+// PullSummary describes the result of the last pull of all sources
+type PullSummary struct {
+	Time          time.Time `json:"time"`
+	Sources       int       `json:"sources"`
+	FailedSources []string  `json:"failed_sources"`
+}
+
+// SourceStats describes a source for the templates, f.e. to show
+// "42 photos, updated 3 hours ago" next to its blocks
+type SourceStats struct {
+	Id   string
+	Type string
+	// name from the configuration. May be empty
+	Name string
+	// number of blocks of the source on the rendered page
+	Blocks int
+	// time of the newest block of the source on the rendered page
+	Newest time.Time
+	// time of the last successful pull. Zero when it is not known
+	LastUpdate time.Time
+}
+
+// statistics of all sources in the order of the configuration
+type SourceStatsList []*SourceStats
+
+// find the statistics of a source by its name or id. Returns nil for
+// unknown sources
+func (l SourceStatsList) Get(nameOrId string) *SourceStats {
+	for _, stats := range l {
+		if stats.Name == nameOrId || stats.Id == nameOrId {
+			return stats
+		}
+	}
+	return nil
+}
+
+// StatusRegistry collects the status of all sources
+type StatusRegistry struct {
+	sources   map[string]*SourceStatus
+	order     []string
+	lastPull  PullSummary
+	modifyMtx *sync.Mutex
+}
+
+func NewStatusRegistry() *StatusRegistry {
+	return &StatusRegistry{
+		sources:   make(map[string]*SourceStatus),
+		modifyMtx: new(sync.Mutex),
+	}
+}
+
+// get the status of a source. the mutex must be held by the caller
+func (sr *StatusRegistry) sourceStatus(source Source) *SourceStatus {
+	status, found := sr.sources[source.Id()]
+	if !found {
+		status = &SourceStatus{
+			Id:   source.Id(),
+			Type: source.Type(),
+		}
+		sr.sources[source.Id()] = status
+		sr.order = append(sr.order, source.Id())
+	}
+	return status
+}
+
+// disable the source after n consecutive authentication failures
+func (sr *StatusRegistry) SetMaxAuthFailures(source Source, n int) {
+	sr.modifyMtx.Lock()
+	defer sr.modifyMtx.Unlock()
+	sr.sourceStatus(source).maxAuthFailures = n
+}
+
+// record the result of pulling a source
+func (sr *StatusRegistry) Report(source Source, blockCount int, err error) {
+	sr.modifyMtx.Lock()
+	defer sr.modifyMtx.Unlock()
+
+	status := sr.sourceStatus(source)
+	status.LastPull = time.Now().UTC()
+	if fs, ok := source.(*FilteredSource); ok {
+		source = fs.nestedSource
+	}
+	if rs, ok := source.(RateLimitedSource); ok {
+		if limit, known := rs.RateLimit(); known {
+			status.RateLimit = &limit
+		}
+	}
+	if err == nil {
+		status.LastSuccess = status.LastPull
+		status.BlockCount = blockCount
+		status.LastError = ""
+		status.LastErrorKind = ""
+		status.ConsecutiveFailures = 0
+		status.ConsecutiveAuthFailures = 0
+		return
+	}
+
+	kind := ClassifyError(err)
+	if se, ok := err.(*SourceError); ok {
+		kind = se.Kind
+	}
+	sourceErrorsVar.Add(string(kind), 1)
+	// the status is public, the urls in the errors may contain api keys
+	status.LastError = redactUrls(err.Error())
+	status.LastErrorKind = kind
+	status.ConsecutiveFailures++
+	if kind == ErrorKindAuth {
+		status.ConsecutiveAuthFailures++
+		if status.maxAuthFailures > 0 && status.ConsecutiveAuthFailures >= status.maxAuthFailures {
+			log.Printf("Disabling %v source %v after %d authentication failures",
+				status.Type, status.Id, status.ConsecutiveAuthFailures)
+			status.Disabled = true
+		}
+	} else {
+		status.ConsecutiveAuthFailures = 0
+	}
+}
+
+func (sr *StatusRegistry) IsDisabled(source Source) bool {
+	sr.modifyMtx.Lock()
+	defer sr.modifyMtx.Unlock()
+	status, found := sr.sources[source.Id()]
+	return found && status.Disabled
+}
+
+// copy of the status of a source
+func (sr *StatusRegistry) Status(source Source) (status SourceStatus, found bool) {
+	sr.modifyMtx.Lock()
+	defer sr.modifyMtx.Unlock()
+	if st, ok := sr.sources[source.Id()]; ok {
+		return *st, true
+	}
+	return
+}
+
+// copy of the status of all sources
+func (sr *StatusRegistry) Sources() []SourceStatus {
+	sr.modifyMtx.Lock()
+	defer sr.modifyMtx.Unlock()
+	statuses := make([]SourceStatus, len(sr.order))
+	for i, sourceId := range sr.order {
+		statuses[i] = *sr.sources[sourceId]
+	}
+	return statuses
+}
+
+// record the result of pulling all sources
+func (sr *StatusRegistry) ReportPull(sourceCount int, errs SourceErrors) {
+	sr.modifyMtx.Lock()
+	defer sr.modifyMtx.Unlock()
+	sr.lastPull = PullSummary{
+		Time:          time.Now().UTC(),
+		Sources:       sourceCount,
+		FailedSources: errs.SourceIds(),
+	}
+	failedSourcesVar.Set(int64(len(errs)))
+	lastPullVar.Set(sr.lastPull.Time.Format(time.RFC3339))
+}
+
+// export the time it took to pull a source
+func recordPullDuration(source Source, duration time.Duration) {
+	durationVar := new(expvar.Float)
+	durationVar.Set(float64(duration) / float64(time.Millisecond))
+	sourcePullDurationVar.Set(source.Id(), durationVar)
+}
+
+// summary of the last pull of all sources
+func (sr *StatusRegistry) LastPull() PullSummary {
+	sr.modifyMtx.Lock()
+	defer sr.modifyMtx.Unlock()
+	return sr.lastPull
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s"']+`)
+
+// hide the values of the query parameters and the passwords of the urls
+// in a message, f.e. the api keys in the errors of failed requests
+func redactUrls(message string) string {
+	return urlPattern.ReplaceAllStringFunc(message, func(rawUrl string) string {
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return "<url>"
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+		}
+		if u.RawQuery != "" {
+			query := u.Query()
+			for key := range query {
+				query.Set(key, "redacted")
+			}
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	})
+}
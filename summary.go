@@ -0,0 +1,57 @@
+package honeybee
+
+import (
+	"strings"
+	"unicode"
+)
+
+type SummaryConfiguration struct {
+	// maximum number of characters of the summary of a block
+	MaxLength int `yaml:"max-length"`
+}
+
+// shorten a text to at most maxLength characters. The text is cut after
+// the last complete sentence fitting into the limit. When this would drop
+// more than half of the text, it is cut at a word boundary instead.
+func Summarize(text string, maxLength int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if maxLength < 1 || len(runes) <= maxLength {
+		return text
+	}
+
+	// end of the last sentence within the limit
+	sentenceEnd := -1
+	for i := 0; i < maxLength; i++ {
+		switch runes[i] {
+		case '.', '!', '?':
+			if i+1 == len(runes) || unicode.IsSpace(runes[i+1]) {
+				sentenceEnd = i + 1
+			}
+		}
+	}
+	if sentenceEnd > maxLength/2 {
+		return string(runes[:sentenceEnd])
+	}
+
+	// leave room for the ellipsis
+	cut := maxLength - 1
+	for i := cut; i > maxLength/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// fill the summaries of the blocks
+func SummarizeBlocks(blocks []*Block, maxLength int) {
+	for _, block := range blocks {
+		block.ModifyMtx.Lock()
+		block.Summary = Summarize(block.Content, maxLength)
+		block.ModifyMtx.Unlock()
+	}
+}
@@ -0,0 +1,153 @@
+package honeybee
+
+import (
+	"fmt"
+	"github.com/flosch/pongo2/v6"
+	"io"
+	"io/fs"
+	"path"
+	"reflect"
+	"text/template"
+)
+
+// template engines of the template-engine option
+const (
+	// text/template of the standard library, used by the builtin theme
+	GoTemplateEngine = "go"
+	// Django syntax, see https://github.com/flosch/pongo2
+	Pongo2TemplateEngine = "pongo2"
+)
+
+// TemplateEngine renders the pages of a site using the templates in the
+// templates directory of its theme
+type TemplateEngine interface {
+	// check if the theme provides a template, f.e. the optional
+	// permalink template
+	HasTemplate(name string) bool
+	// render a template with the data of a page
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+// parse the templates of the site using the configured engine. funcs
+// are made available to the templates.
+func newTemplateEngine(config *Configuration, funcs template.FuncMap) (TemplateEngine, error) {
+	switch config.TemplateEngine {
+	case "", GoTemplateEngine:
+		templ, err := template.New("t").Funcs(funcs).ParseFS(config.SiteFiles(), "templates/*.html")
+		if err != nil {
+			return nil, err
+		}
+		return &goTemplates{templ: templ}, nil
+	case Pongo2TemplateEngine:
+		return newPongo2Templates(config.SiteFiles(), funcs)
+	}
+	return nil, fmt.Errorf("Unknown template engine: %v", config.TemplateEngine)
+}
+
+type goTemplates struct {
+	templ *template.Template
+}
+
+func (t *goTemplates) HasTemplate(name string) bool {
+	return t.templ.Lookup(name) != nil
+}
+
+func (t *goTemplates) Render(w io.Writer, name string, data interface{}) error {
+	return t.templ.ExecuteTemplate(w, name, data)
+}
+
+// template functions returning html, which pongo2 must not escape
+var markupTemplateFuncs = map[string]bool{
+	"imageattrs":  true,
+	"attribution": true,
+	"jsonld":      true,
+}
+
+// pongo2Templates renders templates in Django syntax. The fields of the
+// page data are the variables of the templates, the template functions
+// are called like {{ imageurl(block) }}. Output is escaped unless
+// marked with the safe filter, f.e. {{ block.HtmlContent|safe }}.
+type pongo2Templates struct {
+	templates map[string]*pongo2.Template
+	funcs     pongo2.Context
+}
+
+func newPongo2Templates(siteFiles fs.FS, funcs template.FuncMap) (t *pongo2Templates, err error) {
+	templateFiles, err := fs.Sub(siteFiles, "templates")
+	if err != nil {
+		return
+	}
+	set := pongo2.NewSet("honeybee", pongo2.NewFSLoader(templateFiles))
+	t = &pongo2Templates{
+		templates: make(map[string]*pongo2.Template),
+		funcs:     make(pongo2.Context),
+	}
+	for name, f := range funcs {
+		if markupTemplateFuncs[name] {
+			f = safeTemplateFunc(f)
+		}
+		t.funcs[name] = f
+	}
+	// parse all templates up front, so errors show at startup
+	names, err := fs.Glob(templateFiles, "*.html")
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		t.templates[name], err = set.FromFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("template: %v: %w", path.Join("templates", name), err)
+		}
+	}
+	return
+}
+
+// wrap a template function returning a string to return a safe value,
+// keeping its parameters so pongo2 converts the arguments
+func safeTemplateFunc(f interface{}) interface{} {
+	fv := reflect.ValueOf(f)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumOut() != 1 || ft.Out(0).Kind() != reflect.String {
+		return f
+	}
+	in := make([]reflect.Type, ft.NumIn())
+	for i := range in {
+		in[i] = ft.In(i)
+	}
+	out := []reflect.Type{reflect.TypeOf((*pongo2.Value)(nil))}
+	return reflect.MakeFunc(reflect.FuncOf(in, out, ft.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+		var result []reflect.Value
+		if ft.IsVariadic() {
+			result = fv.CallSlice(args)
+		} else {
+			result = fv.Call(args)
+		}
+		return []reflect.Value{reflect.ValueOf(pongo2.AsSafeValue(result[0].String()))}
+	}).Interface()
+}
+
+func (t *pongo2Templates) HasTemplate(name string) bool {
+	_, found := t.templates[name]
+	return found
+}
+
+func (t *pongo2Templates) Render(w io.Writer, name string, data interface{}) error {
+	tpl, found := t.templates[name]
+	if !found {
+		return fmt.Errorf("template: no template %q", name)
+	}
+	context := make(pongo2.Context, len(t.funcs))
+	for name, f := range t.funcs {
+		context[name] = f
+	}
+	// the fields of the page data become the variables
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() {
+				context[field.Name] = v.Field(i).Interface()
+			}
+		}
+	}
+	return tpl.ExecuteWriter(context, w)
+}
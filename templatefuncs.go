@@ -0,0 +1,199 @@
+package honeybee
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// names of months and weekdays for the supported locales
+type localeNames struct {
+	months      [12]string
+	shortMonths [12]string
+	days        [7]string
+	shortDays   [7]string
+}
+
+var locales = map[string]*localeNames{
+	"de": {
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	},
+	"fr": {
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	"es": {
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	"it": {
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	"nl": {
+		months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		shortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	},
+}
+
+// layout elements which are replaced by localized names. Longer
+// elements have to come first.
+var localizedLayoutElements = []string{"January", "Monday", "Jan", "Mon"}
+
+// format a time like time.Format, but use the names of months
+// and weekdays of a locale
+func formatLocalized(t time.Time, layout string, names *localeNames) string {
+	if names == nil {
+		return t.Format(layout)
+	}
+	var out strings.Builder
+	for len(layout) > 0 {
+		// find the next element to localize
+		pos, element := -1, ""
+		for _, e := range localizedLayoutElements {
+			if p := strings.Index(layout, e); p != -1 && (pos == -1 || p < pos) {
+				pos, element = p, e
+			}
+		}
+		if pos == -1 {
+			out.WriteString(t.Format(layout))
+			break
+		}
+		out.WriteString(t.Format(layout[:pos]))
+		switch element {
+		case "January":
+			out.WriteString(names.months[t.Month()-1])
+		case "Jan":
+			out.WriteString(names.shortMonths[t.Month()-1])
+		case "Monday":
+			out.WriteString(names.days[t.Weekday()])
+		case "Mon":
+			out.WriteString(names.shortDays[t.Weekday()])
+		}
+		layout = layout[pos+len(element):]
+	}
+	return out.String()
+}
+
+// describe the time passed since t in words, f.e. "3 days ago"
+func timeAgo(t time.Time, now time.Time) string {
+	d := now.Sub(t)
+	if d < time.Minute {
+		return "just now"
+	}
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		return plural(int(d/(30*24*time.Hour)), "month")
+	}
+	return plural(int(d/(365*24*time.Hour)), "year")
+}
+
+// width and height attributes for the image of a block. The
+// dimensions are only known once the image has been analyzed.
+func imageAttrs(block *Block) string {
+	if block.ImageWidth < 1 || block.ImageHeight < 1 {
+		return ""
+	}
+	return fmt.Sprintf(`width="%d" height="%d"`, block.ImageWidth, block.ImageHeight)
+}
+
+// path of the image of a block relative to the root of the site. Once
+// the image has been analyzed, the path contains a hash of the image,
+// so it can be cached forever. Images which are not proxied are linked
+// at their upstream url.
+func imageUrl(block *Block) string {
+	if block.DirectImage {
+		return block.ImageLink
+	}
+	route := "image/"
+	if block.imageRoute != "" {
+		route = block.imageRoute
+	}
+	if block.ImageFile != "" {
+		return route + block.Id() + "/" + block.ImageFile
+	}
+	return route + block.Id()
+}
+
+// aspect ratio of the image of a block for the css aspect-ratio property
+func aspectRatio(block *Block) string {
+	if block.ImageWidth < 1 || block.ImageHeight < 1 {
+		return "auto"
+	}
+	return fmt.Sprintf("%d / %d", block.ImageWidth, block.ImageHeight)
+}
+
+// functions available in the templates. now provides the current
+// time for relative times, hasTemplate checks the templates of the
+// theme once they are parsed.
+func templateFuncs(config *Configuration, now func() time.Time, hasTemplate func(name string) bool) (template.FuncMap, error) {
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown timezone %v: %w", config.Timezone, err)
+	}
+	var names *localeNames
+	if config.Locale != "" && config.Locale != "en" {
+		var found bool
+		names, found = locales[config.Locale]
+		if !found {
+			return nil, fmt.Errorf("Unsupported locale: %v", config.Locale)
+		}
+	}
+
+	return template.FuncMap{
+		// convert a time to the configured timezone
+		"localtime": func(t time.Time) time.Time {
+			return t.In(location)
+		},
+		// format a time in the configured timezone using the configured date format
+		"date": func(t time.Time) string {
+			return formatLocalized(t.In(location), config.DateFormat, names)
+		},
+		// format a time in the configured timezone using a go time layout
+		"formatdate": func(layout string, t time.Time) string {
+			return formatLocalized(t.In(location), layout, names)
+		},
+		// the time passed since t in words. The pages are rendered after
+		// the updates, so it is only as accurate as the update interval
+		"timeago": func(t time.Time) string {
+			return timeAgo(t, now())
+		},
+		"imageattrs":  imageAttrs,
+		"aspectratio": aspectRatio,
+		"imageurl":    imageUrl,
+		// "<title> by <author>, <license>" for blocks with a license
+		"attribution": attribution,
+		// schema.org structured data of a block or a list of blocks
+		"jsonld": func(data interface{}) string {
+			return jsonLd(config, data, hasTemplate(config.PermalinkTemplateName()))
+		},
+		// machine readable representation of a time, f.e. for datetime attributes
+		"iso8601": func(t time.Time) string {
+			return t.In(location).Format(time.RFC3339)
+		},
+	}, nil
+}
@@ -0,0 +1,154 @@
+package honeybee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type ThumbnailOptions struct {
+	// maximum widths of the thumbnails. Defaults to the configured maxwidth
+	Sizes []int
+	// also write the thumbnails to <directory>/<width>/<block id>.<format>
+	Directory string
+}
+
+// sizes of thumbnails as given on the command line, f.e. "320,640,1280"
+func ParseThumbnailSizes(sizes string) (widths []int, err error) {
+	for _, size := range strings.Split(sizes, ",") {
+		width, convErr := strconv.Atoi(strings.TrimSpace(size))
+		if convErr != nil || width < 1 {
+			return nil, fmt.Errorf("Thumbnail sizes must be positive numbers, not %v", size)
+		}
+		widths = append(widths, width)
+	}
+	return
+}
+
+// transform the images of the blocks of the store file into all sizes
+// and put them in the cache, f.e. before deploying a static export. The
+// cache entries are keyed by the image settings, so they are used once
+// maxwidth is set to one of the sizes. Returns the number of images
+// which could not be generated.
+func GenerateThumbnails(config *Configuration, options ThumbnailOptions) (failed int, err error) {
+	srv, err := NewServer(config)
+	if err != nil {
+		return
+	}
+	sizes := options.Sizes
+	if len(sizes) == 0 {
+		sizes = []int{config.Image.Maxwidth}
+	}
+	var blocks []*Block
+	for _, block := range srv.Blocks() {
+		if block.HasImage() {
+			blocks = append(blocks, block)
+		}
+	}
+	if len(blocks) == 0 {
+		return 0, errors.New("The store file contains no blocks with images")
+	}
+
+	for _, width := range sizes {
+		sizeConfig := *config
+		sizeConfig.Image.Maxwidth = width
+		if config.Image.Crop && config.Image.Maxwidth > 0 {
+			// keep the aspect ratio of the cropped images
+			sizeConfig.Image.Maxheight = config.Image.Maxheight * width / config.Image.Maxwidth
+		}
+		imgProxy, proxyErr := NewImgProxy(&sizeConfig, srv.cache)
+		if proxyErr != nil {
+			return failed, proxyErr
+		}
+		imgProxy.SetUrlSigners(srv.sources)
+
+		directory := ""
+		if options.Directory != "" {
+			directory = filepath.Join(options.Directory, strconv.Itoa(width))
+			err = os.MkdirAll(directory, 0755)
+			if err != nil {
+				return
+			}
+		}
+		sizeFailed := imgProxy.generateThumbnails(blocks, directory)
+		logInfof("Generated %d thumbnails %dpx wide, %d failed", len(blocks)-sizeFailed, width, sizeFailed)
+		failed += sizeFailed
+	}
+	return failed, nil
+}
+
+// put the images of the blocks through the proxy using a pool of
+// workers, writing them into directory when it is set. Returns the
+// number of failed images.
+func (ipw *ImgProxy) generateThumbnails(blocks []*Block, directory string) (failed int) {
+	in_chan := make(chan *Block)
+	failedMtx := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+
+	numWorkers := runtime.NumCPU()
+	if numWorkers > len(blocks) {
+		numWorkers = len(blocks)
+	}
+	for wid := 0; wid < numWorkers; wid++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for block := range in_chan {
+				err := ipw.generateThumbnail(block, directory)
+				if err != nil {
+					logInfof("Could not generate the thumbnail of block %v from %v: %v", block.Id(), loggableUrl(block.ImageLink), err)
+					failedMtx.Lock()
+					failed++
+					failedMtx.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, block := range blocks {
+		in_chan <- block
+	}
+	close(in_chan)
+	wg.Wait()
+	return
+}
+
+func (ipw *ImgProxy) generateThumbnail(block *Block, directory string) error {
+	dummyReq, err := http.NewRequestWithContext(contextForBlockImage(context.Background(), block), "GET", block.ImageLink, nil)
+	if err != nil {
+		return err
+	}
+	recorder := httptest.NewRecorder()
+	err = ipw.ProxyImage(recorder, dummyReq, block.ImageLink)
+	if err != nil {
+		return err
+	}
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf("Upstream server answered with status %d", recorder.Code)
+	}
+	if directory == "" {
+		return nil
+	}
+	data := recorder.Body.Bytes()
+	extension := "img"
+	switch sniffContentType(data) {
+	case "image/jpeg":
+		extension = "jpg"
+	case "image/png":
+		extension = "png"
+	case "image/gif":
+		extension = "gif"
+	case "image/webp":
+		extension = "webp"
+	}
+	return ioutil.WriteFile(filepath.Join(directory, block.Id()+"."+extension), data, 0644)
+}
@@ -0,0 +1,197 @@
+package honeybee
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"willnorris.com/go/imageproxy"
+)
+
+// compression levels of png images
+const (
+	DefaultPngCompression = "default"
+	NoPngCompression      = "none"
+	SpeedPngCompression   = "speed"
+	BestPngCompression    = "best"
+)
+
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	DefaultPngCompression: png.DefaultCompression,
+	NoPngCompression:      png.NoCompression,
+	SpeedPngCompression:   png.BestSpeed,
+	BestPngCompression:    png.BestCompression,
+}
+
+// 3x3 convolution kernels
+var (
+	sharpenKernel = [9]float64{
+		0, -1, 0,
+		-1, 5, -1,
+		0, -1, 0,
+	}
+	smoothKernel = [9]float64{
+		1.0 / 16, 2.0 / 16, 1.0 / 16,
+		2.0 / 16, 4.0 / 16, 2.0 / 16,
+		1.0 / 16, 2.0 / 16, 1.0 / 16,
+	}
+)
+
+// imageTransform resizes images using imageproxy and applies the
+// format specific settings and filters of the image configuration
+type imageTransform struct {
+	options        imageproxy.Options
+	jpegQuality    int
+	webpQuality    int
+	pngCompression string
+	sharpen        bool
+	smooth         bool
+}
+
+func newImageTransform(c *ImageConfiguration) *imageTransform {
+	t := &imageTransform{
+		options: imageproxy.Options{
+			Width:  float64(c.Maxwidth),
+			Height: float64(c.Maxheight),
+			// keep the aspect ratio when both dimensions are limited
+			Fit:            !c.Crop,
+			Rotate:         0,
+			FlipVertical:   false,
+			FlipHorizontal: false,
+			Quality:        c.Quality,
+			Signature:      "",
+		},
+		jpegQuality:    c.Jpeg.Quality,
+		webpQuality:    c.Webp.Quality,
+		pngCompression: c.Png.Compression,
+		sharpen:        c.Sharpen,
+		smooth:         c.Smooth,
+	}
+	if t.jpegQuality == 0 {
+		t.jpegQuality = c.Quality
+	}
+	if t.webpQuality == 0 {
+		t.webpQuality = c.Quality
+	}
+	return t
+}
+
+// description of the settings, used for the keys of the cache. Without
+// format specific settings this matches the imageproxy options, so
+// existing cache entries stay valid.
+func (t *imageTransform) String() string {
+	if t.jpegQuality == t.options.Quality && t.webpQuality == t.options.Quality &&
+		t.pngCompression == DefaultPngCompression && !t.sharpen && !t.smooth {
+		return t.options.String()
+	}
+	return fmt.Sprintf("%v,jpeg:%d,webp:%d,png:%v,sharpen:%v,smooth:%v", t.options.String(),
+		t.jpegQuality, t.webpQuality, t.pngCompression, t.sharpen, t.smooth)
+}
+
+// resize an image of the given content type. Webp images are
+// encoded as jpeg by imageproxy, using the webp quality.
+func (t *imageTransform) Transform(data []byte, contentType string) ([]byte, error) {
+	options := t.options
+	switch contentType {
+	case "image/jpeg":
+		options.Quality = t.jpegQuality
+	case "image/webp":
+		options.Quality = t.webpQuality
+	}
+	transformed, err := imageproxy.Transform(data, options)
+	if err != nil {
+		return nil, err
+	}
+	if !t.sharpen && !t.smooth && t.pngCompression == DefaultPngCompression {
+		return transformed, nil
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(transformed))
+	if err != nil {
+		return nil, err
+	}
+	if format != "jpeg" && format != "png" {
+		// re-encoding would drop the frames of animated gifs
+		return transformed, nil
+	}
+	if format == "jpeg" && !t.sharpen && !t.smooth {
+		// only the png compression differs, re-encoding the jpeg
+		// would compress it a second time
+		return transformed, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(transformed))
+	if err != nil {
+		return nil, err
+	}
+	if t.smooth {
+		img = convolve(img, smoothKernel)
+	}
+	if t.sharpen {
+		img = convolve(img, sharpenKernel)
+	}
+
+	buf := new(bytes.Buffer)
+	if format == "jpeg" {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: options.Quality})
+	} else {
+		encoder := png.Encoder{CompressionLevel: pngCompressionLevels[t.pngCompression]}
+		err = encoder.Encode(buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// apply a 3x3 kernel to all channels of an image. The pixels at the
+// border are repeated for the parts of the kernel outside the image.
+func convolve(img image.Image, kernel [9]float64) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(bounds)
+	draw.Draw(src, bounds, img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(bounds)
+
+	clamp := func(v, min, max int) int {
+		if v < min {
+			return min
+		}
+		if v >= max {
+			return max - 1
+		}
+		return v
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var sum [4]float64
+			for ky := -1; ky <= 1; ky++ {
+				for kx := -1; kx <= 1; kx++ {
+					offset := src.PixOffset(clamp(x+kx, bounds.Min.X, bounds.Max.X), clamp(y+ky, bounds.Min.Y, bounds.Max.Y))
+					weight := kernel[(ky+1)*3+kx+1]
+					for c := 0; c < 4; c++ {
+						sum[c] += weight * float64(src.Pix[offset+c])
+					}
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			alpha := sum[3]
+			if alpha > 255 {
+				alpha = 255
+			} else if alpha < 0 {
+				alpha = 0
+			}
+			for c := 0; c < 4; c++ {
+				// premultiplied colors must not exceed the alpha value
+				v := sum[c]
+				if v < 0 {
+					v = 0
+				} else if v > alpha {
+					v = alpha
+				}
+				dst.Pix[offset+c] = uint8(v + 0.5)
+			}
+		}
+	}
+	return dst
+}
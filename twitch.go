@@ -0,0 +1,298 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TwitchChannelSourceType = "twitch-channel"
+
+	twitchApiUrl   = "https://api.twitch.tv/helix"
+	twitchTokenUrl = "https://id.twitch.tv/oauth2/token"
+	// items per request allowed by the api
+	twitchMaxLimit = 100
+	// size of the thumbnails, filled into their url templates
+	twitchThumbnailWidth  = "1280"
+	twitchThumbnailHeight = "720"
+)
+
+// values of the mode parameter of the twitch source
+const (
+	TwitchVideosMode = "videos"
+	TwitchClipsMode  = "clips"
+)
+
+// TwitchChannelSource provides the recent videos or clips of a
+// broadcaster using the Helix api
+type TwitchChannelSource struct {
+	userName     string
+	clientId     string
+	clientSecret string
+	mode         string
+	// kind of the videos: all, archive, highlight or upload
+	videoType string
+	// clips created in this number of days
+	clipDays int
+	limit    int
+
+	// app access token, requested with the client credentials
+	tokenMtx     sync.Mutex
+	token        string
+	tokenExpires time.Time
+}
+
+func NewTwitchChannelSource(params SourceParams) (ts *TwitchChannelSource, err error) {
+	ts = &TwitchChannelSource{
+		mode:      TwitchVideosMode,
+		videoType: "all",
+		clipDays:  30,
+		limit:     20,
+	}
+	for k, v := range params {
+		switch k {
+		case "user":
+			ts.userName = strings.ToLower(v)
+		case "client-id":
+			ts.clientId = v
+		case "client-secret":
+			ts.clientSecret = v
+		case "mode":
+			switch v {
+			case TwitchVideosMode, TwitchClipsMode:
+				ts.mode = v
+			default:
+				err = fmt.Errorf("Unknown mode for %v: %v", TwitchChannelSourceType, v)
+				return
+			}
+		case "video-type":
+			switch v {
+			case "all", "archive", "highlight", "upload":
+				ts.videoType = v
+			default:
+				err = fmt.Errorf("Unknown video type for %v: %v", TwitchChannelSourceType, v)
+				return
+			}
+		case "clip-days":
+			ts.clipDays, err = strconv.Atoi(v)
+			if err != nil || ts.clipDays < 1 {
+				err = fmt.Errorf("clip-days must be a positive number, not %v", v)
+				return
+			}
+		case "limit":
+			ts.limit, err = strconv.Atoi(v)
+			if err != nil || ts.limit < 1 || ts.limit > twitchMaxLimit {
+				err = fmt.Errorf("limit must be a number from 1 to %d, not %v", twitchMaxLimit, v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", TwitchChannelSourceType, k)
+			return
+		}
+	}
+	if ts.userName == "" {
+		err = errors.New("'user' parameter is not set")
+		return
+	}
+	if ts.clientId == "" || ts.clientSecret == "" {
+		err = errors.New("the 'client-id' and 'client-secret' parameters are required")
+		return
+	}
+	return ts, nil
+}
+
+func (ts *TwitchChannelSource) Type() string {
+	return TwitchChannelSourceType
+}
+
+func (ts *TwitchChannelSource) Id() string {
+	return IdEncodeStrings(ts.Type(), ts.userName, ts.mode, ts.videoType)
+}
+
+func (ts *TwitchChannelSource) Upstreams() []string {
+	return []string{twitchApiUrl, twitchTokenUrl}
+}
+
+// no token is issued for invalid client credentials
+func (ts *TwitchChannelSource) CheckCredentials() error {
+	_, err := ts.accessToken(true)
+	return err
+}
+
+// twitchError is returned for failed api requests
+type twitchError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *twitchError) Error() string {
+	return fmt.Sprintf("Twitch API: %v", e.Message)
+}
+
+func (e *twitchError) ErrorKind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		// the token endpoint answers invalid client ids with 400
+		return ErrorKindAuth
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	}
+	return ErrorKindOther
+}
+
+// read the error of a failed request
+func newTwitchError(resp *http.Response) *twitchError {
+	var errResp struct {
+		Message string `json:"message"`
+	}
+	message := resp.Status
+	if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Message != "" {
+		message = errResp.Message
+	}
+	return &twitchError{StatusCode: resp.StatusCode, Message: message}
+}
+
+// app access token using the client credentials flow. The token is
+// reused until it expires, or requested again when renew is set.
+func (ts *TwitchChannelSource) accessToken(renew bool) (token string, err error) {
+	ts.tokenMtx.Lock()
+	defer ts.tokenMtx.Unlock()
+	if !renew && ts.token != "" && time.Now().Before(ts.tokenExpires) {
+		return ts.token, nil
+	}
+	form := url.Values{}
+	form.Set("client_id", ts.clientId)
+	form.Set("client_secret", ts.clientSecret)
+	form.Set("grant_type", "client_credentials")
+	resp, err := http.PostForm(twitchTokenUrl, form)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", newTwitchError(resp)
+	}
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	if err != nil {
+		return
+	}
+	ts.token = tokenResp.AccessToken
+	// renew the token a bit before it expires
+	ts.tokenExpires = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - time.Minute)
+	return ts.token, nil
+}
+
+// call the api and decode the json response. The token is renewed
+// once when it has been revoked or expired.
+func (ts *TwitchChannelSource) get(path string, query url.Values, v interface{}) (err error) {
+	for attempt := 0; ; attempt++ {
+		token, err := ts.accessToken(attempt > 0)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest("GET", twitchApiUrl+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Client-Id", ts.clientId)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			resp.Body.Close()
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return newTwitchError(resp)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+}
+
+type twitchItem struct {
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Url          string    `json:"url"`
+	ThumbnailUrl string    `json:"thumbnail_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	ViewCount    int       `json:"view_count"`
+	// "1h2m3s" for videos, seconds for clips
+	Duration json.RawMessage `json:"duration"`
+	// clips only
+	CreatorName string `json:"creator_name"`
+}
+
+// url of the thumbnail in the size of the blocks. The thumbnails of
+// videos are url templates, the ones of clips have a fixed size.
+func (item *twitchItem) thumbnail() string {
+	thumbnail := strings.Replace(item.ThumbnailUrl, "%{width}", twitchThumbnailWidth, 1)
+	return strings.Replace(thumbnail, "%{height}", twitchThumbnailHeight, 1)
+}
+
+func (ts *TwitchChannelSource) GetBlocks() (blocks []*Block, err error) {
+	var users struct {
+		Data []struct {
+			Id string `json:"id"`
+		} `json:"data"`
+	}
+	err = ts.get("/users", url.Values{"login": {ts.userName}}, &users)
+	if err != nil {
+		return
+	}
+	if len(users.Data) == 0 {
+		return nil, fmt.Errorf("Twitch user %v does not exist", ts.userName)
+	}
+	userId := users.Data[0].Id
+
+	query := url.Values{}
+	query.Set("first", strconv.Itoa(ts.limit))
+	var path string
+	if ts.mode == TwitchClipsMode {
+		path = "/clips"
+		query.Set("broadcaster_id", userId)
+		// without a period the most viewed clips of all time are returned
+		query.Set("started_at", time.Now().AddDate(0, 0, -ts.clipDays).UTC().Format(time.RFC3339))
+	} else {
+		path = "/videos"
+		query.Set("user_id", userId)
+		query.Set("type", ts.videoType)
+		query.Set("sort", "time")
+	}
+	var items struct {
+		Data []twitchItem `json:"data"`
+	}
+	err = ts.get(path, query, &items)
+	if err != nil {
+		return
+	}
+
+	for _, item := range items.Data {
+		block := NewBlock(ts)
+		block.Title = item.Title
+		block.Link = item.Url
+		block.Content = item.Description
+		// videos still being recorded have no thumbnail yet
+		block.ImageLink = item.thumbnail()
+		block.TimeStamp = item.CreatedAt.UTC()
+		block.Tags = []string{VideoTag}
+		block.SetMeta("views", strconv.Itoa(item.ViewCount))
+		block.SetMeta("duration", strings.Trim(string(item.Duration), `"`))
+		block.SetMeta("author", item.CreatorName)
+		blocks = append(blocks, block)
+	}
+	return
+}
@@ -3,13 +3,14 @@ package honeybee
 import (
 	"crypto/sha1"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
-	"os/user"
-	"path"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 // base64 encode a byte slice and remove the padding characters ("=")
@@ -39,17 +40,47 @@ func IdEncodeStrings(parts ...string) string {
 	return IdEncode(h.Sum(nil))
 }
 
-// Expand the home directory in paths starting with "~/".
-// Returns the path unmodified when no tilde was found.
+// Expand the home directory in paths starting with "~/" (or "~\\" on windows).
+// Returns the path unmodified when no tilde was found or the home
+// directory could not be determined.
 func ExpandHome(p string) string {
-	// TODO: handle errors and handle tilde in the middle of paths
-	if p[:2] == "~/" {
-		usr, err := user.Current()
-		if err == nil {
-			p = path.Join(usr.HomeDir, p[2:])
-		}
+	if p == "" || p[0] != '~' {
+		return p
+	}
+	if len(p) > 1 && p[1] != '/' && p[1] != filepath.Separator {
+		// "~user" style paths are not supported
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	if len(p) == 1 {
+		return home
+	}
+	return filepath.Join(home, p[2:])
+}
+
+// directory to read the configuration from when none is given on the
+// command line: $XDG_CONFIG_HOME/honeybee on linux, %APPDATA%\\honeybee on
+// windows. Empty when there is no default for the platform.
+func DefaultConfigDirectory() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "honeybee")
+}
+
+// directory to use for the cache when none is configured:
+// $XDG_CACHE_HOME/honeybee on linux, %LOCALAPPDATA%\\honeybee on windows.
+// Empty when there is no default for the platform.
+func DefaultCacheDirectory() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
 	}
-	return p
+	return filepath.Join(cacheDir, "honeybee")
 }
 
 // ensure a directory exists, create it if it does not
@@ -66,8 +97,39 @@ func EnsureDirectoryExists(d string) (err error) {
 		}
 	} else {
 		if !stat.IsDir() {
-			return errors.New(fmt.Sprintf("%v already exists, but is not a directory", d))
+			return fmt.Errorf("%v already exists, but is not a directory", d)
 		}
 	}
 	return nil
 }
+
+// resolve a possibly relative url against the url of the document it was
+// found in. ref is returned unchanged when one of the urls is invalid.
+func ResolveUrl(base string, ref string) string {
+	if ref == "" || base == "" {
+		return ref
+	}
+	baseUrl, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refUrl, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseUrl.ResolveReference(refUrl).String()
+}
+
+// create a client for requests to upstream servers which follows
+// at most maxRedirects redirects. A timeout of 0 means no timeout.
+func newUpstreamClient(maxRedirects int, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("Stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+}
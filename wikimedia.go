@@ -0,0 +1,208 @@
+package honeybee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WikimediaCommonsUserSourceType = "wikimedia-commons-user"
+
+	wikimediaCommonsApiUrl = "https://commons.wikimedia.org/w/api.php"
+	// files per request for which the api creates thumbnails
+	wikimediaMaxLimit = 50
+	// width of the thumbnails requested for the blocks
+	wikimediaThumbnailWidth = 1280
+)
+
+// WikimediaCommonsUserSource provides the files uploaded to Wikimedia
+// Commons by a user, linking their file description pages
+type WikimediaCommonsUserSource struct {
+	userName string
+	limit    int
+}
+
+func NewWikimediaCommonsUserSource(params SourceParams) (ws *WikimediaCommonsUserSource, err error) {
+	ws = &WikimediaCommonsUserSource{
+		limit: 20,
+	}
+	for k, v := range params {
+		switch k {
+		case "user":
+			ws.userName = strings.TrimPrefix(v, "User:")
+		case "limit":
+			ws.limit, err = strconv.Atoi(v)
+			if err != nil || ws.limit < 1 || ws.limit > wikimediaMaxLimit {
+				err = fmt.Errorf("limit must be a number from 1 to %d, not %v", wikimediaMaxLimit, v)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown parameter for %v: %v", WikimediaCommonsUserSourceType, k)
+			return
+		}
+	}
+	if ws.userName == "" {
+		err = errors.New("'user' parameter is not set")
+		return
+	}
+	return ws, nil
+}
+
+func (ws *WikimediaCommonsUserSource) Type() string {
+	return WikimediaCommonsUserSourceType
+}
+
+func (ws *WikimediaCommonsUserSource) Id() string {
+	return IdEncodeStrings(ws.Type(), ws.userName)
+}
+
+func (ws *WikimediaCommonsUserSource) Upstreams() []string {
+	return []string{wikimediaCommonsApiUrl}
+}
+
+// wikimediaError is returned for failed api requests
+type wikimediaError struct {
+	Code string `json:"code"`
+	Info string `json:"info"`
+}
+
+func (e *wikimediaError) Error() string {
+	return fmt.Sprintf("Wikimedia API: %v (%v)", e.Info, e.Code)
+}
+
+// see https://www.mediawiki.org/wiki/API:Errors_and_warnings
+func (e *wikimediaError) ErrorKind() ErrorKind {
+	switch e.Code {
+	case "ratelimited":
+		return ErrorKindRateLimit
+	case "maxlag", "readonly":
+		return ErrorKindNetwork
+	}
+	return ErrorKindOther
+}
+
+// a value of the extended metadata of a file
+type wikimediaMetadataValue struct {
+	Value string `json:"value"`
+}
+
+type wikimediaResponse struct {
+	Error *wikimediaError `json:"error"`
+	Query struct {
+		Pages []struct {
+			Title     string `json:"title"`
+			ImageInfo []struct {
+				Timestamp      time.Time `json:"timestamp"`
+				DescriptionUrl string    `json:"descriptionurl"`
+				ThumbUrl       string    `json:"thumburl"`
+				Mime           string    `json:"mime"`
+				// values of the metadata may contain html
+				ExtMetadata struct {
+					ObjectName       wikimediaMetadataValue `json:"ObjectName"`
+					ImageDescription wikimediaMetadataValue `json:"ImageDescription"`
+					Artist           wikimediaMetadataValue `json:"Artist"`
+					License          wikimediaMetadataValue `json:"License"`
+				} `json:"extmetadata"`
+			} `json:"imageinfo"`
+		} `json:"pages"`
+	} `json:"query"`
+}
+
+// license id of the License metadata, like "cc-by-sa-4.0". Empty for
+// licenses which are not known.
+func wikimediaLicense(license string) string {
+	switch {
+	case strings.HasPrefix(license, "cc-by"):
+		return strings.ToUpper(license)
+	case license == "cc0":
+		return "CC0-1.0"
+	case license == "pd":
+		return "PDM-1.0"
+	}
+	return ""
+}
+
+// text of a metadata value
+func wikimediaText(value wikimediaMetadataValue) string {
+	text, _, err := ExtractHtml(value.Value)
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+func (ws *WikimediaCommonsUserSource) GetBlocks() (blocks []*Block, err error) {
+	query := url.Values{}
+	query.Set("action", "query")
+	query.Set("format", "json")
+	query.Set("formatversion", "2")
+	query.Set("generator", "allimages")
+	query.Set("gaiuser", ws.userName)
+	query.Set("gaisort", "timestamp")
+	query.Set("gaidir", "descending")
+	query.Set("gailimit", strconv.Itoa(ws.limit))
+	query.Set("prop", "imageinfo")
+	query.Set("iiprop", "timestamp|url|mime|extmetadata")
+	query.Set("iiurlwidth", strconv.Itoa(wikimediaThumbnailWidth))
+	query.Set("iiextmetadatafilter", "ObjectName|ImageDescription|Artist|License")
+
+	req, err := http.NewRequest("GET", wikimediaCommonsApiUrl+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	// wikimedia refuses requests without a descriptive user agent
+	req.Header.Set("User-Agent", scraperUserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &wikimediaError{Code: strconv.Itoa(resp.StatusCode), Info: resp.Status}
+	}
+	var response wikimediaResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	for _, page := range response.Query.Pages {
+		if len(page.ImageInfo) == 0 {
+			continue
+		}
+		info := page.ImageInfo[0]
+		block := NewBlock(ws)
+		block.Title = wikimediaText(info.ExtMetadata.ObjectName)
+		if block.Title == "" {
+			name := strings.TrimPrefix(page.Title, "File:")
+			block.Title = strings.TrimSuffix(name, path.Ext(name))
+		}
+		block.Link = info.DescriptionUrl
+		block.Content = wikimediaText(info.ExtMetadata.ImageDescription)
+		// audio files and documents have no thumbnail
+		block.ImageLink = info.ThumbUrl
+		block.TimeStamp = info.Timestamp.UTC()
+		if strings.HasPrefix(info.Mime, "video/") {
+			block.Tags = append(block.Tags, VideoTag)
+		}
+		block.SetMeta("author", wikimediaText(info.ExtMetadata.Artist))
+		block.SetMeta("license", wikimediaLicense(info.ExtMetadata.License.Value))
+		blocks = append(blocks, block)
+	}
+	// the pages of the generator are not in the order of the uploads
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].TimeStamp.After(blocks[j].TimeStamp)
+	})
+	return
+}